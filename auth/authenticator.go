@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/jefferyfry/eventengine/config"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Config selects how callers authenticate. Bearer ID tokens are accepted when an OIDC issuer, JWKS file or
+// JWKS url is set. oauth2-proxy headers are accepted when TrustProxyHeaders is set, and only from ProxyCIDRs
+// on requests that carry ProxySecret in the PROXY_SECRET_HEADER set by the ingress. Teams scope which sessions
+// a caller sees.
+type Config struct {
+	Enabled           bool
+	Issuer            string
+	Audiences         []string
+	JWKSFile          string
+	JWKSURL           string
+	GroupsClaim       string
+	Leeway            time.Duration
+	TrustProxyHeaders bool
+	ProxyCIDRs        []*net.IPNet
+	ProxySecret       string
+	Roles             RoleMapping
+	Teams             TeamMapping
+}
+
+func ConfigFromEnv() (Config, error) {
+	authConfig := Config{
+		Enabled:           config.GetBool("eventengine_auth_enabled", true),
+		Issuer:            config.GetString("eventengine_auth_oidc_issuer", ""),
+		Audiences:         config.GetList("eventengine_auth_oidc_audiences"),
+		JWKSFile:          config.GetString("eventengine_auth_jwks_file", ""),
+		JWKSURL:           config.GetString("eventengine_auth_jwks_url", ""),
+		GroupsClaim:       config.GetString("eventengine_auth_groups_claim", "groups"),
+		Leeway:            config.GetDuration("eventengine_auth_leeway", time.Minute),
+		TrustProxyHeaders: config.GetBool("eventengine_auth_trust_proxy_headers", false),
+		ProxySecret:       config.GetString("eventengine_auth_proxy_secret", ""),
+		Roles: RoleMapping{
+			Groups:      map[string]string{},
+			Emails:      map[string]string{},
+			DefaultRole: config.GetString("eventengine_auth_default_role", ""),
+		},
+		Teams: TeamMapping{
+			Claim:       config.GetString("eventengine_auth_team_claim", "team"),
+			GroupPrefix: config.GetString("eventengine_auth_team_group_prefix", ""),
+		},
+	}
+	for _, cidr := range config.GetList("eventengine_auth_proxy_cidrs") {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return authConfig, fmt.Errorf("invalid eventengine_auth_proxy_cidrs entry %s: %w", cidr, err)
+		}
+		authConfig.ProxyCIDRs = append(authConfig.ProxyCIDRs, network)
+	}
+	//lower roles first so a group or email listed twice gets the higher role
+	for _, role := range []string{ROLE_VIEWER, ROLE_EVENT_MANAGER, ROLE_ADMIN} {
+		key := strings.ReplaceAll(role, "-", "_")
+		for _, group := range config.GetList("eventengine_auth_" + key + "_groups") {
+			authConfig.Roles.Groups[group] = role
+		}
+		for _, email := range config.GetList("eventengine_auth_" + key + "_emails") {
+			authConfig.Roles.Emails[strings.ToLower(email)] = role
+		}
+	}
+	return authConfig, nil
+}
+
+// PROXY_SECRET_HEADER carries the secret that the ingress adds to the requests it has authenticated.
+const PROXY_SECRET_HEADER = "X-Auth-Proxy-Secret"
+
+type Authenticator struct {
+	config   Config
+	verifier *Verifier
+}
+
+func NewAuthenticator(authConfig Config) (*Authenticator, error) {
+	if !authConfig.Enabled {
+		log.Println("Authentication is disabled. Anyone who can reach the server can use the admin API.")
+		return &Authenticator{config: authConfig}, nil
+	}
+	if authConfig.Roles.DefaultRole != "" && !ValidRole(authConfig.Roles.DefaultRole) {
+		return nil, fmt.Errorf("unknown default role %s", authConfig.Roles.DefaultRole)
+	}
+	//everyone the identity provider admits gets the default role, so it must not allow changes
+	if roleRanks[authConfig.Roles.DefaultRole] > roleRanks[ROLE_VIEWER] {
+		return nil, fmt.Errorf("eventengine_auth_default_role can be at most %s. Grant %s by group or email", ROLE_VIEWER, authConfig.Roles.DefaultRole)
+	}
+	if authConfig.TrustProxyHeaders && len(authConfig.ProxyCIDRs) == 0 {
+		return nil, errors.New("eventengine_auth_proxy_cidrs must list the addresses of the proxy when eventengine_auth_trust_proxy_headers is set, or anyone could send the headers")
+	}
+	//any pod in the proxy's range could otherwise send the headers
+	if authConfig.TrustProxyHeaders && authConfig.ProxySecret == "" {
+		return nil, errors.New("eventengine_auth_proxy_secret must be set to the secret the ingress sends in " + PROXY_SECRET_HEADER + " when eventengine_auth_trust_proxy_headers is set")
+	}
+
+	authenticator := &Authenticator{config: authConfig}
+	if authConfig.Issuer != "" || authConfig.JWKSFile != "" || authConfig.JWKSURL != "" {
+		if len(authConfig.Audiences) == 0 {
+			return nil, errors.New("eventengine_auth_oidc_audiences must name the client id that ID tokens are issued for")
+		}
+		var keys *KeySet
+		client := &http.Client{Timeout: 10 * time.Second}
+		switch {
+		case authConfig.JWKSFile != "":
+			var err error
+			if keys, err = NewKeySetFile(authConfig.JWKSFile); err != nil {
+				return nil, err
+			}
+		case authConfig.JWKSURL != "":
+			keys = NewKeySetURL(authConfig.JWKSURL, client)
+		default:
+			keys = NewKeySetDiscovery(authConfig.Issuer, client)
+		}
+		authenticator.verifier = &Verifier{keys, authConfig.Issuer, authConfig.Audiences, authConfig.Leeway}
+		log.Printf("Accepting OIDC ID tokens for %v.", authConfig.Audiences)
+	}
+	if authConfig.TrustProxyHeaders {
+		log.Printf("Accepting oauth2-proxy headers from %s.", describeCIDRs(authConfig.ProxyCIDRs))
+	}
+	if authenticator.verifier == nil && !authConfig.TrustProxyHeaders {
+		return nil, errors.New("no authentication method is configured. Set eventengine_auth_oidc_issuer, eventengine_auth_jwks_file or eventengine_auth_trust_proxy_headers, or set eventengine_auth_enabled=false")
+	}
+	return authenticator, nil
+}
+
+// Authenticate returns the principal making request, or nil when the request carries no credentials. When
+// authentication is disabled every request is an admin with an empty ID.
+func (a *Authenticator) Authenticate(request *http.Request) (*Principal, error) {
+	if !a.config.Enabled {
+		return &Principal{Role: ROLE_ADMIN, Method: METHOD_DISABLED}, nil
+	}
+	//API keys are checked before the authenticator is consulted
+	if authorization := request.Header.Get("Authorization"); a.verifier != nil && strings.HasPrefix(authorization, "Bearer ") {
+		return a.fromToken(strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")))
+	}
+	if a.config.TrustProxyHeaders && a.fromTrustedProxy(request.RemoteAddr) && a.proxySecretMatches(request.Header) {
+		return a.fromProxyHeaders(request.Header), nil
+	}
+	return nil, nil
+}
+
+func (a *Authenticator) fromToken(token string) (*Principal, error) {
+	claims, err := a.verifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	principal := &Principal{
+		Subject: claims.String("sub"),
+		Name:    claims.String("name"),
+		Groups:  claims.Strings(a.config.GroupsClaim),
+		Method:  METHOD_OIDC,
+	}
+	//an unverified email must not be trusted to grant a role
+	if verified, ok := claims["email_verified"].(bool); !ok || verified {
+		principal.Email = claims.String("email")
+	}
+	if principal.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	principal.Role = a.config.Roles.Role(principal.Email, principal.Groups)
+	principal.Teams = a.config.Teams.Teams(claims.Strings(a.config.Teams.Claim), principal.Groups)
+	return principal, nil
+}
+
+// fromProxyHeaders reads the headers oauth2-proxy sets with --set-xauthrequest, as passed on by the nginx
+// ingress. The ingress overwrites these headers on the secure paths and clears them on the public ones, so
+// clients cannot set them. It returns nil when none are present.
+func (a *Authenticator) fromProxyHeaders(header http.Header) *Principal {
+	email := strings.TrimSpace(header.Get("X-Auth-Request-Email"))
+	user := strings.TrimSpace(header.Get("X-Auth-Request-User"))
+	if email == "" && user == "" {
+		return nil
+	}
+	principal := &Principal{Subject: user, Email: email, Method: METHOD_PROXY}
+	if principal.Subject == "" {
+		principal.Subject = email
+	}
+	for _, group := range strings.Split(header.Get("X-Auth-Request-Groups"), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			principal.Groups = append(principal.Groups, group)
+		}
+	}
+	principal.Role = a.config.Roles.Role(principal.Email, principal.Groups)
+	principal.Teams = a.config.Teams.Teams(nil, principal.Groups)
+	return principal
+}
+
+func (a *Authenticator) fromTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, network := range a.config.ProxyCIDRs {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxySecretMatches compares the secret the request carries to ProxySecret in constant time.
+func (a *Authenticator) proxySecretMatches(header http.Header) bool {
+	secret := header.Get(PROXY_SECRET_HEADER)
+	return secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(a.config.ProxySecret)) == 1
+}
+
+func describeCIDRs(cidrs []*net.IPNet) string {
+	var names []string
+	for _, cidr := range cidrs {
+		names = append(names, cidr.String())
+	}
+	return strings.Join(names, ", ")
+}
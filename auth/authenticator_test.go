@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+const testProxySecret = "proxy-secret"
+
+func mustCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func TestFromTrustedProxy(t *testing.T) {
+	tests := []struct {
+		name       string
+		cidrs      []string
+		remoteAddr string
+		want       bool
+	}{
+		{name: "no proxies trusts nobody", remoteAddr: "10.0.0.5:4321", want: false},
+		{name: "inside the range", cidrs: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:4321", want: true},
+		{name: "outside the range", cidrs: []string{"10.0.0.0/8"}, remoteAddr: "203.0.113.7:4321", want: false},
+		{name: "second range", cidrs: []string{"10.0.0.0/8", "192.168.0.0/16"}, remoteAddr: "192.168.4.4:80", want: true},
+		{name: "address without port", cidrs: []string{"10.0.0.0/8"}, remoteAddr: "10.9.9.9", want: true},
+		{name: "ipv6", cidrs: []string{"fd00::/8"}, remoteAddr: "[fd00::1]:443", want: true},
+		{name: "unparsable address", cidrs: []string{"0.0.0.0/0"}, remoteAddr: "proxy:443", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator := &Authenticator{config: Config{Enabled: true, TrustProxyHeaders: true, ProxyCIDRs: mustCIDRs(t, test.cidrs...)}}
+			if got := authenticator.fromTrustedProxy(test.remoteAddr); got != test.want {
+				t.Errorf("fromTrustedProxy(%q) = %v, want %v", test.remoteAddr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatorRejectsUnsafeConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{
+			name:    "proxy headers without proxy addresses",
+			config:  Config{Enabled: true, TrustProxyHeaders: true},
+			wantErr: true,
+		},
+		{
+			name:    "proxy headers without a proxy secret",
+			config:  Config{Enabled: true, TrustProxyHeaders: true, ProxyCIDRs: mustCIDRs(t, "10.0.0.0/8")},
+			wantErr: true,
+		},
+		{
+			name:    "default role above viewer",
+			config:  Config{Enabled: true, TrustProxyHeaders: true, ProxyCIDRs: mustCIDRs(t, "10.0.0.0/8"), ProxySecret: testProxySecret, Roles: RoleMapping{DefaultRole: ROLE_EVENT_MANAGER}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown default role",
+			config:  Config{Enabled: true, TrustProxyHeaders: true, ProxyCIDRs: mustCIDRs(t, "10.0.0.0/8"), ProxySecret: testProxySecret, Roles: RoleMapping{DefaultRole: "owner"}},
+			wantErr: true,
+		},
+		{
+			name:    "no authentication method",
+			config:  Config{Enabled: true},
+			wantErr: true,
+		},
+		{
+			name:   "viewer default behind a proxy",
+			config: Config{Enabled: true, TrustProxyHeaders: true, ProxyCIDRs: mustCIDRs(t, "10.0.0.0/8"), ProxySecret: testProxySecret, Roles: RoleMapping{DefaultRole: ROLE_VIEWER}},
+		},
+		{
+			name:   "disabled",
+			config: Config{Enabled: false},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewAuthenticator(test.config)
+			if (err != nil) != test.wantErr {
+				t.Errorf("NewAuthenticator() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticateProxyHeaders(t *testing.T) {
+	authenticator, err := NewAuthenticator(Config{
+		Enabled:           true,
+		TrustProxyHeaders: true,
+		ProxyCIDRs:        mustCIDRs(t, "10.0.0.0/8"),
+		ProxySecret:       testProxySecret,
+		Roles:             RoleMapping{Groups: map[string]string{"admins": ROLE_ADMIN}, Emails: map[string]string{}, DefaultRole: ROLE_VIEWER},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		wantRole   string
+		wantNil    bool
+	}{
+		{
+			name:       "oauth2-proxy headers from the proxy",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{PROXY_SECRET_HEADER: testProxySecret, "X-Auth-Request-Email": "ann@example.com", "X-Auth-Request-Groups": "staff, admins"},
+			wantRole:   ROLE_ADMIN,
+		},
+		{
+			name:       "signed in without groups gets the default role",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{PROXY_SECRET_HEADER: testProxySecret, "X-Auth-Request-User": "ann"},
+			wantRole:   ROLE_VIEWER,
+		},
+		{
+			name:       "oauth2-proxy headers from another pod in the range",
+			remoteAddr: "10.0.0.9:5000",
+			headers:    map[string]string{"X-Auth-Request-Email": "ann@example.com", "X-Auth-Request-Groups": "admins"},
+			wantNil:    true,
+		},
+		{
+			name:       "wrong proxy secret",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{PROXY_SECRET_HEADER: "guess", "X-Auth-Request-Email": "ann@example.com", "X-Auth-Request-Groups": "admins"},
+			wantNil:    true,
+		},
+		{
+			name:       "oauth2-proxy headers from a client",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{PROXY_SECRET_HEADER: testProxySecret, "X-Auth-Request-Email": "ann@example.com", "X-Auth-Request-Groups": "admins"},
+			wantNil:    true,
+		},
+		{
+			name:       "forwarded headers are not read",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{PROXY_SECRET_HEADER: testProxySecret, "X-Forwarded-Email": "ann@example.com", "X-Forwarded-Groups": "admins", "X-Forwarded-User": "ann"},
+			wantNil:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/api/sessions", nil)
+			request.RemoteAddr = test.remoteAddr
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+			principal, err := authenticator.Authenticate(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.wantNil {
+				if principal != nil {
+					t.Errorf("Authenticate() = %+v, want nil", principal)
+				}
+				return
+			}
+			if principal == nil || principal.Role != test.wantRole {
+				t.Errorf("Authenticate() = %+v, want role %s", principal, test.wantRole)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// keysMaxAge is how long fetched keys are used before they are fetched again.
+	keysMaxAge = time.Hour
+	// keysMinRefresh limits how often a token signed by an unknown key can trigger a fetch.
+	keysMinRefresh = time.Minute
+)
+
+// KeySet holds the public keys of a JSON Web Key Set and reloads them when they age or a token names a key it
+// does not know, which is how providers roll their signing keys.
+type KeySet struct {
+	mu       sync.Mutex
+	load     func() ([]byte, error)
+	keys     map[string]crypto.PublicKey
+	loadedAt time.Time
+}
+
+// NewKeySetFile reads the key set from a local JWKS file, for offline testing or air-gapped providers.
+func NewKeySetFile(path string) (*KeySet, error) {
+	keySet := &KeySet{load: func() ([]byte, error) { return os.ReadFile(path) }}
+	keySet.mu.Lock()
+	defer keySet.mu.Unlock()
+	if err := keySet.reload(); err != nil {
+		return nil, fmt.Errorf("unable to load JWKS file %s: %w", path, err)
+	}
+	return keySet, nil
+}
+
+// NewKeySetURL fetches the key set from url on first use.
+func NewKeySetURL(url string, client *http.Client) *KeySet {
+	return &KeySet{load: func() ([]byte, error) { return fetch(client, url) }}
+}
+
+// NewKeySetDiscovery finds the key set through the OpenID discovery document of issuer on first use.
+func NewKeySetDiscovery(issuer string, client *http.Client) *KeySet {
+	var jwksURI string
+	return &KeySet{load: func() ([]byte, error) {
+		if jwksURI == "" {
+			body, err := fetch(client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+			if err != nil {
+				return nil, err
+			}
+			var discovery struct {
+				Issuer  string `json:"issuer"`
+				JwksURI string `json:"jwks_uri"`
+			}
+			if err := json.Unmarshal(body, &discovery); err != nil {
+				return nil, fmt.Errorf("invalid discovery document: %w", err)
+			}
+			if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(issuer, "/") || discovery.JwksURI == "" {
+				return nil, fmt.Errorf("discovery document is for issuer %q", discovery.Issuer)
+			}
+			jwksURI = discovery.JwksURI
+		}
+		return fetch(client, jwksURI)
+	}}
+}
+
+// Key returns the key with id kid. A token without a kid may use the only key of a single-key set.
+func (k *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, found := k.lookup(kid)
+	age := time.Since(k.loadedAt)
+	if (found && age < keysMaxAge) || (!found && !k.loadedAt.IsZero() && age < keysMinRefresh) {
+		if !found {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return key, nil
+	}
+	if err := k.reload(); err != nil {
+		if found {
+			log.Printf("Unable to refresh signing keys, using the cached ones: %s", err)
+			return key, nil
+		}
+		return nil, fmt.Errorf("unable to load signing keys: %w", err)
+	}
+	if key, found = k.lookup(kid); !found {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (k *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// reload must be called with k.mu held. loadedAt advances even on failure so a failing provider is not
+// hammered.
+func (k *KeySet) reload() error {
+	k.loadedAt = time.Now()
+	data, err := k.load()
+	if err != nil {
+		return err
+	}
+	keys, err := parseKeySet(data)
+	if err != nil {
+		return err
+	}
+	k.keys = keys
+	return nil
+}
+
+func parseKeySet(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := decodeBigInt(jwk.N)
+			e, errE := decodeBigInt(jwk.E)
+			if errN != nil || errE != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+				return nil, fmt.Errorf("invalid RSA key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve, ok := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[jwk.Crv]
+			if !ok {
+				return nil, fmt.Errorf("unsupported curve %q for key %q", jwk.Crv, jwk.Kid)
+			}
+			x, errX := decodeBigInt(jwk.X)
+			y, errY := decodeBigInt(jwk.Y)
+			if errX != nil || errY != nil || !curve.IsOnCurve(x, y) {
+				return nil, fmt.Errorf("invalid EC key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no signing keys")
+	}
+	return keys, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func fetch(client *http.Client, url string) ([]byte, error) {
+	rsp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, rsp.Status)
+	}
+	return io.ReadAll(io.LimitReader(rsp.Body, 1<<20))
+}
@@ -0,0 +1,194 @@
+// Package auth authenticates admin API callers from OIDC ID tokens or the headers oauth2-proxy forwards, and
+// maps them to roles.
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, badly signed, expired or issued for someone else.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the claims of a verified token.
+type Claims map[string]interface{}
+
+// String returns the string claim name, or "" when it is missing or not a string.
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Strings returns the claim name as a list. A single string is a list of one.
+func (c Claims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	value, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := value.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// Verifier verifies signed JWTs against a KeySet. Tokens must be signed with RS*, PS* or ES*, come from Issuer
+// when one is set, name one of Audiences and be unexpired, allowing Leeway of clock skew.
+type Verifier struct {
+	Keys      *KeySet
+	Issuer    string
+	Audiences []string
+	Leeway    time.Duration
+}
+
+func (v Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %s", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %s", ErrInvalidToken, err)
+	}
+	key, err := v.Keys.Key(header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %s", ErrInvalidToken, err)
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+func (v Verifier) validate(claims Claims) error {
+	now := time.Now()
+	expiresAt, ok := claims.time("exp")
+	if !ok {
+		return errors.New("no expiry")
+	}
+	if now.After(expiresAt.Add(v.Leeway)) {
+		return errors.New("expired")
+	}
+	if notBefore, ok := claims.time("nbf"); ok && now.Add(v.Leeway).Before(notBefore) {
+		return errors.New("not valid yet")
+	}
+	if v.Issuer != "" && strings.TrimSuffix(claims.String("iss"), "/") != strings.TrimSuffix(v.Issuer, "/") {
+		return fmt.Errorf("issued by %q", claims.String("iss"))
+	}
+	for _, audience := range claims.Strings("aud") {
+		for _, expected := range v.Audiences {
+			if audience == expected {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("issued for %v", claims.Strings("aud"))
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// verifySignature checks signature over signed with key. The key type must match alg so an RSA key can never
+// be used to check an HMAC or ECDSA signature.
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	var hashID crypto.Hash
+	var newHash func() hash.Hash
+	switch alg[2:] {
+	case "256":
+		hashID, newHash = crypto.SHA256, sha256.New
+	case "384":
+		hashID, newHash = crypto.SHA384, sha512.New384
+	case "512":
+		hashID, newHash = crypto.SHA512, sha512.New
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := newHash()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s needs an RSA key", alg)
+		}
+		if alg[:2] == "PS" {
+			return rsa.VerifyPSS(rsaKey, hashID, digest, signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hashID, digest, signature)
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s needs an EC key", alg)
+		}
+		bits := ecKey.Curve.Params().BitSize
+		if curveBits := map[string]int{"256": 256, "384": 384, "512": 521}[alg[2:]]; bits != curveBits {
+			return fmt.Errorf("%s needs a P-%d key", alg, curveBits)
+		}
+		size := (bits + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("bad ECDSA signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("bad signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
@@ -0,0 +1,116 @@
+package auth
+
+import "strings"
+
+// Roles, from least to most privileged. Each role is allowed everything the roles before it are.
+const (
+	ROLE_VIEWER        string = "viewer"
+	ROLE_EVENT_MANAGER string = "event-manager"
+	ROLE_ADMIN         string = "admin"
+)
+
+var roleRanks = map[string]int{ROLE_VIEWER: 1, ROLE_EVENT_MANAGER: 2, ROLE_ADMIN: 3}
+
+// ValidRole reports whether role is one of the roles above.
+func ValidRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// Ways a principal was authenticated.
+const (
+	METHOD_OIDC     string = "oidc"
+	METHOD_PROXY    string = "proxy"
+	METHOD_DISABLED string = "disabled"
+	METHOD_API_KEY  string = "api-key"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Email   string   `json:"email,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Teams   []string `json:"teams,omitempty"`
+	Scopes  []string `json:"scopes,omitempty"`
+	Role    string   `json:"role"`
+	Method  string   `json:"method"`
+}
+
+// ID names the principal in CreatedBy, UpdatedBy and logs: the email when known, otherwise the subject.
+func (p Principal) ID() string {
+	if p.Email != "" {
+		return p.Email
+	}
+	return p.Subject
+}
+
+// HasRole reports whether the principal is allowed what role is allowed.
+func (p Principal) HasRole(role string) bool {
+	return roleRanks[p.Role] > 0 && roleRanks[p.Role] >= roleRanks[role]
+}
+
+// HasScope reports whether the principal is an API key scoped to scope.
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleMapping grants roles by group membership and by email. A principal gets the highest role it is granted,
+// or DefaultRole when it is granted none. An empty DefaultRole leaves such principals without access.
+type RoleMapping struct {
+	Groups      map[string]string
+	Emails      map[string]string
+	DefaultRole string
+}
+
+func (m RoleMapping) Role(email string, groups []string) string {
+	role := ""
+	grant := func(granted string) {
+		if roleRanks[granted] > roleRanks[role] {
+			role = granted
+		}
+	}
+	if email != "" {
+		grant(m.Emails[strings.ToLower(email)])
+	}
+	for _, group := range groups {
+		grant(m.Groups[group])
+	}
+	if role == "" {
+		return m.DefaultRole
+	}
+	return role
+}
+
+// TeamMapping finds the teams a principal belongs to: the values of Claim in its ID token, and its groups that
+// start with GroupPrefix, with the prefix removed. An empty GroupPrefix maps no groups.
+type TeamMapping struct {
+	Claim       string
+	GroupPrefix string
+}
+
+func (m TeamMapping) Teams(claimed []string, groups []string) []string {
+	var teams []string
+	seen := map[string]bool{}
+	add := func(team string) {
+		if team = strings.TrimSpace(team); team != "" && !seen[team] {
+			seen[team] = true
+			teams = append(teams, team)
+		}
+	}
+	for _, team := range claimed {
+		add(team)
+	}
+	if m.GroupPrefix != "" {
+		for _, group := range groups {
+			if strings.HasPrefix(group, m.GroupPrefix) {
+				add(strings.TrimPrefix(group, m.GroupPrefix))
+			}
+		}
+	}
+	return teams
+}
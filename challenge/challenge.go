@@ -0,0 +1,120 @@
+// Package challenge verifies the CAPTCHA tokens attendees send with their registration, so that registration
+// pages cannot be scripted.
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jefferyfry/eventengine/config"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissing is returned when the request carries no token.
+	ErrMissing = errors.New("challenge token missing")
+	// ErrFailed is returned for tokens the provider rejects.
+	ErrFailed = errors.New("challenge failed")
+)
+
+// Verifier checks challenge tokens. Implementations return ErrMissing or ErrFailed for bad tokens and other
+// errors when the token could not be checked.
+type Verifier interface {
+	Verify(ctx context.Context, token string, remoteIP string) error
+	// SiteKey is the public key the registration page needs to show the challenge.
+	SiteKey() string
+}
+
+// FromEnv returns the verifier selected by eventengine_register_challenge, or nil when challenges are off.
+func FromEnv() (Verifier, error) {
+	switch provider := config.GetString("eventengine_register_challenge", ""); provider {
+	case "", "off":
+		return nil, nil
+	case "stub":
+		log.Println("Registration challenges use the stub verifier. Do not use it in production.")
+		return Stub{Token: config.GetString("eventengine_register_challenge_stub_token", "pass")}, nil
+	case "siteverify":
+		verifier := SiteVerify{
+			URL:    config.GetString("eventengine_register_challenge_url", ""),
+			Secret: config.GetString("eventengine_register_challenge_secret", ""),
+			Key:    config.GetString("eventengine_register_challenge_site_key", ""),
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}
+		if verifier.URL == "" || verifier.Secret == "" {
+			return nil, errors.New("eventengine_register_challenge_url and eventengine_register_challenge_secret are required for siteverify challenges")
+		}
+		return verifier, nil
+	default:
+		return nil, fmt.Errorf("unknown eventengine_register_challenge %s. Expected off, stub or siteverify", provider)
+	}
+}
+
+// Stub accepts one fixed token, for local development and tests.
+type Stub struct {
+	Token string
+}
+
+func (s Stub) Verify(ctx context.Context, token string, remoteIP string) error {
+	if token == "" {
+		return ErrMissing
+	}
+	if token != s.Token {
+		return ErrFailed
+	}
+	return nil
+}
+
+func (s Stub) SiteKey() string {
+	return "stub"
+}
+
+// SiteVerify checks tokens with the siteverify API that reCAPTCHA, hCaptcha and Cloudflare Turnstile share.
+type SiteVerify struct {
+	URL    string
+	Secret string
+	Key    string
+	Client *http.Client
+}
+
+func (s SiteVerify) Verify(ctx context.Context, token string, remoteIP string) error {
+	if token == "" {
+		return ErrMissing
+	}
+	form := url.Values{"secret": {s.Secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rsp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", s.URL, rsp.Status)
+	}
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid siteverify response: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %v", ErrFailed, result.ErrorCodes)
+	}
+	return nil
+}
+
+func (s SiteVerify) SiteKey() string {
+	return s.Key
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetString returns the value of the environment variable key or def when it is unset or empty.
+func GetString(key string, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// GetInt returns the environment variable key parsed as an int or def when it is unset or invalid.
+func GetInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s: %s. Using default %d.", key, value, def)
+		return def
+	}
+	return i
+}
+
+// GetDuration returns the environment variable key parsed as a time.Duration (e.g. 10s, 5m) or def when
+// it is unset or invalid.
+func GetDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s: %s. Using default %s.", key, value, def)
+		return def
+	}
+	return d
+}
+
+// GetBool returns the environment variable key parsed as a bool or def when it is unset or invalid.
+func GetBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s: %s. Using default %t.", key, value, def)
+		return def
+	}
+	return b
+}
+
+// GetList returns the comma separated environment variable key as a trimmed list, skipping empty items.
+func GetList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
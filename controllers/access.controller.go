@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	// accessCodeAlphabet leaves out letters and digits that are easily confused, such as O and 0. Its 32
+	// characters divide 256, so every character is equally likely.
+	accessCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	accessCodeLength   = 12
+	// maxInviteUpload bounds the size of an uploaded invite list.
+	maxInviteUpload = 1 << 20
+	maxInvites      = 10000
+)
+
+type AccessController struct {
+	sessionService services.SessionService
+	accessService  services.AccessService
+}
+
+func NewAccessController(sessionService services.SessionService, accessService services.AccessService) AccessController {
+	return AccessController{sessionService, accessService}
+}
+
+// CreateAccessCodes generates a batch of one-time codes for the session.
+func (a AccessController) CreateAccessCodes(context *gin.Context) {
+	session, err := viewableSession(a.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	var req models.AccessCodesCreateReq
+	if err := context.ShouldBindJSON(&req); err != nil {
+		respondError(context, badRequest("Invalid request parameters.", err))
+		return
+	}
+
+	now := time.Now().UTC()
+	batch := now.Format("20060102T150405Z")
+	codes := make([]models.AccessCode, 0, req.Count)
+	seen := map[string]bool{}
+	for len(codes) < req.Count {
+		code, err := newAccessCode()
+		if err != nil {
+			respondError(context, err)
+			return
+		}
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		codes = append(codes, models.AccessCode{
+			Session:   session.Name,
+			Code:      code,
+			Batch:     batch,
+			CreatedBy: principalID(context),
+			CreatedAt: now,
+		})
+	}
+	if err := a.accessService.AddAccessCodes(codes); err != nil {
+		respondError(context, err)
+		return
+	}
+	log.Printf("Generated %d access codes in batch %s for session %s", len(codes), batch, session.Name)
+	context.JSON(http.StatusCreated, codes)
+}
+
+func (a AccessController) GetAccessCodes(context *gin.Context) {
+	session, codes, ok := a.accessCodes(context)
+	if !ok {
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"session": session.Name, "accessCodes": codes})
+}
+
+// ExportAccessCodes writes the session's codes as a CSV attachment to hand out or mail merge.
+func (a AccessController) ExportAccessCodes(context *gin.Context) {
+	session, codes, ok := a.accessCodes(context)
+	if !ok {
+		return
+	}
+
+	context.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-access-codes.csv"`, session.Name))
+	context.Header("Content-Type", "text/csv; charset=utf-8")
+	context.Status(http.StatusOK)
+	writer := csv.NewWriter(context.Writer)
+	writer.Write([]string{"code", "batch", "createdAt", "usedBy", "usedAt"})
+	for _, code := range codes {
+		usedAt := ""
+		if code.UsedAt != nil {
+			usedAt = code.UsedAt.UTC().Format(time.RFC3339)
+		}
+		writer.Write([]string{code.Code, code.Batch, code.CreatedAt.UTC().Format(time.RFC3339), csvCell(code.UsedBy), usedAt})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Error writing access codes of session %s: %s", session.Name, err)
+	}
+}
+
+// accessCodes returns the codes of the session, only those of the batch query parameter when it is set.
+func (a AccessController) accessCodes(context *gin.Context) (*models.Session, []models.AccessCode, bool) {
+	session, err := viewableSession(a.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return nil, nil, false
+	}
+	codes, err := a.accessService.GetAccessCodes(session.Name)
+	if err != nil {
+		respondError(context, err)
+		return nil, nil, false
+	}
+	if batch := context.Query("batch"); batch != "" {
+		filtered := []models.AccessCode{}
+		for _, code := range codes {
+			if code.Batch == batch {
+				filtered = append(filtered, code)
+			}
+		}
+		codes = filtered
+	}
+	return session, codes, true
+}
+
+// AddInvites adds emails to the session's invite list, from a JSON body or a CSV upload. A CSV with a header
+// row takes its email column, otherwise its first column.
+func (a AccessController) AddInvites(context *gin.Context) {
+	session, err := viewableSession(a.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	var emails []string
+	if context.ContentType() == "text/csv" {
+		emails, err = readInviteCSV(http.MaxBytesReader(context.Writer, context.Request.Body, maxInviteUpload))
+		if err != nil {
+			respondError(context, badRequest("Invalid CSV upload.", err))
+			return
+		}
+	} else {
+		var req models.InvitesAddReq
+		if err := context.ShouldBindJSON(&req); err != nil {
+			respondError(context, badRequest("Invalid request parameters.", err))
+			return
+		}
+		emails = req.Emails
+	}
+	if len(emails) == 0 || len(emails) > maxInvites {
+		respondError(context, fmt.Errorf("%w: upload between 1 and %d emails at a time", services.ErrInvalid, maxInvites))
+		return
+	}
+	for i, email := range emails {
+		email = strings.TrimSpace(email)
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			respondError(context, fmt.Errorf("%w: %q is not an email address", services.ErrInvalid, email))
+			return
+		}
+		emails[i] = email
+	}
+
+	added, err := a.accessService.AddInvites(session.Name, emails, principalID(context))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	invites, err := a.accessService.GetInvites(session.Name)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	log.Printf("Invited %d new emails to session %s", added, session.Name)
+	context.JSON(http.StatusOK, models.InvitesAdded{Added: added, Total: len(invites)})
+}
+
+func (a AccessController) GetInvites(context *gin.Context) {
+	session, err := viewableSession(a.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	invites, err := a.accessService.GetInvites(session.Name)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"session": session.Name, "invites": invites})
+}
+
+func (a AccessController) DeleteInvite(context *gin.Context) {
+	session, err := viewableSession(a.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	if err := a.accessService.DeleteInvite(session.Name, context.Param("email")); err != nil {
+		respondError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{"message": "Invite deleted."})
+}
+
+// checkRegistrationAccess enforces the session's access mode before any Lacework call. One-time codes are only
+// checked for presence here. Register redeems them as the first step of its saga, so a failed registration
+// gives the code back.
+func checkRegistrationAccess(accessService services.AccessService, session models.Session, email string, code string) error {
+	switch session.AccessModeState() {
+	case models.SESSION_ACCESS_CODE:
+		expected := []byte(models.NormalizeAccessCode(session.AccessCode))
+		if len(expected) == 0 || subtle.ConstantTimeCompare([]byte(models.NormalizeAccessCode(code)), expected) != 1 {
+			return fmt.Errorf("%w: for session %s", services.ErrAccessCodeInvalid, session.Name)
+		}
+	case models.SESSION_ACCESS_ONE_TIME_CODE:
+		if models.NormalizeAccessCode(code) == "" {
+			return fmt.Errorf("%w: missing for session %s", services.ErrAccessCodeInvalid, session.Name)
+		}
+	case models.SESSION_ACCESS_INVITE:
+		invited, err := accessService.IsInvited(session.Name, email)
+		if err != nil {
+			return err
+		}
+		if !invited {
+			return fmt.Errorf("%w: %s to session %s", services.ErrNotInvited, email, session.Name)
+		}
+	}
+	return nil
+}
+
+// newAccessCode returns a random one-time code in CanonicalAccessCode form.
+func newAccessCode() (string, error) {
+	random := make([]byte, accessCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("unable to generate access code: %w", err)
+	}
+	code := make([]byte, accessCodeLength)
+	for i, b := range random {
+		code[i] = accessCodeAlphabet[int(b)%len(accessCodeAlphabet)]
+	}
+	return models.CanonicalAccessCode(string(code)), nil
+}
+
+func readInviteCSV(body io.Reader) ([]string, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the file is empty")
+	}
+	column := 0
+	for i, cell := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(cell), "email") {
+			column = i
+			records = records[1:]
+			break
+		}
+	}
+	var emails []string
+	for _, record := range records {
+		if column < len(record) && strings.TrimSpace(record[column]) != "" {
+			emails = append(emails, record[column])
+		}
+	}
+	return emails, nil
+}
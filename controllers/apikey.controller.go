@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiKeyTouchInterval limits how often the last use of a busy key is written.
+const apiKeyTouchInterval = time.Minute
+
+type APIKeyController struct {
+	apiKeyService services.APIKeyService
+}
+
+func NewAPIKeyController(apiKeyService services.APIKeyService) APIKeyController {
+	return APIKeyController{apiKeyService}
+}
+
+// CreateAPIKey mints a key. The response is the only time the key is shown.
+func (a APIKeyController) CreateAPIKey(context *gin.Context) {
+	var req models.APIKeyCreateReq
+	if err := context.ShouldBindJSON(&req); err != nil {
+		respondError(context, badRequest("Invalid request parameters.", err))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondError(context, fmt.Errorf("%w: name cannot be blank", services.ErrInvalid))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			respondError(context, fmt.Errorf("%w: unknown scope %s. Expected %s, %s or %s", services.ErrInvalid, scope,
+				auth.SCOPE_SESSIONS_CREATE, auth.SCOPE_SESSIONS_READ, auth.SCOPE_REGISTER))
+			return
+		}
+	}
+	now := time.Now()
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil && req.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			respondError(context, fmt.Errorf("%w: expiresIn must be a positive duration such as 720h", services.ErrInvalid))
+			return
+		}
+		expires := now.Add(expiresIn)
+		expiresAt = &expires
+	}
+	if expiresAt != nil && !expiresAt.After(now) {
+		respondError(context, fmt.Errorf("%w: expiresAt must be in the future", services.ErrInvalid))
+		return
+	}
+
+	id, secret, err := auth.NewAPIKey()
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	key := models.APIKey{
+		ID:         id,
+		Name:       req.Name,
+		SecretHash: auth.HashAPIKeySecret(secret),
+		Scopes:     req.Scopes,
+		Team:       req.Team,
+		CreatedBy:  principalID(context),
+		CreatedAt:  now,
+		ExpiresAt:  expiresAt,
+	}
+	if err := a.apiKeyService.AddAPIKey(&key); err != nil {
+		respondError(context, err)
+		return
+	}
+	log.Printf("API key %s (%s) with scopes %v created by %s", key.ID, key.Name, key.Scopes, key.CreatedBy)
+	context.JSON(http.StatusCreated, models.APIKeyCreated{APIKey: key, Key: auth.FormatAPIKey(id, secret)})
+}
+
+func (a APIKeyController) GetAPIKeys(context *gin.Context) {
+	keys, err := a.apiKeyService.GetAPIKeys()
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, keys)
+}
+
+func (a APIKeyController) GetAPIKey(context *gin.Context) {
+	key, err := a.apiKeyService.GetAPIKey(context.Param("id"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, key)
+}
+
+func (a APIKeyController) RevokeAPIKey(context *gin.Context) {
+	key, err := a.apiKeyService.RevokeAPIKey(context.Param("id"), principalID(context))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	log.Printf("API key %s (%s) revoked by %s", key.ID, key.Name, key.RevokedBy)
+	context.JSON(http.StatusOK, key)
+}
+
+// authenticateAPIKey returns the principal of a usable key. Unknown keys and wrong secrets get the same error
+// so key ids cannot be probed.
+func authenticateAPIKey(apiKeyService services.APIKeyService, token string, ip string) (*auth.Principal, error) {
+	id, secret, ok := auth.ParseAPIKey(token)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed", auth.ErrInvalidAPIKey)
+	}
+	key, err := apiKeyService.GetAPIKey(id)
+	if errors.Is(err, services.ErrAPIKeyNotFound) || (err == nil && !auth.APIKeySecretMatches(key.SecretHash, secret)) {
+		return nil, fmt.Errorf("%w: unknown key", auth.ErrInvalidAPIKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: revoked", auth.ErrInvalidAPIKey)
+	}
+	if !key.Usable(now) {
+		return nil, fmt.Errorf("%w: expired", auth.ErrInvalidAPIKey)
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := apiKeyService.TouchAPIKey(key.ID, now, ip); err != nil {
+			log.Printf("Error recording use of API key %s: %s", key.ID, err)
+		}
+	}
+	principal := &auth.Principal{Subject: "apikey:" + key.ID, Name: key.Name, Scopes: key.Scopes, Method: auth.METHOD_API_KEY}
+	if key.Team != "" {
+		principal.Teams = []string{key.Team}
+	}
+	return principal, nil
+}
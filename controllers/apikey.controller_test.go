@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	apiKeyService := services.NewAPIKeyServiceMemory()
+	past, future, recent := time.Now().Add(-time.Hour), time.Now().Add(time.Hour), time.Now().Add(-time.Second)
+	// addKey stores a key and returns it in the form callers send it.
+	addKey := func(key models.APIKey) string {
+		id, secret, err := auth.NewAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		key.ID, key.Name, key.SecretHash, key.CreatedAt = id, "ctf", auth.HashAPIKeySecret(secret), time.Now()
+		if err := apiKeyService.AddAPIKey(&key); err != nil {
+			t.Fatal(err)
+		}
+		return auth.FormatAPIKey(id, secret)
+	}
+	valid := addKey(models.APIKey{Scopes: []string{auth.SCOPE_REGISTER}, Team: "emea", ExpiresAt: &future})
+	revoked := addKey(models.APIKey{Scopes: []string{auth.SCOPE_REGISTER}})
+	revokedID, _, _ := auth.ParseAPIKey(revoked)
+	if _, err := apiKeyService.RevokeAPIKey(revokedID, "admin@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	expired := addKey(models.APIKey{Scopes: []string{auth.SCOPE_REGISTER}, ExpiresAt: &past})
+	busy := addKey(models.APIKey{LastUsedAt: &recent, LastUsedIP: "192.0.2.1"})
+	validID, _, _ := auth.ParseAPIKey(valid)
+	_, otherSecret, _ := auth.NewAPIKey()
+
+	tests := []struct {
+		name      string
+		token     string
+		wantError string
+		wantIP    string
+	}{
+		{name: "valid", token: valid, wantIP: "203.0.113.7"},
+		{name: "recently used is not written again", token: busy, wantIP: "192.0.2.1"},
+		{name: "revoked", token: revoked, wantError: "revoked"},
+		{name: "expired", token: expired, wantError: "expired"},
+		{name: "wrong secret", token: auth.FormatAPIKey(validID, otherSecret), wantError: "unknown key"},
+		{name: "unknown id", token: auth.FormatAPIKey("missing", otherSecret), wantError: "unknown key"},
+		{name: "malformed", token: "not-a-key", wantError: "malformed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := authenticateAPIKey(apiKeyService, test.token, "203.0.113.7")
+			if test.wantError != "" {
+				if principal != nil || !errors.Is(err, auth.ErrInvalidAPIKey) || !strings.Contains(err.Error(), test.wantError) {
+					t.Errorf("authenticateAPIKey() = %+v, %v, want ErrInvalidAPIKey saying %s", principal, err, test.wantError)
+				}
+				return
+			}
+			if err != nil || principal.Method != auth.METHOD_API_KEY || !strings.HasPrefix(principal.Subject, "apikey:") {
+				t.Fatalf("authenticateAPIKey() = %+v, %v, want an API key principal", principal, err)
+			}
+			id, _, _ := auth.ParseAPIKey(test.token)
+			key, _ := apiKeyService.GetAPIKey(id)
+			if key.LastUsedIP != test.wantIP {
+				t.Errorf("lastUsedIP = %q, want %q", key.LastUsedIP, test.wantIP)
+			}
+		})
+	}
+
+	principal, _ := authenticateAPIKey(apiKeyService, valid, "203.0.113.7")
+	if principal.Subject != "apikey:"+validID || !principal.HasScope(auth.SCOPE_REGISTER) || len(principal.Teams) != 1 || principal.Teams[0] != "emea" {
+		t.Errorf("principal = %+v, want the key's id, scope and team", principal)
+	}
+}
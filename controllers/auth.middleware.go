@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/services"
+	"net/http"
+)
+
+const (
+	principalKey = "principal"
+	authErrorKey = "authError"
+)
+
+// Authenticate identifies the caller of every request from an API key or, failing that, authenticator. It never
+// rejects a request itself, so public routes work whatever the caller sends, and leaves it to RequireRole to
+// turn away callers without valid credentials.
+func Authenticate(authenticator *auth.Authenticator, apiKeyService services.APIKeyService) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		var principal *auth.Principal
+		var err error
+		if key := auth.APIKeyFromRequest(context.Request); key != "" {
+			principal, err = authenticateAPIKey(apiKeyService, key, context.ClientIP())
+		} else {
+			principal, err = authenticator.Authenticate(context.Request)
+		}
+		if err != nil {
+			context.Set(authErrorKey, err)
+			return
+		}
+		if principal != nil {
+			context.Set(principalKey, principal)
+		}
+	}
+}
+
+// RequireRole lets through callers that have role or a more privileged one.
+func RequireRole(role string) gin.HandlerFunc {
+	return RequireRoleOrScope(role, "")
+}
+
+// RequireRoleOrScope also lets through API keys scoped to scope.
+func RequireRoleOrScope(role string, scope string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if err, ok := context.Get(authErrorKey); ok {
+			context.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			respondError(context, APIError{http.StatusUnauthorized, "unauthenticated", "Invalid credentials.", err.(error)})
+			return
+		}
+		principal := currentPrincipal(context)
+		if principal == nil {
+			context.Header("WWW-Authenticate", "Bearer")
+			respondError(context, APIError{http.StatusUnauthorized, "unauthenticated", "Sign in to continue.", nil})
+			return
+		}
+		if principal.Method == auth.METHOD_API_KEY {
+			if scope == "" || !principal.HasScope(scope) {
+				respondError(context, forbidden(fmt.Sprintf("API key %s is not allowed to do this.", principal.Name)))
+			}
+			return
+		}
+		if !principal.HasRole(role) {
+			respondError(context, forbidden(fmt.Sprintf("%s needs the %s role.", principal.ID(), role)))
+			return
+		}
+	}
+}
+
+// RequireScopeForAPIKeys is for public routes. Other callers are let through, but API keys must be valid and
+// scoped to scope.
+func RequireScopeForAPIKeys(scope string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if err, ok := context.Get(authErrorKey); ok && errors.Is(err.(error), auth.ErrInvalidAPIKey) {
+			respondError(context, APIError{http.StatusUnauthorized, "unauthenticated", "Invalid credentials.", err.(error)})
+			return
+		}
+		if principal := currentPrincipal(context); principal != nil && principal.Method == auth.METHOD_API_KEY && !principal.HasScope(scope) {
+			respondError(context, forbidden(fmt.Sprintf("API key %s is not allowed to do this.", principal.Name)))
+		}
+	}
+}
+
+func currentPrincipal(context *gin.Context) *auth.Principal {
+	if value, ok := context.Get(principalKey); ok {
+		return value.(*auth.Principal)
+	}
+	return nil
+}
+
+// principalID names the caller for CreatedBy and UpdatedBy. It is empty when authentication is disabled.
+func principalID(context *gin.Context) string {
+	if principal := currentPrincipal(context); principal != nil {
+		return principal.ID()
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireRoleOrScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		authErr    error
+		role       string
+		scope      string
+		wantStatus int
+	}{
+		{name: "anonymous", role: auth.ROLE_VIEWER, wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", authErr: auth.ErrInvalidToken, role: auth.ROLE_VIEWER, wantStatus: http.StatusUnauthorized},
+		{name: "no role", principal: &auth.Principal{Subject: "ann"}, role: auth.ROLE_VIEWER, wantStatus: http.StatusForbidden},
+		{name: "viewer reading", principal: &auth.Principal{Subject: "ann", Role: auth.ROLE_VIEWER}, role: auth.ROLE_VIEWER, wantStatus: http.StatusNoContent},
+		{name: "viewer changing", principal: &auth.Principal{Subject: "ann", Role: auth.ROLE_VIEWER}, role: auth.ROLE_EVENT_MANAGER, wantStatus: http.StatusForbidden},
+		{name: "admin changing", principal: &auth.Principal{Subject: "ann", Role: auth.ROLE_ADMIN}, role: auth.ROLE_EVENT_MANAGER, wantStatus: http.StatusNoContent},
+		{name: "unknown role", principal: &auth.Principal{Subject: "ann", Role: "owner"}, role: auth.ROLE_VIEWER, wantStatus: http.StatusForbidden},
+		{
+			name:       "api key with the scope",
+			principal:  &auth.Principal{Name: "ctf", Method: auth.METHOD_API_KEY, Scopes: []string{auth.SCOPE_SESSIONS_CREATE}},
+			role:       auth.ROLE_EVENT_MANAGER,
+			scope:      auth.SCOPE_SESSIONS_CREATE,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "api key without the scope",
+			principal:  &auth.Principal{Name: "ctf", Method: auth.METHOD_API_KEY, Scopes: []string{auth.SCOPE_REGISTER}},
+			role:       auth.ROLE_EVENT_MANAGER,
+			scope:      auth.SCOPE_SESSIONS_CREATE,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "api key on a route without a scope",
+			principal:  &auth.Principal{Name: "ctf", Method: auth.METHOD_API_KEY, Role: auth.ROLE_ADMIN, Scopes: []string{auth.SCOPE_SESSIONS_CREATE}},
+			role:       auth.ROLE_VIEWER,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ErrorHandler(), func(context *gin.Context) {
+				if test.authErr != nil {
+					context.Set(authErrorKey, test.authErr)
+				}
+				if test.principal != nil {
+					context.Set(principalKey, test.principal)
+				}
+			})
+			router.GET("/", RequireRoleOrScope(test.role, test.scope), func(context *gin.Context) {
+				context.Status(http.StatusNoContent)
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			if recorder.Code == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestRequireScopeForAPIKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		authErr    error
+		wantStatus int
+	}{
+		{name: "anonymous attendee", wantStatus: http.StatusNoContent},
+		{name: "invalid token is ignored on public routes", authErr: errors.New("expired"), wantStatus: http.StatusNoContent},
+		{name: "invalid api key", authErr: auth.ErrInvalidAPIKey, wantStatus: http.StatusUnauthorized},
+		{name: "api key with the scope", principal: &auth.Principal{Name: "ctf", Method: auth.METHOD_API_KEY, Scopes: []string{auth.SCOPE_REGISTER}}, wantStatus: http.StatusNoContent},
+		{name: "api key without the scope", principal: &auth.Principal{Name: "ctf", Method: auth.METHOD_API_KEY}, wantStatus: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ErrorHandler(), func(context *gin.Context) {
+				if test.authErr != nil {
+					context.Set(authErrorKey, test.authErr)
+				}
+				if test.principal != nil {
+					context.Set(principalKey, test.principal)
+				}
+			})
+			router.POST("/", RequireScopeForAPIKeys(auth.SCOPE_REGISTER), func(context *gin.Context) {
+				context.Status(http.StatusNoContent)
+			})
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("POST", "/", nil))
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
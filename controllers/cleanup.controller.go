@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/config"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/leader"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"github.com/robfig/cron/v3"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CleanupConfig controls the scheduled cleanup of expired sessions.
+type CleanupConfig struct {
+	// Schedule is a cron spec such as @hourly or "0 */6 * * *". Empty or off disables scheduled runs.
+	Schedule string
+	// Grace is how long after ExpiresAt a session is kept before it is cleaned up.
+	Grace time.Duration
+	// DryRun makes scheduled runs only count what they would delete.
+	DryRun bool
+	// MaxAttempts is how many runs try to delete a session's users before it is left cleanup_failed. Zero
+	// retries forever.
+	MaxAttempts int
+	// Retention is how long a cleaned session is kept before it is removed.
+	Retention time.Duration
+}
+
+func CleanupConfigFromEnv() CleanupConfig {
+	return CleanupConfig{
+		Schedule:    config.GetString("eventengine_cleanup_schedule", "@hourly"),
+		Grace:       config.GetDuration("eventengine_cleanup_grace", 0),
+		DryRun:      config.GetBool("eventengine_cleanup_dry_run", false),
+		MaxAttempts: config.GetInt("eventengine_cleanup_max_attempts", 5),
+		Retention:   config.GetDuration("eventengine_cleanup_retention", 24*time.Hour),
+	}
+}
+
+type CleanupRunReq struct {
+	// DryRun overrides the configured dry-run mode for this run.
+	DryRun *bool `json:"dryRun"`
+}
+
+// cleanupRunLock is the lease held for the duration of a run so runs never overlap, on any replica.
+const cleanupRunLock = "cleanup-run"
+
+type CleanupController struct {
+	sessionCleaner
+	cleanupRunService services.CleanupRunService
+	config            CleanupConfig
+}
+
+func NewCleanupController(sessionService services.SessionService, registrationService services.RegistrationService, accessService services.AccessService, leaseService services.LeaseService, cleanupRunService services.CleanupRunService, laceworkClient lacework.Client, cleanupConfig CleanupConfig) CleanupController {
+	return CleanupController{
+		sessionCleaner:    sessionCleaner{sessionService, registrationService, accessService, leaseService, laceworkClient},
+		cleanupRunService: cleanupRunService,
+		config:            cleanupConfig,
+	}
+}
+
+// StartScheduler runs the cleanup on the configured schedule on the replica for which isLeader reports true.
+// A nil isLeader runs it on every replica.
+func (c CleanupController) StartScheduler(isLeader func() bool) error {
+	if c.config.Schedule == "" || c.config.Schedule == "off" {
+		log.Println("Scheduled cleanup is disabled.")
+		return nil
+	}
+	job := cron.New()
+	if _, err := job.AddFunc(c.config.Schedule, func() {
+		if isLeader != nil && !isLeader() {
+			return
+		}
+		if _, err := c.startRun(models.CLEANUP_TRIGGER_SCHEDULED, "", c.config.DryRun); err != nil {
+			log.Printf("Scheduled cleanup not started: %s", err)
+		}
+	}); err != nil {
+		return fmt.Errorf("invalid cleanup schedule %q: %w", c.config.Schedule, err)
+	}
+	log.Printf("Started cleanup job %s with grace %s (dry run %t).", c.config.Schedule, c.config.Grace, c.config.DryRun)
+	job.Start()
+	return nil
+}
+
+// TriggerCleanup starts a run on demand and returns it while it runs in the background.
+func (c CleanupController) TriggerCleanup(context *gin.Context) {
+	var req CleanupRunReq
+	if context.Request.ContentLength != 0 {
+		if err := context.ShouldBindJSON(&req); err != nil {
+			respondError(context, badRequest("Invalid request parameters.", err))
+			return
+		}
+	}
+	dryRun := c.config.DryRun
+	if req.DryRun != nil {
+		dryRun = *req.DryRun
+	}
+	run, err := c.startRun(models.CLEANUP_TRIGGER_MANUAL, principalID(context), dryRun)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	context.JSON(http.StatusAccepted, run)
+}
+
+func (c CleanupController) GetCleanupRuns(context *gin.Context) {
+	limit, err := strconv.Atoi(context.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		respondError(context, fmt.Errorf("%w: limit must be between 1 and 100", services.ErrInvalid))
+		return
+	}
+	runs, err := c.cleanupRunService.GetCleanupRuns(limit)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, runs)
+}
+
+// GetStuckCleanups lists the sessions whose cleanup failed at least once, with the users they still have.
+func (c CleanupController) GetStuckCleanups(context *gin.Context) {
+	sessions, err := c.sessionService.GetSessionsByLifecycle(models.SESSION_LIFECYCLE_CLEANUP_PENDING, models.SESSION_LIFECYCLE_CLEANUP_FAILED)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	scope := sessionScope(context)
+	stuck := []models.StuckCleanup{}
+	for _, session := range sessions {
+		if session.CleanupAttempts == 0 || !scope.CanView(session) {
+			//not tried yet
+			continue
+		}
+		registrations, err := c.registrationService.GetRegistrationsBySession(session.Name)
+		if err != nil {
+			respondError(context, err)
+			return
+		}
+		remaining := []string{}
+		for _, registration := range registrations {
+			if registration.UserGuid != "" && !registration.PreExisting &&
+				registration.Status != models.REGISTRATION_STATUS_DELETED && registration.Status != models.REGISTRATION_STATUS_FAILED {
+				remaining = append(remaining, registration.UserGuid)
+			}
+		}
+		stuck = append(stuck, models.StuckCleanup{
+			Session:          session.Name,
+			Lifecycle:        session.Lifecycle,
+			ExpiresAt:        session.ExpiresAt,
+			CleanupAttempts:  session.CleanupAttempts,
+			CleanupError:     session.CleanupError,
+			CleanupAttemptAt: session.CleanupAttemptAt,
+			RemainingUsers:   remaining,
+			LegacyUsers:      session.LegacyUsers,
+		})
+	}
+	context.JSON(http.StatusOK, stuck)
+}
+
+// RetryCleanup restarts the retries of a stuck session and tries to delete its users straight away. Sessions
+// that predate registration records need confirmLegacyMatch=true to have their users matched by company suffix.
+func (c CleanupController) RetryCleanup(context *gin.Context) {
+	session, err := c.sessionService.GetSessionByName(context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	if lifecycle := session.LifecycleState(); lifecycle != models.SESSION_LIFECYCLE_CLEANUP_PENDING && lifecycle != models.SESSION_LIFECYCLE_CLEANUP_FAILED {
+		respondError(context, fmt.Errorf("%w: session %s is %s, not waiting for cleanup", services.ErrConflict, session.Name, session.LifecycleState()))
+		return
+	}
+	session.CleanupAttempts = 0
+	if _, err := c.cleanupSession(session, c.config.MaxAttempts, context.Query("confirmLegacyMatch") == "true"); err != nil {
+		respondError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, models.NewSessionAdminView(*session))
+}
+
+// startRun records a new run and cleans up in the background. It returns ErrConflict while another run is in
+// progress on any replica.
+func (c CleanupController) startRun(trigger string, triggeredBy string, dryRun bool) (*models.CleanupRun, error) {
+	release, locked, err := leader.Lock(c.leaseService, cleanupRunLock, cleanupLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, fmt.Errorf("%w: a cleanup run is already in progress", services.ErrConflict)
+	}
+	run := &models.CleanupRun{
+		Trigger:     trigger,
+		TriggeredBy: triggeredBy,
+		DryRun:      dryRun,
+		Grace:       c.config.Grace.String(),
+		Status:      models.CLEANUP_STATUS_RUNNING,
+		StartedAt:   time.Now().UTC(),
+		Failures:    []models.CleanupFailure{},
+	}
+	if err := c.cleanupRunService.AddCleanupRun(run); err != nil {
+		release()
+		return nil, err
+	}
+	started := *run
+	go func() {
+		defer release()
+		c.clean(run)
+	}()
+	return &started, nil
+}
+
+// clean moves every session through its lifecycle and records the outcome in run. Sessions that expired more
+// than Grace ago, and sessions deleted by an admin whose users are not all gone, have their users deleted and
+// are kept until that succeeds or MaxAttempts runs have tried. Cleaned sessions are removed after Retention.
+func (c CleanupController) clean(run *models.CleanupRun) {
+	log.Printf("Cleanup run %s started (%s, dry run %t)", run.ID, run.Trigger, run.DryRun)
+	defer func() {
+		finishedAt := time.Now().UTC()
+		run.FinishedAt = &finishedAt
+		if err := c.cleanupRunService.UpdateCleanupRun(run); err != nil {
+			log.Printf("Error recording cleanup run %s: %s", run.ID, err)
+		}
+		log.Printf("Cleanup run %s %s: %d of %d sessions expired, %d cleaned, %d removed, %d users deleted, %d failures",
+			run.ID, run.Status, run.SessionsExpired, run.SessionsExamined, run.SessionsDeleted, run.SessionsPurged, run.UsersDeleted, len(run.Failures))
+	}()
+
+	sessions, err := c.sessionService.GetAllSessions()
+	if err != nil {
+		run.Status, run.Error = models.CLEANUP_STATUS_FAILED, fmt.Sprintf("Error retrieving sessions: %s", err)
+		return
+	}
+	now := time.Now().UTC()
+	cutoff := now.Add(-c.config.Grace)
+	for i := range sessions {
+		session := &sessions[i]
+		run.SessionsExamined++
+		switch session.LifecycleState() {
+		case models.SESSION_LIFECYCLE_CLEANUP_FAILED:
+			//left for an admin to retry
+			continue
+		case models.SESSION_LIFECYCLE_CLEANED:
+			if !run.DryRun && session.CleanedAt != nil && session.CleanedAt.Before(now.Add(-c.config.Retention)) {
+				if err := c.removeSession(session.Name); err != nil {
+					run.Failures = append(run.Failures, models.CleanupFailure{Session: session.Name, Error: err.Error()})
+					continue
+				}
+				run.SessionsPurged++
+			}
+			continue
+		case models.SESSION_LIFECYCLE_CLEANUP_PENDING:
+			//retried whether or not it has expired, since an admin may have deleted it early
+		default:
+			lifecycle := models.SESSION_LIFECYCLE_ACTIVE
+			if !session.ExpiresAt.After(now) {
+				lifecycle = models.SESSION_LIFECYCLE_EXPIRING
+			}
+			if session.ExpiresAt.Before(cutoff) {
+				run.SessionsExpired++
+			} else {
+				if !run.DryRun && session.LifecycleState() != lifecycle {
+					session.Lifecycle = lifecycle
+					if err := c.sessionService.UpdateSessionLifecycle(session); err != nil {
+						run.Failures = append(run.Failures, models.CleanupFailure{Session: session.Name, Error: err.Error()})
+					}
+				}
+				continue
+			}
+		}
+
+		if run.DryRun {
+			//dry runs show what a confirmed legacy match would delete
+			result, err := c.deleteTeamMemberUsersBySession(*session, true, true)
+			run.UsersDeleted += result.usersDeleted
+			if err != nil {
+				run.Failures = append(run.Failures, models.CleanupFailure{Session: session.Name, Error: err.Error()})
+			}
+			continue
+		}
+		result, err := c.cleanupSession(session, c.config.MaxAttempts, false)
+		run.UsersDeleted += result.usersDeleted
+		run.Failures = append(run.Failures, result.failures...)
+		if err != nil {
+			run.Failures = append(run.Failures, models.CleanupFailure{Session: session.Name, Error: err.Error()})
+			continue
+		}
+		run.SessionsDeleted++
+	}
+	run.Status = models.CLEANUP_STATUS_COMPLETED
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/services"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// APIError is an error with an explicit HTTP status and machine-readable code, for failures that do not
+// come from a services sentinel error.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e APIError) Error() string {
+	if e.Err != nil {
+		return e.Message + " " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e APIError) Unwrap() error {
+	return e.Err
+}
+
+func badRequest(message string, err error) APIError {
+	return APIError{http.StatusBadRequest, "invalid_request", message, err}
+}
+
+func forbidden(message string) APIError {
+	return APIError{http.StatusForbidden, "forbidden", message, nil}
+}
+
+func laceworkError(message string, err error) APIError {
+	return APIError{http.StatusBadGateway, "lacework_error", message, err}
+}
+
+// serviceErrors maps services sentinel errors to a status and code. An empty message uses the error text.
+var serviceErrors = []struct {
+	err     error
+	status  int
+	code    string
+	message string
+}{
+	{services.ErrSessionNotFound, http.StatusNotFound, "session_not_found", "Session not found."},
+	{services.ErrSessionExists, http.StatusConflict, "session_exists", "A session with that name already exists."},
+	{services.ErrVersionConflict, http.StatusPreconditionFailed, "version_conflict", "This session was changed by someone else. Reload it and try again."},
+	{services.ErrSessionFull, http.StatusConflict, "session_full", "Sorry, this event is full."},
+	{services.ErrSessionExpired, http.StatusGone, "session_expired", "Registration for this event is closed."},
+	{services.ErrRegistrationNotFound, http.StatusNotFound, "registration_not_found", "Registration not found."},
+	{services.ErrRegistrationExists, http.StatusConflict, "registration_exists", "You are already registered for this event."},
+	{services.ErrAPIKeyNotFound, http.StatusNotFound, "api_key_not_found", "API key not found."},
+	{services.ErrAccessCodeInvalid, http.StatusForbidden, "access_code_invalid", "This access code is not valid for this event."},
+	{services.ErrNotInvited, http.StatusForbidden, "not_invited", "This event is invite only and your email is not on the list."},
+	{services.ErrInviteNotFound, http.StatusNotFound, "invite_not_found", "Invite not found."},
+	{services.ErrConflict, http.StatusConflict, "conflict", ""},
+	{services.ErrInvalid, http.StatusUnprocessableEntity, "validation_failed", ""},
+}
+
+// ErrorHandler renders the last error a handler attached with respondError as a JSON envelope:
+// {"code": "session_not_found", "message": "Session not found.", "error": "session not found: demo"}.
+// Server and Lacework failures only get a generic message and a request id, so Mongo and Lacework details stay
+// in the log: {"code": "internal_error", "message": "Unexpected error.", "requestId": "9f86d081884c7d65"}.
+func ErrorHandler() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		context.Next()
+		if len(context.Errors) == 0 || context.Writer.Written() {
+			return
+		}
+		err := context.Errors.Last().Err
+		status, code, message := describeError(err)
+		if status >= http.StatusInternalServerError {
+			requestID := newRequestID()
+			log.Printf("%s %s failed (request %s): %s", context.Request.Method, context.Request.URL.Path, requestID, err)
+			context.Header("X-Request-Id", requestID)
+			context.JSON(status, gin.H{"code": code, "message": message, "requestId": requestID})
+			return
+		}
+		context.JSON(status, gin.H{"code": code, "message": message, "error": err.Error()})
+	}
+}
+
+// describeError returns the status, code and message that ErrorHandler renders err with.
+func describeError(err error) (int, string, string) {
+	var apiErr APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Status < http.StatusInternalServerError {
+			return apiErr.Status, apiErr.Code, apiErr.Error()
+		}
+		return apiErr.Status, apiErr.Code, apiErr.Message
+	}
+	for _, mapping := range serviceErrors {
+		if errors.Is(err, mapping.err) {
+			message := mapping.message
+			if message == "" {
+				message = capitalize(err.Error()) + "."
+			}
+			return mapping.status, mapping.code, message
+		}
+	}
+	return http.StatusInternalServerError, "internal_error", "Unexpected error."
+}
+
+// newRequestID returns a random id that ties an error response to its log line.
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// respondError hands err to ErrorHandler and stops the handler chain.
+func respondError(context *gin.Context, err error) {
+	context.Error(err)
+	context.Abort()
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/services"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+		detail      string
+	}{
+		{name: "sentinel", err: fmt.Errorf("%w: demo", services.ErrSessionNotFound), wantStatus: http.StatusNotFound, wantCode: "session_not_found", wantMessage: "Session not found."},
+		{name: "version conflict", err: services.ErrVersionConflict, wantStatus: http.StatusPreconditionFailed, wantCode: "version_conflict",
+			wantMessage: "This session was changed by someone else. Reload it and try again."},
+		{name: "sentinel using the error text", err: fmt.Errorf("%w: session demo is deleting", services.ErrConflict), wantStatus: http.StatusConflict, wantCode: "conflict",
+			wantMessage: "Conflict: session demo is deleting."},
+		{name: "client APIError", err: badRequest("Invalid payload parameters.", errors.New("missing name")), wantStatus: http.StatusBadRequest, wantCode: "invalid_request",
+			wantMessage: "Invalid payload parameters. missing name"},
+		{name: "lacework APIError", err: laceworkError("Error adding team member.", errors.New("dial tcp 10.1.2.3:443: refused")), wantStatus: http.StatusBadGateway,
+			wantCode: "lacework_error", wantMessage: "Error adding team member.", detail: "10.1.2.3"},
+		{name: "unmapped", err: errors.New("connection(mongo-0:27017) closed"), wantStatus: http.StatusInternalServerError, wantCode: "internal_error", wantMessage: "Unexpected error.", detail: "mongo-0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(ErrorHandler())
+			router.GET("/", func(context *gin.Context) { respondError(context, test.err) })
+
+			var logged bytes.Buffer
+			defer log.SetOutput(log.Writer())
+			log.SetOutput(&logged)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			body := envelope(recorder)
+			if recorder.Code != test.wantStatus || body["code"] != test.wantCode || body["message"] != test.wantMessage {
+				t.Fatalf("response = %d %v, want %d %s %q", recorder.Code, body, test.wantStatus, test.wantCode, test.wantMessage)
+			}
+			if test.wantStatus < http.StatusInternalServerError {
+				if body["error"] != test.err.Error() || body["requestId"] != nil {
+					t.Errorf("body = %v, want the error detail and no request id", body)
+				}
+				return
+			}
+			//server errors keep their detail in the log, tied to the response by the request id
+			requestID, _ := body["requestId"].(string)
+			if requestID == "" || recorder.Header().Get("X-Request-Id") != requestID {
+				t.Errorf("requestId = %q and X-Request-Id = %q, want the same id", requestID, recorder.Header().Get("X-Request-Id"))
+			}
+			if body["error"] != nil || strings.Contains(recorder.Body.String(), test.detail) {
+				t.Errorf("body = %s, which leaks the error detail", recorder.Body)
+			}
+			if !strings.Contains(logged.String(), requestID) || !strings.Contains(logged.String(), test.err.Error()) {
+				t.Errorf("logged %q, want the request id and error detail", logged.String())
+			}
+		})
+	}
+}
+
+func TestErrorHandlerKeepsWrittenResponses(t *testing.T) {
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.GET("/", func(context *gin.Context) {
+		context.JSON(http.StatusOK, gin.H{"message": "done"})
+		context.Error(errors.New("late failure"))
+	})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusOK || envelope(recorder)["message"] != "done" {
+		t.Errorf("response = %d %s, want the handler's response", recorder.Code, recorder.Body)
+	}
+}
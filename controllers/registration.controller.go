@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RegistrationController struct {
+	sessionService      services.SessionService
+	registrationService services.RegistrationService
+	laceworkClient      lacework.Client
+}
+
+func NewRegistrationController(sessionService services.SessionService, registrationService services.RegistrationService, laceworkClient lacework.Client) RegistrationController {
+	return RegistrationController{sessionService, registrationService, laceworkClient}
+}
+
+func (r RegistrationController) GetRegistrations(context *gin.Context) {
+	session, query, ok := r.bindRegistrationQuery(context)
+	if !ok {
+		return
+	}
+	query = query.Paged()
+	registrations, total, err := r.registrationService.FindRegistrations(session.Name, query)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, models.RegistrationPage{
+		Registrations: registrations,
+		Total:         total,
+		Page:          query.Page,
+		PageSize:      query.PageSize,
+	})
+}
+
+// ExportRegistrations writes every registration matching the query as a CSV attachment.
+func (r RegistrationController) ExportRegistrations(context *gin.Context) {
+	session, query, ok := r.bindRegistrationQuery(context)
+	if !ok {
+		return
+	}
+	query.Page, query.PageSize = 0, 0
+	registrations, _, err := r.registrationService.FindRegistrations(session.Name, query)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+
+	context.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-registrations.csv"`, session.Name))
+	context.Header("Content-Type", "text/csv; charset=utf-8")
+	context.Status(http.StatusOK)
+	writer := csv.NewWriter(context.Writer)
+	writer.Write([]string{"email", "firstName", "lastName", "company", "status", "userGuid", "preExisting", "createdAt"})
+	for _, registration := range registrations {
+		writer.Write([]string{
+			csvCell(registration.Email),
+			csvCell(registration.FirstName),
+			csvCell(registration.LastName),
+			csvCell(registration.Company),
+			registration.Status,
+			registration.UserGuid,
+			strconv.FormatBool(registration.PreExisting),
+			registration.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Error writing registrations of session %s: %s", session.Name, err)
+	}
+}
+
+// DeleteRegistration deletes the attendee's Lacework team user and frees their seat. A user that existed before
+// the registration is kept and only removed from the session's user group. The registration is kept with status
+// deleted.
+func (r RegistrationController) DeleteRegistration(context *gin.Context) {
+	session, err := viewableSession(r.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	registration, err := r.registrationService.GetRegistration(session.Name, context.Param("email"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	if registration.Status == models.REGISTRATION_STATUS_DELETED {
+		respondError(context, fmt.Errorf("%w: %s", services.ErrRegistrationNotFound, registration.Email))
+		return
+	}
+
+	if registration.UserGuid != "" {
+		instance := instanceForSession(*session)
+		accessToken, err := r.laceworkClient.CreateAccessToken(instance)
+		if err != nil {
+			respondError(context, laceworkError("Error creating access token.", err))
+			return
+		}
+		if registration.PreExisting {
+			//the account is kept, but not the access this session gave it
+			userGroup := registrationUserGroup(*registration, *session)
+			if _, err := r.laceworkClient.RemoveTeamUserFromUserGroup(instance, accessToken.Token, registration.UserGuid, userGroup); err != nil {
+				respondError(context, laceworkError(fmt.Sprintf("Error removing team member from group '%s'.", userGroup), err))
+				return
+			}
+			log.Printf("Keeping pre-existing user %s of session %s, removed from group %s", registration.UserGuid, session.Name, userGroup)
+		} else {
+			if _, err := r.laceworkClient.DeleteTeamMemberUser(instance, accessToken.Token, registration.UserGuid); err != nil {
+				respondError(context, laceworkError("Error deleting team member.", err))
+				return
+			}
+			log.Printf("Deleted user %s of session %s", registration.UserGuid, session.Name)
+		}
+	}
+
+	//failed and rolling back registrations already gave their seat back
+	holdsSeat := registration.Status == models.REGISTRATION_STATUS_PENDING || registration.Status == models.REGISTRATION_STATUS_REGISTERED
+	registration.Status = models.REGISTRATION_STATUS_DELETED
+	if err := r.registrationService.UpdateRegistration(registration); err != nil {
+		respondError(context, err)
+		return
+	}
+	if holdsSeat {
+		if err := r.sessionService.ReleaseSessionSeat(session.Name); err != nil {
+			respondError(context, err)
+			return
+		}
+	}
+	context.JSON(http.StatusOK, gin.H{"message": "Registration deleted."})
+}
+
+func (r RegistrationController) bindRegistrationQuery(context *gin.Context) (*models.Session, models.RegistrationQuery, bool) {
+	var query models.RegistrationQuery
+	session, err := viewableSession(r.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return nil, query, false
+	}
+	if err := context.ShouldBindQuery(&query); err != nil {
+		respondError(context, badRequest("Invalid query parameters.", err))
+		return nil, query, false
+	}
+	return session, query, true
+}
+
+// csvCell keeps attendee-supplied values from being evaluated as formulas when the export is opened in a
+// spreadsheet.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// routeRegistrations adds the registration admin routes to the fixture.
+func (f *sessionFixture) routeRegistrations() {
+	controller := NewRegistrationController(f.sessionService, f.registrationService, lacework.NewCachingClient(lacework.NewClient(f.fake.Config()), 0))
+	registrations := f.router.Group("/api/sessions/:name")
+	registrations.GET("/registrations", RequireRole(auth.ROLE_VIEWER), controller.GetRegistrations)
+	registrations.GET("/registrations.csv", RequireRole(auth.ROLE_VIEWER), controller.ExportRegistrations)
+	registrations.DELETE("/registrations/:email", RequireRole(auth.ROLE_EVENT_MANAGER), controller.DeleteRegistration)
+}
+
+func TestGetRegistrationsPaging(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.routeRegistrations()
+	f.addSession(t, models.Session{Name: "demo"})
+	for i := 0; i < 7; i++ {
+		status := models.REGISTRATION_STATUS_REGISTERED
+		if i == 0 {
+			status = models.REGISTRATION_STATUS_FAILED
+		}
+		f.registrationService.AddRegistration(&models.Registration{Session: "demo", Email: fmt.Sprintf("user%d@example.com", i),
+			FirstName: "User", Company: fmt.Sprintf("Company%d", i), Status: status})
+	}
+	f.registrationService.AddRegistration(&models.Registration{Session: "other", Email: "user0@example.com", Status: models.REGISTRATION_STATUS_REGISTERED})
+
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantCount    int
+		wantTotal    int64
+		wantPage     int
+		wantPageSize int
+	}{
+		{name: "defaults", query: "", wantStatus: http.StatusOK, wantCount: 7, wantTotal: 7, wantPage: 1, wantPageSize: models.REGISTRATION_PAGE_SIZE_DEFAULT},
+		{name: "first page", query: "?pageSize=3", wantStatus: http.StatusOK, wantCount: 3, wantTotal: 7, wantPage: 1, wantPageSize: 3},
+		{name: "last page", query: "?pageSize=3&page=3", wantStatus: http.StatusOK, wantCount: 1, wantTotal: 7, wantPage: 3, wantPageSize: 3},
+		{name: "past the last page", query: "?pageSize=3&page=4", wantStatus: http.StatusOK, wantCount: 0, wantTotal: 7, wantPage: 4, wantPageSize: 3},
+		{name: "search ignores case", query: "?q=COMPANY3", wantStatus: http.StatusOK, wantCount: 1, wantTotal: 1, wantPage: 1, wantPageSize: models.REGISTRATION_PAGE_SIZE_DEFAULT},
+		{name: "status", query: "?status=failed", wantStatus: http.StatusOK, wantCount: 1, wantTotal: 1, wantPage: 1, wantPageSize: models.REGISTRATION_PAGE_SIZE_DEFAULT},
+		{name: "unknown status", query: "?status=unknown", wantStatus: http.StatusBadRequest},
+		{name: "page size over the maximum", query: "?pageSize=501", wantStatus: http.StatusBadRequest},
+		{name: "negative page", query: "?page=-1", wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := f.do(http.MethodGet, "/api/sessions/demo/registrations"+test.query, nil)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+			var page models.RegistrationPage
+			if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Registrations) != test.wantCount || page.Total != test.wantTotal || page.Page != test.wantPage || page.PageSize != test.wantPageSize {
+				t.Errorf("page = %d registrations, total %d, page %d of size %d, want %d, %d, %d and %d", len(page.Registrations),
+					page.Total, page.Page, page.PageSize, test.wantCount, test.wantTotal, test.wantPage, test.wantPageSize)
+			}
+		})
+	}
+
+	//the pages together list every registration once
+	seen := map[string]bool{}
+	for page := 1; page <= 3; page++ {
+		var rsp models.RegistrationPage
+		json.Unmarshal(f.do(http.MethodGet, fmt.Sprintf("/api/sessions/demo/registrations?pageSize=3&page=%d", page), nil).Body.Bytes(), &rsp)
+		for _, registration := range rsp.Registrations {
+			if seen[registration.Email] || registration.Session != "demo" {
+				t.Errorf("page %d lists %s of session %s again", page, registration.Email, registration.Session)
+			}
+			seen[registration.Email] = true
+		}
+	}
+	if len(seen) != 7 {
+		t.Errorf("pages listed %d registrations, want 7", len(seen))
+	}
+}
+
+func TestExportRegistrations(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.routeRegistrations()
+	f.addSession(t, models.Session{Name: "demo"})
+	f.registrationService.AddRegistration(&models.Registration{Session: "demo", Email: "ann@example.com", FirstName: "=HYPERLINK(\"http://evil\")",
+		LastName: "+1", Company: "@SUM(A1)", Status: models.REGISTRATION_STATUS_REGISTERED, UserGuid: "GUID_1"})
+
+	recorder := f.do(http.MethodGet, "/api/sessions/demo/registrations.csv", nil)
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Header().Get("Content-Disposition"), `filename="demo-registrations.csv"`) {
+		t.Fatalf("response = %d %v", recorder.Code, recorder.Header())
+	}
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("rows = %v, want a header and one registration", rows)
+	}
+	want := []string{"ann@example.com", `'=HYPERLINK("http://evil")`, "'+1", "'@SUM(A1)", "registered", "GUID_1", "false"}
+	for i, cell := range want {
+		if rows[1][i] != cell {
+			t.Errorf("column %s = %q, want %q", rows[0][i], rows[1][i], cell)
+		}
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := map[string]string{
+		"":               "",
+		"Ann":            "Ann",
+		"=1+1":           "'=1+1",
+		"+1":             "'+1",
+		"-1":             "'-1",
+		"@SUM(A1)":       "'@SUM(A1)",
+		"\t=1":           "'\t=1",
+		"\r=1":           "'\r=1",
+		"Smith-Jones":    "Smith-Jones",
+		"ann@example.io": "ann@example.io",
+	}
+	for value, want := range tests {
+		if got := csvCell(value); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestDeleteRegistration(t *testing.T) {
+	tests := []struct {
+		name          string
+		preExisting   bool
+		failGroup     bool
+		wantStatus    int
+		wantUser      bool
+		wantInGroup   bool
+		wantRegStatus string
+		wantRegCount  int
+	}{
+		{name: "created user is deleted", wantStatus: http.StatusOK, wantRegStatus: models.REGISTRATION_STATUS_DELETED},
+		{name: "pre-existing user is only removed from the group", preExisting: true,
+			wantStatus: http.StatusOK, wantUser: true, wantRegStatus: models.REGISTRATION_STATUS_DELETED},
+		{name: "group removal failure keeps the registration", preExisting: true, failGroup: true,
+			wantStatus: http.StatusBadGateway, wantUser: true, wantInGroup: true, wantRegStatus: models.REGISTRATION_STATUS_REGISTERED, wantRegCount: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newSessionFixture(t, RegistrationGuardConfig{})
+			f.routeRegistrations()
+			f.addSession(t, models.Session{Name: "demo"})
+			if test.preExisting {
+				f.fake.AddTeamUser(lacework.TeamUsers{Email: "ann@example.com", Company: "Acme"})
+			}
+			f.principal = nil
+			if recorder := f.register("demo", "ann@example.com", ""); recorder.Code != http.StatusOK {
+				t.Fatalf("register: status = %d: %s", recorder.Code, recorder.Body)
+			}
+			if test.failGroup {
+				f.fake.FailNext(http.MethodPost, "/api/v2/UserGroups/", http.StatusInternalServerError, 1)
+			}
+
+			f.principal = testAdmin
+			recorder := f.do(http.MethodDelete, "/api/sessions/demo/registrations/ann@example.com", nil)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			if users := f.fake.TeamUsers(); (len(users) == 1) != test.wantUser {
+				t.Errorf("team users = %v, want user %v", users, test.wantUser)
+			}
+			if members := f.fake.UserGroupMembers(testUserGroup); (len(members) == 1) != test.wantInGroup {
+				t.Errorf("group members = %v, want member %v", members, test.wantInGroup)
+			}
+			registration, _ := f.registrationService.GetRegistration("demo", "ann@example.com")
+			if registration.Status != test.wantRegStatus || registration.PreExisting != test.preExisting {
+				t.Errorf("registration = %s, preExisting %v, want %s", registration.Status, registration.PreExisting, test.wantRegStatus)
+			}
+			session, _ := f.sessionService.GetSessionByName("demo")
+			if session.RegCount != test.wantRegCount {
+				t.Errorf("regCount = %d, want %d", session.RegCount, test.wantRegCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/challenge"
+	"github.com/jefferyfry/eventengine/config"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/ratelimit"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// disposableDomains are well-known throwaway email services. eventengine_register_disposable_domains_file adds
+// more, one per line.
+var disposableDomains = []string{
+	"10minutemail.com", "10minutemail.net", "burnermail.io", "discard.email", "dispostable.com",
+	"emailondeck.com", "emailfake.com", "fakeinbox.com", "getairmail.com", "getnada.com", "grr.la",
+	"guerrillamail.com", "guerrillamail.net", "guerrillamail.org", "guerrillamailblock.com", "inboxkitten.com",
+	"jetable.org", "mailcatch.com", "maildrop.cc", "mailinator.com", "mailnesia.com", "mailpoof.com",
+	"mintemail.com", "moakt.com", "mohmal.com", "mytemp.email", "nada.email", "sharklasers.com",
+	"spamgourmet.com", "temp-mail.io", "temp-mail.org", "tempmail.com", "tempmail.net", "tempmailo.com",
+	"tempr.email", "throwawaymail.com", "trash-mail.com", "trashmail.com", "trashmail.de", "yopmail.com",
+	"yopmail.fr", "yopmail.net",
+}
+
+// RegistrationGuardConfig protects the public registration endpoint. Limits are registrations a minute,
+// allowing bursts of the burst size. A limit of 0 turns it off. The defaults let a room full of attendees
+// behind one conference NAT register within a minute.
+type RegistrationGuardConfig struct {
+	IPLimit           int
+	IPBurst           int
+	SessionLimit      int
+	SessionBurst      int
+	BlockDisposable   bool
+	DisposableDomains []string
+	Challenge         challenge.Verifier
+}
+
+func RegistrationGuardConfigFromEnv() (RegistrationGuardConfig, error) {
+	guardConfig := RegistrationGuardConfig{
+		IPLimit:         config.GetInt("eventengine_register_ip_limit", 60),
+		IPBurst:         config.GetInt("eventengine_register_ip_burst", 60),
+		SessionLimit:    config.GetInt("eventengine_register_session_limit", 300),
+		SessionBurst:    config.GetInt("eventengine_register_session_burst", 300),
+		BlockDisposable: config.GetBool("eventengine_register_block_disposable", true),
+	}
+	if path := config.GetString("eventengine_register_disposable_domains_file", ""); path != "" {
+		domains, err := readDomains(path)
+		if err != nil {
+			return guardConfig, fmt.Errorf("unable to read eventengine_register_disposable_domains_file %s: %w", path, err)
+		}
+		guardConfig.DisposableDomains = domains
+	}
+	verifier, err := challenge.FromEnv()
+	if err != nil {
+		return guardConfig, err
+	}
+	guardConfig.Challenge = verifier
+	return guardConfig, nil
+}
+
+// readDomains reads one domain per line, skipping blank lines and # comments.
+func readDomains(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var domains []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			domains = append(domains, line)
+		}
+	}
+	return domains, scanner.Err()
+}
+
+// RegistrationGuard turns away registrations that look like abuse before any Lacework user is created.
+type RegistrationGuard struct {
+	config         RegistrationGuardConfig
+	ipBuckets      *ratelimit.Buckets
+	sessionBuckets *ratelimit.Buckets
+	disposable     map[string]bool
+}
+
+func NewRegistrationGuard(guardConfig RegistrationGuardConfig) *RegistrationGuard {
+	guard := &RegistrationGuard{
+		config:         guardConfig,
+		ipBuckets:      ratelimit.NewBuckets(float64(guardConfig.IPLimit)/60, guardConfig.IPBurst),
+		sessionBuckets: ratelimit.NewBuckets(float64(guardConfig.SessionLimit)/60, guardConfig.SessionBurst),
+		disposable:     map[string]bool{},
+	}
+	if guardConfig.BlockDisposable {
+		for _, domain := range models.NormalizeEmailDomains(append(disposableDomains, guardConfig.DisposableDomains...)) {
+			guard.disposable[domain] = true
+		}
+	}
+	log.Printf("Registrations are limited to %d a minute per client and %d a minute per session.", guardConfig.IPLimit, guardConfig.SessionLimit)
+	return guard
+}
+
+// AllowClient takes a token from the bucket of the client's address.
+func (g *RegistrationGuard) AllowClient(context *gin.Context) error {
+	return g.allow(context, g.ipBuckets, context.ClientIP(), g.config.IPLimit)
+}
+
+// AllowSession takes a token from the bucket of the session, which limits how fast a leaked event URL can fill
+// the customer's tenant with users. Register only charges it for registrations that passed every other check,
+// so bots failing the challenge cannot use up an event's budget.
+func (g *RegistrationGuard) AllowSession(context *gin.Context, sessionName string) error {
+	return g.allow(context, g.sessionBuckets, sessionName, g.config.SessionLimit)
+}
+
+func (g *RegistrationGuard) allow(context *gin.Context, buckets *ratelimit.Buckets, key string, limit int) error {
+	if buckets.Allow(key) {
+		return nil
+	}
+	//a token is back at most this long after the bucket ran dry
+	context.Header("Retry-After", strconv.Itoa(int(math.Ceil(60/float64(limit)))))
+	return APIError{http.StatusTooManyRequests, "rate_limited", "Too many registrations. Please try again in a minute.", nil}
+}
+
+// CheckEmail applies the session's domain lists and the disposable domain list.
+func (g *RegistrationGuard) CheckEmail(session models.Session, email string) error {
+	domain := models.EmailDomain(email)
+	if !session.EmailDomainAllowed(email) {
+		return APIError{http.StatusForbidden, "email_not_allowed", fmt.Sprintf("Registration with %s addresses is not allowed for this event.", domain), nil}
+	}
+	for d := domain; d != ""; {
+		if g.disposable[d] {
+			return APIError{http.StatusForbidden, "email_not_allowed", "Please register with your work email address.", nil}
+		}
+		_, parent, found := strings.Cut(d, ".")
+		if !found {
+			break
+		}
+		d = parent
+	}
+	return nil
+}
+
+// VerifyChallenge checks the challenge token when challenges are on.
+func (g *RegistrationGuard) VerifyChallenge(context *gin.Context, token string) error {
+	if g.config.Challenge == nil {
+		return nil
+	}
+	err := g.config.Challenge.Verify(context.Request.Context(), token, context.ClientIP())
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, challenge.ErrMissing):
+		return APIError{http.StatusBadRequest, "challenge_required", "Please complete the verification.", err}
+	case errors.Is(err, challenge.ErrFailed):
+		return APIError{http.StatusForbidden, "challenge_failed", "Verification failed. Please try again.", err}
+	default:
+		return APIError{http.StatusServiceUnavailable, "challenge_unavailable", "Verification is unavailable. Please try again later.", err}
+	}
+}
+
+// ChallengeSiteKey is shown on the event page so it can render the challenge. It is empty when challenges are
+// off.
+func (g *RegistrationGuard) ChallengeSiteKey() string {
+	if g.config.Challenge == nil {
+		return ""
+	}
+	return g.config.Challenge.SiteKey()
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/challenge"
+	"github.com/jefferyfry/eventengine/models"
+	"net/http"
+	"testing"
+)
+
+func TestRegisterGuardOrdering(t *testing.T) {
+	type attempt struct {
+		session    string
+		email      string
+		token      string
+		wantStatus int
+		wantCode   string
+	}
+	stub := challenge.Stub{Token: "pass"}
+	tests := []struct {
+		name      string
+		config    RegistrationGuardConfig
+		principal *auth.Principal
+		attempts  []attempt
+	}{
+		{
+			name:   "failed challenges do not use up the session budget",
+			config: RegistrationGuardConfig{SessionLimit: 1, SessionBurst: 1, Challenge: stub},
+			attempts: []attempt{
+				{email: "bot1@example.com", token: "wrong", wantStatus: http.StatusForbidden, wantCode: "challenge_failed"},
+				{email: "bot2@example.com", wantStatus: http.StatusBadRequest, wantCode: "challenge_required"},
+				{email: "ann@example.com", token: "pass", wantStatus: http.StatusOK},
+				{email: "bob@example.com", token: "pass", wantStatus: http.StatusTooManyRequests, wantCode: "rate_limited"},
+			},
+		},
+		{
+			name:   "refused emails do not use up the session budget",
+			config: RegistrationGuardConfig{SessionLimit: 1, SessionBurst: 1, BlockDisposable: true},
+			attempts: []attempt{
+				{email: "bot1@mailinator.com", wantStatus: http.StatusForbidden, wantCode: "email_not_allowed"},
+				{email: "bot2@mx.yopmail.com", wantStatus: http.StatusForbidden, wantCode: "email_not_allowed"},
+				{email: "ann@example.com", wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name:   "emails are checked before the challenge",
+			config: RegistrationGuardConfig{BlockDisposable: true, Challenge: stub},
+			attempts: []attempt{
+				{email: "bot@mailinator.com", token: "wrong", wantStatus: http.StatusForbidden, wantCode: "email_not_allowed"},
+			},
+		},
+		{
+			name:   "the client limit comes before everything else",
+			config: RegistrationGuardConfig{IPLimit: 1, IPBurst: 1, Challenge: stub},
+			attempts: []attempt{
+				{session: "missing", email: "ann@example.com", token: "pass", wantStatus: http.StatusNotFound, wantCode: "session_not_found"},
+				{session: "missing", email: "ann@example.com", token: "pass", wantStatus: http.StatusTooManyRequests, wantCode: "rate_limited"},
+				{email: "ann@example.com", token: "pass", wantStatus: http.StatusTooManyRequests, wantCode: "rate_limited"},
+			},
+		},
+		{
+			name:      "api keys skip the limits and the challenge but not the email rules",
+			config:    RegistrationGuardConfig{IPLimit: 1, IPBurst: 1, SessionLimit: 1, SessionBurst: 1, BlockDisposable: true, Challenge: stub},
+			principal: &auth.Principal{Name: "ctf", Method: auth.METHOD_API_KEY, Scopes: []string{auth.SCOPE_REGISTER}},
+			attempts: []attempt{
+				{email: "ann@example.com", wantStatus: http.StatusOK},
+				{email: "bob@example.com", wantStatus: http.StatusOK},
+				{email: "bot@mailinator.com", wantStatus: http.StatusForbidden, wantCode: "email_not_allowed"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newSessionFixture(t, test.config)
+			f.principal = test.principal
+			f.addSession(t, models.Session{Name: "demo"})
+			for i, attempt := range test.attempts {
+				session := attempt.session
+				if session == "" {
+					session = "demo"
+				}
+				recorder := f.register(session, attempt.email, attempt.token)
+				body := envelope(recorder)
+				label := fmt.Sprintf("attempt %d (%s)", i+1, attempt.email)
+				if recorder.Code != attempt.wantStatus {
+					t.Fatalf("%s: status = %d, want %d: %v", label, recorder.Code, attempt.wantStatus, body)
+				}
+				if attempt.wantCode != "" && body["code"] != attempt.wantCode {
+					t.Errorf("%s: code = %v, want %s", label, body["code"], attempt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestPublicSessionChallengeSiteKey(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config RegistrationGuardConfig
+		want   interface{}
+	}{
+		{name: "challenges off", want: nil},
+		{name: "stub", config: RegistrationGuardConfig{Challenge: challenge.Stub{Token: "pass"}}, want: "stub"},
+		{name: "siteverify", config: RegistrationGuardConfig{Challenge: challenge.SiteVerify{Key: "site-key"}}, want: "site-key"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := newSessionFixture(t, test.config)
+			f.addSession(t, models.Session{Name: "demo"})
+			f.principal = nil
+			recorder := f.do(http.MethodGet, "/api/register/demo", nil)
+			if body := envelope(recorder); recorder.Code != http.StatusOK || body["challengeSiteKey"] != test.want {
+				t.Errorf("GET = %d %v, want challengeSiteKey %v", recorder.Code, body, test.want)
+			}
+		})
+	}
+}
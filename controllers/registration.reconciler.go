@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"github.com/robfig/cron/v3"
+	"log"
+	"time"
+)
+
+// RegistrationReconciler finishes registrations that Register left incomplete, for example when the process
+// stopped between creating the Lacework user and adding it to its group. Pending registrations are completed,
+// or rolled back after maxAttempts, and rolling back registrations have their Lacework user deleted. A
+// registration is only reconciled under its registration lock, which Register holds until it finishes.
+type RegistrationReconciler struct {
+	sessionService      services.SessionService
+	registrationService services.RegistrationService
+	leaseService        services.LeaseService
+	laceworkClient      lacework.Client
+	// grace skips registrations updated so recently that they are not worth taking the lock for.
+	grace       time.Duration
+	maxAttempts int
+}
+
+func NewRegistrationReconciler(sessionService services.SessionService, registrationService services.RegistrationService, leaseService services.LeaseService, laceworkClient lacework.Client, grace time.Duration, maxAttempts int) RegistrationReconciler {
+	return RegistrationReconciler{sessionService, registrationService, leaseService, laceworkClient, grace, maxAttempts}
+}
+
+// Start runs Reconcile every interval on the replica for which isLeader reports true. A nil isLeader runs it on
+// every replica.
+func (r RegistrationReconciler) Start(interval time.Duration, isLeader func() bool) {
+	job := cron.New()
+	job.AddFunc(fmt.Sprintf("@every %s", interval), func() {
+		if isLeader == nil || isLeader() {
+			r.Reconcile()
+		}
+	})
+	log.Printf("Started registration reconciler every %s.", interval)
+	job.Start()
+}
+
+func (r RegistrationReconciler) Reconcile() {
+	registrations, err := r.registrationService.GetStaleRegistrations(
+		[]string{models.REGISTRATION_STATUS_PENDING, models.REGISTRATION_STATUS_ROLLING_BACK}, time.Now().Add(-r.grace))
+	if err != nil {
+		log.Printf("Error retrieving incomplete registrations: %s", err)
+		return
+	}
+	for _, registration := range registrations {
+		if err := r.reconcileLocked(registration); err != nil {
+			log.Printf("Error reconciling registration of %s: %s", registrationRef(&registration), err)
+		}
+	}
+}
+
+// reconcileLocked reconciles a registration under its registration lock. A registration whose lock is held is
+// still being worked on by Register and is left for a later run. The registration is read again once locked,
+// since the request holding the lock may have completed it.
+func (r RegistrationReconciler) reconcileLocked(stale models.Registration) error {
+	release, locked, err := lockRegistration(r.leaseService, stale.Session, stale.Email)
+	if err != nil || !locked {
+		return err
+	}
+	defer release()
+	registration, err := r.registrationService.GetRegistration(stale.Session, stale.Email)
+	if err != nil {
+		return err
+	}
+	if registration.Status != models.REGISTRATION_STATUS_PENDING && registration.Status != models.REGISTRATION_STATUS_ROLLING_BACK {
+		return nil
+	}
+	return r.reconcile(registration)
+}
+
+func (r RegistrationReconciler) reconcile(registration *models.Registration) error {
+	session, err := r.sessionService.GetSessionByName(registration.Session)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		return r.reconcileOrphan(registration)
+	}
+	if err != nil {
+		return err
+	}
+
+	registration.Attempts++
+	instance := instanceForSession(*session)
+	accessToken, err := r.laceworkClient.CreateAccessToken(instance)
+	if err != nil {
+		return r.retryLater(registration, err)
+	}
+
+	if registration.Status == models.REGISTRATION_STATUS_ROLLING_BACK {
+		if err := rollbackTeamUser(r.laceworkClient, instance, accessToken.Token, registration); err != nil {
+			return r.retryLater(registration, err)
+		}
+		return r.registrationService.UpdateRegistration(registration)
+	}
+
+	if registration.UserGuid == "" {
+		//the user may have been created before the process stopped
+		usr, _, err := r.laceworkClient.GetTeamUserByEmail(instance, accessToken.Token, registration.Email)
+		if errors.Is(err, lacework.ErrUserNotFound) {
+			registration.Error = "Lacework user was never created."
+			return r.fail(registration)
+		}
+		if err != nil {
+			return r.retryLater(registration, err)
+		}
+		//without the guid on record there is no telling whether this registration created the user, and
+		//keeping a user is safer than deleting someone else's
+		registration.UserGuid = usr.UserGuid
+		registration.PreExisting = true
+	}
+
+	if _, err := addTeamUserToUserGroup(r.laceworkClient, instance, accessToken.Token, registration.UserGuid, registration.UserGroup, 1); err != nil {
+		if registration.Attempts < r.maxAttempts {
+			return r.retryLater(registration, err)
+		}
+		registration.Error = fmt.Sprintf("Gave up adding user to group %s after %d attempts: %s", registration.UserGroup, registration.Attempts, err)
+		if err := rollbackTeamUser(r.laceworkClient, instance, accessToken.Token, registration); err != nil {
+			log.Printf("Unable to roll back user %s: %s", registration.UserGuid, err)
+		}
+		return r.fail(registration)
+	}
+	log.Printf("Completed registration of %s for session %s", registration.UserGuid, registration.Session)
+	registration.Status = models.REGISTRATION_STATUS_REGISTERED
+	registration.Error = ""
+	return r.registrationService.UpdateRegistration(registration)
+}
+
+// reconcileOrphan finishes a registration whose session was deleted before the registration completed. A user
+// that the registration created is deleted from the instance recorded on the registration. The credentials of
+// a custom instance went with the session, so such a registration stays rolling back and is reported on every
+// run until the user is deleted by hand.
+func (r RegistrationReconciler) reconcileOrphan(registration *models.Registration) error {
+	if registration.UserGuid == "" || registration.PreExisting {
+		//nothing this registration created is left behind
+		registration.Status = models.REGISTRATION_STATUS_FAILED
+		return r.registrationService.UpdateRegistration(registration)
+	}
+
+	registration.Status = models.REGISTRATION_STATUS_ROLLING_BACK
+	registration.Attempts++
+	if registration.InstanceType != INSTANCE_TYPE_DEFAULT {
+		return r.retryLater(registration, fmt.Errorf("session %s was deleted and its Lacework credentials with it, delete user %s from %s by hand",
+			registration.Session, registration.UserGuid, registration.LwUrl))
+	}
+	instance := instanceForSession(models.Session{InstanceType: INSTANCE_TYPE_DEFAULT})
+	accessToken, err := r.laceworkClient.CreateAccessToken(instance)
+	if err != nil {
+		return r.retryLater(registration, err)
+	}
+	if err := rollbackTeamUser(r.laceworkClient, instance, accessToken.Token, registration); err != nil {
+		return r.retryLater(registration, err)
+	}
+	return r.registrationService.UpdateRegistration(registration)
+}
+
+// fail records a pending registration as failed, or rolling back, and frees its seat.
+func (r RegistrationReconciler) fail(registration *models.Registration) error {
+	if registration.Status == models.REGISTRATION_STATUS_PENDING {
+		registration.Status = models.REGISTRATION_STATUS_FAILED
+	}
+	if err := r.registrationService.UpdateRegistration(registration); err != nil {
+		return err
+	}
+	return r.sessionService.ReleaseSessionSeat(registration.Session)
+}
+
+func (r RegistrationReconciler) retryLater(registration *models.Registration, cause error) error {
+	registration.Error = cause.Error()
+	if err := r.registrationService.UpdateRegistration(registration); err != nil {
+		return err
+	}
+	return cause
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/lacework/laceworktest"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"strings"
+	"testing"
+)
+
+func TestReconcileRegistrationOfDeletedSession(t *testing.T) {
+	tests := []struct {
+		name         string
+		instanceType string
+		preExisting  bool
+		noUser       bool
+		wantStatus   string
+		wantUser     bool
+		wantError    string
+	}{
+		{name: "user created on the default instance", instanceType: INSTANCE_TYPE_DEFAULT, wantStatus: models.REGISTRATION_STATUS_FAILED},
+		{name: "user created on a custom instance", instanceType: INSTANCE_TYPE_CUSTOM, wantStatus: models.REGISTRATION_STATUS_ROLLING_BACK, wantUser: true, wantError: "by hand"},
+		{name: "pre-existing user", instanceType: INSTANCE_TYPE_DEFAULT, preExisting: true, wantStatus: models.REGISTRATION_STATUS_FAILED, wantUser: true},
+		{name: "no user recorded", instanceType: INSTANCE_TYPE_CUSTOM, noUser: true, wantStatus: models.REGISTRATION_STATUS_FAILED, wantUser: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := laceworktest.NewServer()
+			defer fake.Close()
+			url, keyID, secret := defaultLwUrl, defaultLwAccessKeyID, defaultLwSecretKey
+			defaultLwUrl, defaultLwAccessKeyID, defaultLwSecretKey = "default.lacework.net", "KEY", "SECRET"
+			defer func() { defaultLwUrl, defaultLwAccessKeyID, defaultLwSecretKey = url, keyID, secret }()
+
+			registrationService := services.NewRegistrationServiceMemory()
+			usr := fake.AddTeamUser(lacework.TeamUsers{Email: "ann@example.com", Company: "Acme-demo"})
+			registration := &models.Registration{
+				Session:      "demo",
+				Email:        "ann@example.com",
+				UserGuid:     usr.UserGuid,
+				PreExisting:  test.preExisting,
+				Status:       models.REGISTRATION_STATUS_PENDING,
+				InstanceType: test.instanceType,
+				LwUrl:        "demo.lacework.net",
+			}
+			if test.noUser {
+				registration.UserGuid = ""
+			}
+			if _, err := registrationService.AddRegistration(registration); err != nil {
+				t.Fatal(err)
+			}
+
+			//the session is gone, so the reconciler only has what the registration recorded
+			reconciler := NewRegistrationReconciler(services.NewSessionServiceMemory(), registrationService, services.NewLeaseServiceMemory(),
+				lacework.NewCachingClient(lacework.NewClient(fake.Config()), 0), 0, 3)
+			reconciler.Reconcile()
+
+			stored, err := registrationService.GetRegistration("demo", "ann@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != test.wantStatus {
+				t.Errorf("status = %s, want %s", stored.Status, test.wantStatus)
+			}
+			if !strings.Contains(stored.Error, test.wantError) {
+				t.Errorf("error = %q, want it to contain %q", stored.Error, test.wantError)
+			}
+			if users := fake.TeamUsers(); (len(users) == 1) != test.wantUser {
+				t.Errorf("team users = %v, want user %v", users, test.wantUser)
+			}
+		})
+	}
+}
+
+func TestReconcileWaitsForRegistrationLock(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.addSession(t, models.Session{Name: "demo"})
+	usr := f.fake.AddTeamUser(lacework.TeamUsers{Email: "ann@example.com", Company: "Acme-demo"})
+	//Register got as far as creating the user
+	if _, err := f.registrationService.AddRegistration(&models.Registration{Session: "demo", Email: "ann@example.com", UserGuid: usr.UserGuid,
+		UserGroup: testUserGroup, Status: models.REGISTRATION_STATUS_PENDING, InstanceType: INSTANCE_TYPE_CUSTOM}); err != nil {
+		t.Fatal(err)
+	}
+	leases := services.NewLeaseServiceMemory()
+	reconciler := NewRegistrationReconciler(f.sessionService, f.registrationService, leases,
+		lacework.NewCachingClient(lacework.NewClient(f.fake.Config()), 0), 0, 3)
+
+	release, locked, err := lockRegistration(leases, "demo", "ann@example.com")
+	if err != nil || !locked {
+		t.Fatalf("lockRegistration() = %v, %v", locked, err)
+	}
+	reconciler.Reconcile()
+	if requests := f.fake.Requests(); len(requests) != 0 {
+		t.Errorf("requests while Register holds the lock = %v, want none", requests)
+	}
+	if registration, _ := f.registrationService.GetRegistration("demo", "ann@example.com"); registration.Status != models.REGISTRATION_STATUS_PENDING {
+		t.Errorf("status while Register holds the lock = %s, want pending", registration.Status)
+	}
+
+	release()
+	reconciler.Reconcile()
+	if registration, _ := f.registrationService.GetRegistration("demo", "ann@example.com"); registration.Status != models.REGISTRATION_STATUS_REGISTERED {
+		t.Errorf("status = %s, want registered", registration.Status)
+	}
+	if members := f.fake.UserGroupMembers(testUserGroup); len(members) != 1 || members[0] != usr.UserGuid {
+		t.Errorf("group members = %v, want %s", members, usr.UserGuid)
+	}
+}
+
+func TestReconcileRereadsLockedRegistration(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.addSession(t, models.Session{Name: "demo"})
+	stale := models.Registration{Session: "demo", Email: "ann@example.com", UserGuid: "GUID_1", Status: models.REGISTRATION_STATUS_PENDING}
+	//Register completed it after the reconciler listed it
+	completed := stale
+	completed.Status = models.REGISTRATION_STATUS_REGISTERED
+	if _, err := f.registrationService.AddRegistration(&completed); err != nil {
+		t.Fatal(err)
+	}
+	reconciler := NewRegistrationReconciler(f.sessionService, f.registrationService, services.NewLeaseServiceMemory(),
+		lacework.NewCachingClient(lacework.NewClient(f.fake.Config()), 0), 0, 3)
+	if err := reconciler.reconcileLocked(stale); err != nil {
+		t.Fatalf("reconcileLocked() = %v", err)
+	}
+	if requests := f.fake.Requests(); len(requests) != 0 {
+		t.Errorf("requests = %v, want none for a completed registration", requests)
+	}
+	if registration, _ := f.registrationService.GetRegistration("demo", "ann@example.com"); registration.Status != models.REGISTRATION_STATUS_REGISTERED || registration.Attempts != 0 {
+		t.Errorf("registration = %s after %d attempts, want it left registered", registration.Status, registration.Attempts)
+	}
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/leader"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"log"
+	"strings"
+	"time"
+)
+
+// registrationLockTTL is how long a registration lock outlives a replica that dies while holding it.
+const registrationLockTTL = time.Minute
+
+var (
+	// groupAddAttempts and groupAddBackoff bound how long Register retries adding a new user to its group
+	// before rolling the user back.
+	groupAddAttempts = 3
+	groupAddBackoff  = 500 * time.Millisecond
+)
+
+// lockRegistration takes the lease that Register holds for the whole saga. The reconciler takes it too, so it
+// never works on a registration that a live request is still completing, however long the Lacework calls take.
+// The lease is named by a hash so that emails stay out of lease names and the logs that mention them.
+func lockRegistration(leases services.LeaseService, session string, email string) (release func(), acquired bool, err error) {
+	sum := sha256.Sum256([]byte(session + "\n" + strings.ToLower(email)))
+	return leader.Lock(leases, "register-"+hex.EncodeToString(sum[:16]), registrationLockTTL)
+}
+
+// sagaStep is one step of a multi-step operation. compensate, when set, undoes the step after a later step
+// fails with cause.
+type sagaStep struct {
+	name       string
+	action     func() error
+	compensate func(cause error) error
+}
+
+// runSaga runs steps in order. When a step fails, the steps that completed are compensated in reverse order
+// and the failing step's error is returned. A failed compensation is logged and left for the reconciler. name
+// is called for every log line, so it can describe state that earlier steps filled in.
+func runSaga(name func() string, steps []sagaStep) error {
+	for i, step := range steps {
+		err := step.action()
+		if err == nil {
+			continue
+		}
+		log.Printf("%s: %s failed: %s", name(), step.name, err)
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].compensate == nil {
+				continue
+			}
+			if compErr := steps[j].compensate(err); compErr != nil {
+				log.Printf("%s: undoing %s failed: %s", name(), steps[j].name, compErr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// registrationRef names a registration in logs by its session and Lacework user, never by the attendee's email.
+func registrationRef(registration *models.Registration) string {
+	if registration.UserGuid == "" {
+		return fmt.Sprintf("new user for session %s", registration.Session)
+	}
+	return fmt.Sprintf("user %s for session %s", registration.UserGuid, registration.Session)
+}
+
+// addTeamUserToUserGroup adds the user to the group, retrying with a linear backoff.
+func addTeamUserToUserGroup(client lacework.Client, instance lacework.Instance, accessToken string, userGuid string, userGroup string, attempts int) (string, error) {
+	var msg string
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if _, msg, err = client.AddTeamUserToUserGroup(instance, accessToken, userGuid, userGroup); err == nil {
+			return msg, nil
+		}
+		if attempt < attempts {
+			log.Printf("Adding user %s to group %s failed (attempt %d of %d): %s", userGuid, userGroup, attempt, attempts, err)
+			time.Sleep(time.Duration(attempt) * groupAddBackoff)
+		}
+	}
+	return msg, err
+}
+
+// createdForSession reports whether an existing Lacework user was created by this session: only when
+// previous, the session's earlier registration of the same email, recorded it as its own. Company suffixes
+// cannot tell, since session names may contain dashes, so any other existing user is kept at cleanup.
+func createdForSession(previous *models.Registration, userGuid string) bool {
+	return previous != nil && previous.UserGuid == userGuid && !previous.PreExisting
+}
+
+// rollbackTeamUser deletes the Lacework user created for a registration that could not be completed. The
+// registration ends failed, or rolling back when the user could not be deleted. Pre-existing users are kept.
+func rollbackTeamUser(client lacework.Client, instance lacework.Instance, accessToken string, registration *models.Registration) error {
+	if registration.PreExisting || registration.UserGuid == "" {
+		registration.Status = models.REGISTRATION_STATUS_FAILED
+		return nil
+	}
+	if _, err := client.DeleteTeamMemberUser(instance, accessToken, registration.UserGuid); err != nil {
+		registration.Status = models.REGISTRATION_STATUS_ROLLING_BACK
+		registration.Error = fmt.Sprintf("Unable to delete user %s: %s", registration.UserGuid, err)
+		return err
+	}
+	log.Printf("Rolled back user %s of session %s", registration.UserGuid, registration.Session)
+	registration.Status = models.REGISTRATION_STATUS_FAILED
+	return nil
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/models"
+	"net/http"
+	"testing"
+)
+
+func TestCreatedForSession(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous *models.Registration
+		userGuid string
+		want     bool
+	}{
+		{name: "no earlier registration", userGuid: "GUID_1", want: false},
+		{name: "earlier registration created the user", previous: &models.Registration{UserGuid: "GUID_1"}, userGuid: "GUID_1", want: true},
+		{name: "earlier registration reused the user", previous: &models.Registration{UserGuid: "GUID_1", PreExisting: true}, userGuid: "GUID_1", want: false},
+		{name: "earlier registration created another user", previous: &models.Registration{UserGuid: "GUID_2"}, userGuid: "GUID_1", want: false},
+		{name: "earlier registration never got a user", previous: &models.Registration{}, userGuid: "GUID_1", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := createdForSession(test.previous, test.userGuid); got != test.want {
+				t.Errorf("createdForSession() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRegisterSaga(t *testing.T) {
+	const email = "ann@example.com"
+	tests := []struct {
+		name string
+		// existingUser seeds a Lacework user with the attendee's email, previous a registration of it for the
+		// session that holds its guid.
+		existingUser     bool
+		previous         *models.Registration
+		maxRegistrations int
+		regCount         int
+		failCreate       bool
+		failGroupAdd     bool
+		// inProgress holds the registration lock, as a concurrent request for the same email would.
+		inProgress bool
+
+		wantStatus      int
+		wantCode        string
+		wantRegStatus   string
+		wantPreExisting bool
+		wantUser        bool
+		wantInGroup     bool
+		wantRegCount    int
+	}{
+		{
+			name:       "new user",
+			wantStatus: http.StatusOK, wantRegStatus: models.REGISTRATION_STATUS_REGISTERED,
+			wantUser: true, wantInGroup: true, wantRegCount: 1,
+		},
+		{
+			name: "existing user is pre-existing", existingUser: true,
+			wantStatus: http.StatusOK, wantRegStatus: models.REGISTRATION_STATUS_REGISTERED, wantPreExisting: true,
+			wantUser: true, wantInGroup: true, wantRegCount: 1,
+		},
+		{
+			name: "existing user created by an earlier registration of this session", existingUser: true,
+			previous:   &models.Registration{Status: models.REGISTRATION_STATUS_FAILED},
+			wantStatus: http.StatusOK, wantRegStatus: models.REGISTRATION_STATUS_REGISTERED,
+			wantUser: true, wantInGroup: true, wantRegCount: 1,
+		},
+		{
+			name: "existing user an earlier registration reused", existingUser: true,
+			previous:   &models.Registration{Status: models.REGISTRATION_STATUS_FAILED, PreExisting: true},
+			wantStatus: http.StatusOK, wantRegStatus: models.REGISTRATION_STATUS_REGISTERED, wantPreExisting: true,
+			wantUser: true, wantInGroup: true, wantRegCount: 1,
+		},
+		{
+			name: "group add failure deletes the new user", failGroupAdd: true,
+			wantStatus: http.StatusBadGateway, wantCode: "lacework_error", wantRegStatus: models.REGISTRATION_STATUS_FAILED,
+		},
+		{
+			name: "group add failure keeps an existing user", existingUser: true, failGroupAdd: true,
+			wantStatus: http.StatusBadGateway, wantCode: "lacework_error", wantRegStatus: models.REGISTRATION_STATUS_FAILED, wantPreExisting: true,
+			wantUser: true,
+		},
+		{
+			name: "user creation failure frees the seat", failCreate: true,
+			wantStatus: http.StatusBadGateway, wantCode: "lacework_error", wantRegStatus: models.REGISTRATION_STATUS_FAILED,
+		},
+		{
+			name: "registration already in progress", inProgress: true,
+			wantStatus: http.StatusConflict, wantCode: "conflict",
+		},
+		{
+			name: "full session", maxRegistrations: 1, regCount: 1,
+			wantStatus: http.StatusConflict, wantCode: "session_full", wantRegCount: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newSessionFixture(t, RegistrationGuardConfig{})
+			f.principal = nil
+			f.addSession(t, models.Session{Name: "demo", MaxRegistrations: test.maxRegistrations, RegCount: test.regCount})
+			var existing lacework.TeamUsers
+			if test.existingUser {
+				existing = f.fake.AddTeamUser(lacework.TeamUsers{Email: email, Name: "Ann Lee", Company: "Acme-demo"})
+			}
+			if test.previous != nil {
+				previous := *test.previous
+				previous.Session, previous.Email, previous.UserGuid = "demo", email, existing.UserGuid
+				if _, err := f.registrationService.AddRegistration(&previous); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.failCreate {
+				f.fake.FailNext(http.MethodPost, "/api/v2/TeamUsers", http.StatusInternalServerError, 1)
+			}
+			if test.failGroupAdd {
+				f.fake.FailNext(http.MethodPost, "/api/v2/UserGroups/", http.StatusInternalServerError, groupAddAttempts)
+			}
+
+			if test.inProgress {
+				release, locked, err := lockRegistration(f.controller.leaseService, "demo", email)
+				if err != nil || !locked {
+					t.Fatalf("lockRegistration() = %v, %v", locked, err)
+				}
+				defer release()
+			}
+
+			recorder := f.register("demo", email, "")
+			body := envelope(recorder)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %v", recorder.Code, test.wantStatus, body)
+			}
+			if test.wantCode != "" && body["code"] != test.wantCode {
+				t.Errorf("code = %v, want %s", body["code"], test.wantCode)
+			}
+			if recorder.Code >= http.StatusInternalServerError && (body["error"] != nil || body["requestId"] == nil) {
+				t.Errorf("5xx envelope = %v, want a request id and no error detail", body)
+			}
+
+			registration, err := f.registrationService.GetRegistration("demo", email)
+			if test.wantRegStatus == "" {
+				if err == nil {
+					t.Errorf("registration = %+v, want none", registration)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				if registration.Status != test.wantRegStatus {
+					t.Errorf("registration status = %s, want %s", registration.Status, test.wantRegStatus)
+				}
+				if registration.PreExisting != test.wantPreExisting {
+					t.Errorf("registration preExisting = %v, want %v", registration.PreExisting, test.wantPreExisting)
+				}
+			}
+
+			users := f.fake.TeamUsers()
+			if (len(users) == 1) != test.wantUser || len(users) > 1 {
+				t.Errorf("team users = %v, want user %v", users, test.wantUser)
+			}
+			if members := f.fake.UserGroupMembers(testUserGroup); (len(members) == 1) != test.wantInGroup {
+				t.Errorf("group members = %v, want member %v", members, test.wantInGroup)
+			}
+			session, _ := f.sessionService.GetSessionByName("demo")
+			if session.RegCount != test.wantRegCount {
+				t.Errorf("regCount = %d, want %d", session.RegCount, test.wantRegCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+)
+
+// sessionScope returns the sessions the caller may see. Admins see every session. API keys see the sessions of
+// their team and those they created.
+func sessionScope(context *gin.Context) models.SessionScope {
+	principal := currentPrincipal(context)
+	if principal == nil {
+		return models.SessionScope{}
+	}
+	if principal.HasRole(auth.ROLE_ADMIN) {
+		return models.SessionScope{All: true}
+	}
+	return models.SessionScope{Principal: models.NormalizePrincipal(principal.ID()), Teams: principal.Teams}
+}
+
+// viewableSession returns the named session if the caller may view it. Sessions of other teams are reported as
+// not found so their names do not leak.
+func viewableSession(sessionService services.SessionService, context *gin.Context, name string) (*models.Session, error) {
+	session, err := sessionService.GetSessionByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if !sessionScope(context).CanView(*session) {
+		return nil, fmt.Errorf("%w: %s", services.ErrSessionNotFound, name)
+	}
+	return session, nil
+}
+
+// manageableSession returns the named session if the caller may delete it and change who it is shared with.
+func manageableSession(sessionService services.SessionService, context *gin.Context, name string) (*models.Session, error) {
+	session, err := viewableSession(sessionService, context, name)
+	if err != nil {
+		return nil, err
+	}
+	if !sessionScope(context).CanManage(*session) {
+		return nil, forbidden(fmt.Sprintf("Only the owner or team of session %s can do this.", name))
+	}
+	return session, nil
+}
+
+// teamForNewSession picks the team of a session the caller creates. Callers may only create sessions for their
+// own teams. A caller in a single team who names none gets that team, and one in several must name one.
+func teamForNewSession(context *gin.Context, requested string) (string, error) {
+	scope := sessionScope(context)
+	if requested != "" {
+		if !scope.All && !scope.InTeam(requested) {
+			return "", forbidden(fmt.Sprintf("You are not a member of team %s.", requested))
+		}
+		return requested, nil
+	}
+	if principal := currentPrincipal(context); principal != nil {
+		switch len(principal.Teams) {
+		case 0:
+		case 1:
+			return principal.Teams[0], nil
+		default:
+			if !scope.All {
+				return "", fmt.Errorf("%w: team is required for members of several teams %v", services.ErrInvalid, principal.Teams)
+			}
+		}
+	}
+	return "", nil
+}
+
+// checkOwnershipPatch allows owners and admins to hand a session to someone else, and moves to another team only
+// to members of that team.
+func checkOwnershipPatch(context *gin.Context, session models.Session, patch *models.SessionPatchReq) error {
+	scope := sessionScope(context)
+	if scope.All || (patch.Owner == nil && patch.Team == nil) {
+		return nil
+	}
+	if !scope.CanManage(session) {
+		return forbidden(fmt.Sprintf("Only the owner or team of session %s can change its owner or team.", session.Name))
+	}
+	if patch.Owner != nil && models.NormalizePrincipal(*patch.Owner) != session.Owner && session.Owner != scope.Principal {
+		return forbidden(fmt.Sprintf("Only the owner of session %s can give it away.", session.Name))
+	}
+	if patch.Team != nil && *patch.Team != session.Team && !scope.InTeam(*patch.Team) {
+		return forbidden(fmt.Sprintf("You are not a member of team %s.", *patch.Team))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestManageableSession(t *testing.T) {
+	sessionService := services.NewSessionServiceMemory()
+	for _, session := range []models.Session{
+		{Name: "owned", Owner: "ann@example.com"},
+		{Name: "teamed", Owner: "bob@example.com", Team: "emea"},
+		{Name: "shared", Owner: "bob@example.com", CoHosts: []string{"ann@example.com"}},
+	} {
+		session.ExpiresAt = time.Now().Add(time.Hour)
+		if _, err := sessionService.AddSession(&session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ann := &auth.Principal{Subject: "ann", Email: "Ann@Example.com", Role: auth.ROLE_EVENT_MANAGER, Teams: []string{"apac"}}
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		session    string
+		wantErr    error
+		wantStatus int
+	}{
+		{name: "admin", principal: testAdmin, session: "teamed"},
+		{name: "owner, whatever the email's case", principal: ann, session: "owned"},
+		{name: "team member", principal: &auth.Principal{Subject: "carl", Role: auth.ROLE_EVENT_MANAGER, Teams: []string{"emea"}}, session: "teamed"},
+		{name: "api key of the team", principal: &auth.Principal{Subject: "key-1", Method: auth.METHOD_API_KEY, Teams: []string{"emea"}}, session: "teamed"},
+		{name: "co-host", principal: ann, session: "shared", wantStatus: http.StatusForbidden},
+		{name: "other team", principal: ann, session: "teamed", wantErr: services.ErrSessionNotFound},
+		{name: "anonymous", session: "owned", wantErr: services.ErrSessionNotFound},
+		{name: "missing session", principal: testAdmin, session: "missing", wantErr: services.ErrSessionNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			context, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if test.principal != nil {
+				context.Set(principalKey, test.principal)
+			}
+			session, err := manageableSession(sessionService, context, test.session)
+			var apiErr APIError
+			switch {
+			case test.wantErr != nil:
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("manageableSession() = %v, want %v", err, test.wantErr)
+				}
+			case test.wantStatus != 0:
+				if !errors.As(err, &apiErr) || apiErr.Status != test.wantStatus {
+					t.Errorf("manageableSession() = %v, want status %d", err, test.wantStatus)
+				}
+			case err != nil || session.Name != test.session:
+				t.Errorf("manageableSession() = %+v, %v, want session %s", session, err, test.session)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/leader"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cleanupLockTTL is how long a cleanup lock outlives a replica that dies while holding it.
+const cleanupLockTTL = time.Minute
+
+// sessionCleaner deletes sessions together with the Lacework users, registrations and access data recorded for
+// them. It is shared by the session handlers and the cleanup job, and locks each session it cleans through
+// leaseService so that replicas never clean the same session at once.
+type sessionCleaner struct {
+	sessionService      services.SessionService
+	registrationService services.RegistrationService
+	accessService       services.AccessService
+	leaseService        services.LeaseService
+	laceworkClient      lacework.Client
+}
+
+// cleanupResult counts the users a cleanup deleted, or would delete in a dry run, and the ones it could not.
+type cleanupResult struct {
+	usersDeleted int
+	failures     []models.CleanupFailure
+}
+
+// deleteTeamMemberUsersBySession deletes the Lacework users recorded in the session's registrations. Sessions
+// created before registrations were recorded also have their users matched by the "-<session>" company suffix,
+// but only when confirmLegacy is set, since that suffix also matches the users of sessions such as
+// "big-<session>". A dry run only counts the users.
+func (c sessionCleaner) deleteTeamMemberUsersBySession(session models.Session, dryRun bool, confirmLegacy bool) (cleanupResult, error) {
+	var result cleanupResult
+	registrations, err := c.registrationService.GetRegistrationsBySession(session.Name)
+	if err != nil {
+		return result, fmt.Errorf("unable to retrieve registrations: %w", err)
+	}
+	instance := instanceForSession(session)
+	accessToken, err := c.laceworkClient.CreateAccessToken(instance)
+	if err != nil {
+		//access token issue
+		return result, fmt.Errorf("unable to create access token: %w", err)
+	}
+
+	if session.LegacyUsers {
+		if !confirmLegacy {
+			return result, fmt.Errorf("%w: session %s predates registration records and its users can only be matched by company suffix, which may also match other sessions. Review its users and retry with confirmLegacyMatch=true",
+				services.ErrConflict, session.Name)
+		}
+		log.Printf("Session %s predates registration records. Matching users by company suffix.", session.Name)
+		legacy, err := c.legacyRegistrations(session, instance, accessToken.Token)
+		if err != nil {
+			return result, err
+		}
+		registrations = mergeRegistrations(registrations, legacy)
+	}
+
+	for _, registration := range registrations {
+		if registration.UserGuid == "" || registration.Status == models.REGISTRATION_STATUS_DELETED ||
+			registration.Status == models.REGISTRATION_STATUS_FAILED {
+			continue
+		}
+		if dryRun {
+			if !registration.PreExisting {
+				log.Printf("Dry run: would delete user %s of session %s", registration.UserGuid, session.Name)
+				result.usersDeleted++
+			}
+			continue
+		}
+		if registration.PreExisting {
+			//the account is kept, but not the access this session gave it
+			userGroup := registrationUserGroup(registration, session)
+			if msg, err := c.laceworkClient.RemoveTeamUserFromUserGroup(instance, accessToken.Token, registration.UserGuid, userGroup); err != nil {
+				log.Printf("Unable to remove user %s from group %s: %v %s", registration.UserGuid, userGroup, err, msg)
+				result.failures = append(result.failures, models.CleanupFailure{Session: session.Name, UserGuid: registration.UserGuid, Error: err.Error()})
+				continue
+			}
+			log.Printf("Keeping pre-existing user %s, removed from group %s", registration.UserGuid, userGroup)
+			registration.Status = models.REGISTRATION_STATUS_DELETED
+			if err := c.registrationService.UpdateRegistration(&registration); err != nil {
+				log.Printf("Error recording release of user %s: %s", registration.UserGuid, err)
+			}
+			continue
+		}
+		if delRsp, err := c.laceworkClient.DeleteTeamMemberUser(instance, accessToken.Token, registration.UserGuid); err != nil {
+			log.Printf("Unable to delete user %s: %v", registration.UserGuid, err)
+			result.failures = append(result.failures, models.CleanupFailure{Session: session.Name, UserGuid: registration.UserGuid, Error: err.Error()})
+		} else {
+			log.Printf("Deleted user %s %s", registration.UserGuid, delRsp)
+			result.usersDeleted++
+			if registration.Email != "" {
+				registration.Status = models.REGISTRATION_STATUS_DELETED
+				if err := c.registrationService.UpdateRegistration(&registration); err != nil {
+					log.Printf("Error recording deletion of user %s: %s", registration.UserGuid, err)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// registrationUserGroup is the group Register added the registration's user to.
+func registrationUserGroup(registration models.Registration, session models.Session) string {
+	if registration.UserGroup != "" {
+		return registration.UserGroup
+	}
+	if session.LwUserGroup != "" {
+		return session.LwUserGroup
+	}
+	return "LACEWORK_USER_GROUP_READ_ONLY_USER"
+}
+
+// mergeRegistrations adds the legacy registrations whose users are not already recorded.
+func mergeRegistrations(recorded []models.Registration, legacy []models.Registration) []models.Registration {
+	guids := map[string]bool{}
+	for _, registration := range recorded {
+		guids[registration.UserGuid] = true
+	}
+	for _, registration := range legacy {
+		if !guids[registration.UserGuid] {
+			recorded = append(recorded, registration)
+		}
+	}
+	return recorded
+}
+
+// legacyRegistrations stands in registrations for the users whose company ends in "-<session>", leaving out
+// those that end in the name of another session that itself ends in "-<session>".
+func (c sessionCleaner) legacyRegistrations(session models.Session, instance lacework.Instance, accessToken string) ([]models.Registration, error) {
+	sessions, err := c.sessionService.GetAllSessions()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve sessions: %w", err)
+	}
+	var longerNames []string
+	for _, other := range sessions {
+		if other.Name != session.Name && strings.HasSuffix(other.Name, "-"+session.Name) {
+			longerNames = append(longerNames, other.Name)
+		}
+	}
+	usrsRsp, msg, err := c.laceworkClient.GetSessionTeamMemberUsers(instance, accessToken, session.Name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list team users %s: %w", msg, err)
+	}
+	var registrations []models.Registration
+users:
+	for _, usr := range usrsRsp.Data {
+		for _, name := range longerNames {
+			if strings.HasSuffix(usr.Company, "-"+name) {
+				log.Printf("Keeping user %s of session %s", usr.UserGuid, name)
+				continue users
+			}
+		}
+		registrations = append(registrations, models.Registration{Session: session.Name, UserGuid: usr.UserGuid})
+	}
+	return registrations, nil
+}
+
+// cleanupSession marks the session cleanup_pending, which closes registration, and deletes its Lacework users.
+// The session becomes cleaned once every user is gone. Otherwise it stays cleanup_pending for another attempt,
+// or becomes cleanup_failed after maxAttempts. Zero maxAttempts never gives up. confirmLegacy allows matching
+// the users of sessions that predate registration records by company suffix.
+func (c sessionCleaner) cleanupSession(session *models.Session, maxAttempts int, confirmLegacy bool) (cleanupResult, error) {
+	release, locked, err := leader.Lock(c.leaseService, "cleanup-session-"+session.Name, cleanupLockTTL)
+	if err != nil {
+		return cleanupResult{}, err
+	}
+	if !locked {
+		return cleanupResult{}, fmt.Errorf("%w: session %s is being cleaned up by another request", services.ErrConflict, session.Name)
+	}
+	defer release()
+
+	if session.Lifecycle != models.SESSION_LIFECYCLE_CLEANUP_PENDING {
+		session.Lifecycle = models.SESSION_LIFECYCLE_CLEANUP_PENDING
+		if err := c.sessionService.UpdateSessionLifecycle(session); err != nil {
+			return cleanupResult{}, err
+		}
+	}
+
+	result, err := c.deleteTeamMemberUsersBySession(*session, false, confirmLegacy)
+	if err == nil && len(result.failures) > 0 {
+		err = fmt.Errorf("unable to delete %d of the session's users", len(result.failures))
+	}
+	now := time.Now().UTC()
+	session.CleanupAttempts++
+	session.CleanupAttemptAt = &now
+	if err == nil {
+		session.Lifecycle, session.CleanupError, session.CleanedAt = models.SESSION_LIFECYCLE_CLEANED, "", &now
+		//every user matched by suffix is gone, so later attempts need no confirmation
+		session.LegacyUsers = false
+		log.Printf("Cleaned session %s", session.Name)
+	} else {
+		session.CleanupError = err.Error()
+		if maxAttempts > 0 && session.CleanupAttempts >= maxAttempts {
+			session.Lifecycle = models.SESSION_LIFECYCLE_CLEANUP_FAILED
+			log.Printf("Giving up cleaning session %s after %d attempts: %s", session.Name, session.CleanupAttempts, err)
+		}
+		err = cleanupIncomplete(session, err)
+	}
+	if updateErr := c.sessionService.UpdateSessionLifecycle(session); updateErr != nil {
+		log.Printf("Error recording cleanup of session %s: %s", session.Name, updateErr)
+		if err == nil {
+			err = updateErr
+		}
+	}
+	return result, err
+}
+
+// cleanupIncomplete reports Lacework users that are still there after a cleanup attempt. Client errors, such
+// as a legacy session that needs confirmLegacyMatch, are returned as they are.
+func cleanupIncomplete(session *models.Session, err error) error {
+	if status, _, _ := describeError(err); status < http.StatusInternalServerError {
+		return err
+	}
+	message := fmt.Sprintf("Session %s is kept until its Lacework users are deleted. Cleanup will retry.", session.Name)
+	if session.Lifecycle == models.SESSION_LIFECYCLE_CLEANUP_FAILED {
+		message = fmt.Sprintf("Session %s is kept until its Lacework users are deleted. Cleanup gave up and must be retried by an admin.", session.Name)
+	}
+	return APIError{http.StatusBadGateway, "cleanup_incomplete", message, err}
+}
+
+// removeSession deletes the session, its registration records and its access codes and invites.
+func (c sessionCleaner) removeSession(sessionName string) error {
+	if err := c.sessionService.DeleteSession(sessionName); err != nil {
+		return err
+	}
+	if err := c.registrationService.DeleteRegistrationsBySession(sessionName); err != nil {
+		log.Printf("Error deleting registrations for session %s: %s", sessionName, err)
+	}
+	if err := c.accessService.DeleteSessionAccess(sessionName); err != nil {
+		log.Printf("Error deleting access codes and invites for session %s: %s", sessionName, err)
+	}
+	log.Printf("Deleted session %s", sessionName)
+	return nil
+}
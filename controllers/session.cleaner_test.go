@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCleanupLegacySessionWithRegistrations(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.addSession(t, models.Session{Name: "demo", RegCount: 1, LegacyUsers: true})
+	f.addSession(t, models.Session{Name: "big-demo"})
+	legacy := f.fake.AddTeamUser(lacework.TeamUsers{Email: "old@example.com", Company: "Acme-demo"})
+	other := f.fake.AddTeamUser(lacework.TeamUsers{Email: "big@example.com", Company: "Acme-big-demo"})
+	f.principal = nil
+	if recorder := f.register("demo", "ann@example.com", ""); recorder.Code != http.StatusOK {
+		t.Fatalf("register: status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	session, _ := f.sessionService.GetSessionByName("demo")
+	if _, err := f.controller.cleanupSession(session, 0, false); !errors.Is(err, services.ErrConflict) {
+		t.Fatalf("cleanupSession() without confirmation = %v, want ErrConflict", err)
+	}
+	if users := f.fake.TeamUsers(); len(users) != 3 {
+		t.Fatalf("team users after an unconfirmed cleanup = %v, want all three", users)
+	}
+
+	session, _ = f.sessionService.GetSessionByName("demo")
+	result, err := f.controller.cleanupSession(session, 0, true)
+	if err != nil {
+		t.Fatalf("cleanupSession() = %v", err)
+	}
+	//the registered user also matches the suffix and must only be deleted once
+	if result.usersDeleted != 2 || len(result.failures) != 0 {
+		t.Errorf("result = %+v, want two users deleted", result)
+	}
+	if users := f.fake.TeamUsers(); len(users) != 1 || users[0].UserGuid != other.UserGuid {
+		t.Errorf("team users after cleanup = %v, want only %s of big-demo, and not %s", users, other.UserGuid, legacy.UserGuid)
+	}
+	deletes := 0
+	for _, request := range f.fake.Requests() {
+		if strings.HasPrefix(request, http.MethodDelete) {
+			deletes++
+		}
+	}
+	if deletes != 2 {
+		t.Errorf("DELETE requests = %d, want 2", deletes)
+	}
+	session, _ = f.sessionService.GetSessionByName("demo")
+	if session.LegacyUsers || session.Lifecycle != models.SESSION_LIFECYCLE_CLEANED {
+		t.Errorf("session = %s with legacyUsers %v, want cleaned without the legacy mark", session.Lifecycle, session.LegacyUsers)
+	}
+}
+
+func TestMergeRegistrations(t *testing.T) {
+	recorded := []models.Registration{{Email: "ann@example.com", UserGuid: "GUID_1"}, {Email: "bob@example.com"}}
+	legacy := []models.Registration{{UserGuid: "GUID_1"}, {UserGuid: "GUID_2"}}
+	merged := mergeRegistrations(recorded, legacy)
+	if len(merged) != 3 || merged[0].Email != "ann@example.com" || merged[2].UserGuid != "GUID_2" {
+		t.Errorf("mergeRegistrations() = %+v, want the recorded registrations and GUID_2", merged)
+	}
+}
+
+func TestCleanupRemovesPreExistingUsersFromGroup(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.addSession(t, models.Session{Name: "demo"})
+	existing := f.fake.AddTeamUser(lacework.TeamUsers{Email: "ann@example.com", Company: "Acme"})
+	f.principal = nil
+	for _, email := range []string{"ann@example.com", "bob@example.com"} {
+		if recorder := f.register("demo", email, ""); recorder.Code != http.StatusOK {
+			t.Fatalf("register %s: status = %d: %s", email, recorder.Code, recorder.Body)
+		}
+	}
+
+	//a failed group removal keeps the session for another attempt
+	f.fake.FailNext(http.MethodPost, "/api/v2/UserGroups/", http.StatusInternalServerError, 1)
+	session, _ := f.sessionService.GetSessionByName("demo")
+	if result, err := f.controller.cleanupSession(session, 0, false); err == nil || len(result.failures) != 1 || result.failures[0].UserGuid != existing.UserGuid {
+		t.Fatalf("cleanupSession() with a failing group removal = %+v, %v, want a failure for %s", result, err, existing.UserGuid)
+	}
+	if members := f.fake.UserGroupMembers(testUserGroup); len(members) != 1 || members[0] != existing.UserGuid {
+		t.Errorf("group members = %v, want %s", members, existing.UserGuid)
+	}
+
+	session, _ = f.sessionService.GetSessionByName("demo")
+	if _, err := f.controller.cleanupSession(session, 0, false); err != nil {
+		t.Fatalf("cleanupSession() = %v", err)
+	}
+	if users := f.fake.TeamUsers(); len(users) != 1 || users[0].UserGuid != existing.UserGuid {
+		t.Errorf("team users = %v, want only the pre-existing %s", users, existing.UserGuid)
+	}
+	if members := f.fake.UserGroupMembers(testUserGroup); len(members) != 0 {
+		t.Errorf("group members = %v, want none", members)
+	}
+}
+
+func TestDeleteLegacySession(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.addSession(t, models.Session{Name: "demo", LegacyUsers: true})
+	f.fake.AddTeamUser(lacework.TeamUsers{Email: "old@example.com", Company: "Acme-demo"})
+
+	//an unconfirmed suffix match is the caller's to fix, not a Lacework failure
+	recorder := f.do(http.MethodDelete, "/api/sessions/demo", nil)
+	if body := envelope(recorder); recorder.Code != http.StatusConflict || body["code"] != "conflict" || !strings.Contains(body["message"].(string), "confirmLegacyMatch") {
+		t.Fatalf("DELETE without confirmation = %d %v, want 409 conflict naming confirmLegacyMatch", recorder.Code, body)
+	}
+	if users := f.fake.TeamUsers(); len(users) != 1 {
+		t.Fatalf("team users after an unconfirmed delete = %v, want the legacy user", users)
+	}
+
+	recorder = f.do(http.MethodDelete, "/api/sessions/demo?confirmLegacyMatch=true", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("DELETE with confirmation = %d: %s", recorder.Code, recorder.Body)
+	}
+	if users := f.fake.TeamUsers(); len(users) != 0 {
+		t.Errorf("team users = %v, want none", users)
+	}
+	if _, err := f.sessionService.GetSessionByName("demo"); !errors.Is(err, services.ErrSessionNotFound) {
+		t.Errorf("GetSessionByName() = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestCleanupIncomplete(t *testing.T) {
+	session := &models.Session{Name: "demo", Lifecycle: models.SESSION_LIFECYCLE_CLEANUP_PENDING}
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "user deletions failed", err: errors.New("unable to delete 1 of the session's users"), wantStatus: http.StatusBadGateway},
+		{name: "lacework failure", err: laceworkError("Error creating access token.", errors.New("refused")), wantStatus: http.StatusBadGateway},
+		{name: "conflict", err: fmt.Errorf("%w: confirm the legacy match", services.ErrConflict), wantStatus: http.StatusConflict},
+		{name: "client APIError", err: badRequest("Invalid session.", nil), wantStatus: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := cleanupIncomplete(session, test.err)
+			if status, _, _ := describeError(err); status != test.wantStatus {
+				t.Errorf("cleanupIncomplete() = %v with status %d, want %d", err, status, test.wantStatus)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("cleanupIncomplete() = %v, want it to wrap %v", err, test.err)
+			}
+		})
+	}
+}
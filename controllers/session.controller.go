@@ -1,26 +1,23 @@
 package controllers
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/lacework"
 	"github.com/jefferyfry/eventengine/models"
 	"github.com/jefferyfry/eventengine/services"
-	"github.com/robfig/cron/v3"
-	"io"
 	"log"
 	"net/http"
-	"net/http/httputil"
 	"os"
+	"strconv"
 	"strings"
-	"time"
 )
 
 const (
-	INSTANCE_TYPE_CUSTOM  string = "CUSTOM"
-	INSTANCE_TYPE_DEFAULT string = "DEFAULT"
+	INSTANCE_TYPE_CUSTOM  string = models.INSTANCE_TYPE_CUSTOM
+	INSTANCE_TYPE_DEFAULT string = models.INSTANCE_TYPE_DEFAULT
 )
 
 var (
@@ -30,62 +27,15 @@ var (
 	defaultLwSubAcct     = os.Getenv("eventengine_def_sub_acct")
 )
 
-type AccessTokenReqPayload struct {
-	KeyId      string `json:"keyId"`
-	ExpiryTime int    `json:"expiryTime"`
-}
-
-type AccessTokenRspPayload struct {
-	ExpiresAt string `json:"expiresAt"`
-	Token     string `json:"token"`
-}
-
 type RegisterUserReq struct {
-	Email     string `json:"email" binding:"required"`
+	Email     string `json:"email" binding:"required,email"`
 	FirstName string `json:"firstName" binding:"required"`
 	LastName  string `json:"lastName" binding:"required"`
 	Company   string `json:"company" binding:"required"`
-}
-
-type PostTeamUsersReq struct {
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	Company string `json:"company"`
-}
-
-type PostTeamUsersRsp struct {
-	Data TeamUsers `json:"data"`
-}
-
-type TeamUsers struct {
-	Name          string       `json:"name"`
-	Company       string       `json:"company,omitempty"`
-	Email         string       `json:"email"`
-	UserGuid      string       `json:"userGuid"`
-	UserEnabled   int          `json:"userEnabled"`
-	Type          string       `json:"type"`
-	UserGroups    []UserGroups `json:"userGroups,omitempty"`
-	LastLoginTime int          `json:"lastLoginTime"`
-	OrgAccess     string       `json:"lastLoginTime"`
-}
-
-type UserGroups struct {
-	UserGroupGuid string `json:"userGroupGuid"`
-	UserGroupName string `json:"userGroupName"`
-}
-
-type PostUserGroupsReq struct {
-	UserGuids []string `json:"userGuids"`
-}
-
-type PostUserGroupsRsp struct {
-	UserGuids      []string `json:"userGuids"`
-	UserGroupGuids []string `json:"userGroupGuids"`
-}
-
-type GetTeamUsersRsp struct {
-	Data []TeamUsers `json:"data"`
+	// ChallengeToken is the solved CAPTCHA, when registration challenges are on.
+	ChallengeToken string `json:"challengeToken,omitempty"`
+	// AccessCode is the shared or one-time code, for sessions that need one.
+	AccessCode string `json:"accessCode,omitempty"`
 }
 
 type Sessions struct {
@@ -93,24 +43,21 @@ type Sessions struct {
 }
 
 type SessionController struct {
-	sessionService services.SessionService
+	sessionCleaner
+	registrationGuard *RegistrationGuard
 }
 
-func NewSessionController(sessionService services.SessionService) SessionController {
-	sessionController := SessionController{sessionService}
-	sessionController.StartCleanupCron()
-	return sessionController
+func NewSessionController(sessionService services.SessionService, registrationService services.RegistrationService, accessService services.AccessService, leaseService services.LeaseService, laceworkClient lacework.Client, registrationGuard *RegistrationGuard) SessionController {
+	return SessionController{sessionCleaner{sessionService, registrationService, accessService, leaseService, laceworkClient}, registrationGuard}
 }
 
 func (s SessionController) GetSessions(context *gin.Context) {
-	sessions, err := s.sessionService.GetAllSessions()
+	sessions, err := s.sessionService.GetSessionsInScope(sessionScope(context))
 	if err != nil {
-		log.Printf("Error retrieving sessions.: %s", err)
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving sessions. " + err.Error(), "error": err})
-		context.Abort()
+		respondError(context, err)
 		return
 	}
-	context.JSON(http.StatusOK, sessions)
+	context.JSON(http.StatusOK, models.NewSessionAdminViews(sessions))
 	return
 }
 
@@ -120,75 +67,180 @@ func (s SessionController) GetDefaultInstance(context *gin.Context) {
 }
 
 func (s SessionController) GetSessionByName(context *gin.Context) {
-	if context.Param("name") != "" {
-		session, err := s.sessionService.GetSessionByName(context.Param("name"))
-		if err != nil {
-			context.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the session. " + err.Error(), "error": err})
-			context.Abort()
-			return
-		}
-		context.JSON(http.StatusOK, session)
+	session, err := viewableSession(s.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
 		return
 	}
-	context.JSON(http.StatusBadRequest, gin.H{"message": "Missing session name parameter."})
+	setETag(context, session)
+	context.JSON(http.StatusOK, models.NewSessionAdminView(*session))
+}
+
+func (s SessionController) GetPublicSession(context *gin.Context) {
+	session, err := s.sessionService.GetSessionByName(context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	view := models.NewSessionPublicView(*session)
+	view.ChallengeSiteKey = s.registrationGuard.ChallengeSiteKey()
+	context.JSON(http.StatusOK, view)
 }
 
 func (s SessionController) AddSession(context *gin.Context) {
-	var session models.Session
-	if err := context.ShouldBindJSON(&session); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request parameters. " + err.Error(), "error": err.Error()})
+	var sessionReq models.SessionCreateReq
+	if err := context.ShouldBindJSON(&sessionReq); err != nil {
+		respondError(context, badRequest("Invalid request parameters.", err))
 		return
 	}
-	newSession, err := s.sessionService.AddSession(&session)
+	if id := principalID(context); id != "" {
+		sessionReq.CreatedBy = id
+	}
+	if err := sessionReq.Validate(); err != nil {
+		respondError(context, fmt.Errorf("%w: %s", services.ErrInvalid, err))
+		return
+	}
+	team, err := teamForNewSession(context, sessionReq.Team)
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Error adding session. " + err.Error(), "error": err})
-		context.Abort()
+		respondError(context, err)
 		return
 	}
-	context.JSON(http.StatusOK, newSession)
+	sessionReq.Team = team
+	newSession, err := s.sessionService.AddSession(sessionReq.ToSession())
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	setETag(context, newSession)
+	context.JSON(http.StatusOK, models.NewSessionAdminView(*newSession))
 	return
 }
 
 func (s SessionController) UpdateSession(context *gin.Context) {
-	sessionName := context.Param("name")
-	if sessionName == "" {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Missing session name."})
+	var sessionReq models.SessionUpdateReq
+	if err := context.ShouldBindJSON(&sessionReq); err != nil {
+		respondError(context, badRequest("Invalid request parameters.", err))
 		return
 	}
-	var session models.Session
-	if err := context.ShouldBindJSON(&session); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request parameters. " + err.Error(), "error": err.Error()})
+	if err := sessionReq.Validate(); err != nil {
+		respondError(context, fmt.Errorf("%w: %s", services.ErrInvalid, err))
 		return
 	}
-	newSession, err := s.sessionService.UpdateSession(sessionName, &session)
-	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Error adding session. " + err.Error(), "error": err})
-		context.Abort()
+	s.patchSession(context, context.Param("name"), sessionReq.ToPatch())
+}
+
+func (s SessionController) PatchSession(context *gin.Context) {
+	var patch models.SessionPatchReq
+	if err := context.ShouldBindJSON(&patch); err != nil {
+		respondError(context, badRequest("Invalid request parameters.", err))
 		return
 	}
-	context.JSON(http.StatusOK, newSession)
-	return
+	if err := patch.Validate(); err != nil {
+		respondError(context, fmt.Errorf("%w: %s", services.ErrInvalid, err))
+		return
+	}
+	s.patchSession(context, context.Param("name"), &patch)
 }
 
-func (s SessionController) DeleteSession(context *gin.Context) {
-	sessionName := context.Param("name")
-	if sessionName == "" {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Missing session name."})
+// patchSession applies patch, taking the expected version from the If-Match header when one is sent. Updates
+// without a version are refused so one editor cannot silently overwrite another.
+func (s SessionController) patchSession(context *gin.Context, sessionName string, patch *models.SessionPatchReq) {
+	if ifMatch := context.GetHeader("If-Match"); ifMatch != "" {
+		version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 64)
+		if err != nil {
+			respondError(context, badRequest("Invalid If-Match header. Expected a session ETag.", err))
+			return
+		}
+		patch.Version = version
+	}
+	if patch.Version <= 0 {
+		respondError(context, APIError{http.StatusPreconditionRequired, "precondition_required",
+			"Send the session's ETag in If-Match, or its version, so that changes made by someone else are not lost.", nil})
 		return
 	}
-
-	if session, err := s.sessionService.GetSessionByName(sessionName); err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the session. " + err.Error(), "error": err})
-		context.Abort()
+	session, err := viewableSession(s.sessionService, context, sessionName)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	if err := checkOwnershipPatch(context, *session, patch); err != nil {
+		respondError(context, err)
 		return
-	} else {
-		s.deleteTeamMemberUsersBySession(*session)
-		if err := s.sessionService.DeleteSession(sessionName); err != nil {
-			context.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting session. " + err.Error(), "error": err})
-			context.Abort()
+	}
+	//the access mode and shared code may be patched separately, so they are checked together once applied
+	patched := *session
+	patch.Apply(&patched)
+	if err := models.ValidateAccess(patched.AccessMode, patched.AccessCode); err != nil {
+		respondError(context, fmt.Errorf("%w: %s", services.ErrInvalid, err))
+		return
+	}
+	if patched.Name != session.Name {
+		if err := s.checkRenamable(*session); err != nil {
+			respondError(context, err)
 			return
 		}
-		log.Printf("Deleted session %s", sessionName)
+	}
+	if id := principalID(context); id != "" {
+		patch.UpdatedBy = &id
+	}
+	newSession, err := s.sessionService.PatchSession(sessionName, patch)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	if newSession.Name != sessionName {
+		if err := s.moveSessionData(sessionName, newSession.Name); err != nil {
+			respondError(context, err)
+			return
+		}
+	}
+	setETag(context, newSession)
+	context.JSON(http.StatusOK, models.NewSessionAdminView(*newSession))
+}
+
+// checkRenamable refuses to rename a session that has registered anyone. Its Lacework users carry the name in
+// their company, and the records that tie them to the session would have to move with it.
+func (s SessionController) checkRenamable(session models.Session) error {
+	registrations, err := s.registrationService.GetRegistrationsBySession(session.Name)
+	if err != nil {
+		return err
+	}
+	if len(registrations) > 0 || session.RegCount > 0 || session.LegacyUsers {
+		return fmt.Errorf("%w: session %s has registrations and cannot be renamed", services.ErrConflict, session.Name)
+	}
+	return nil
+}
+
+// moveSessionData moves the records of a renamed session, such as registrations that arrived while it was
+// renamed, and its access codes and invites. If a move fails, everything is moved back to oldName, the
+// session included, so nothing is left under the wrong name.
+func (s SessionController) moveSessionData(oldName string, newName string) error {
+	err := s.registrationService.RenameSession(oldName, newName)
+	if err == nil {
+		if err = s.accessService.RenameSession(oldName, newName); err != nil {
+			if undoErr := s.registrationService.RenameSession(newName, oldName); undoErr != nil {
+				log.Printf("Error moving registrations of session %s back to %s: %s", newName, oldName, undoErr)
+			}
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	if _, undoErr := s.sessionService.PatchSession(newName, &models.SessionPatchReq{Name: &oldName}); undoErr != nil {
+		log.Printf("Error renaming session %s back to %s: %s", newName, oldName, undoErr)
+	}
+	return fmt.Errorf("unable to move the records of session %s, so it was not renamed: %w", oldName, err)
+}
+
+func (s SessionController) DeleteSession(context *gin.Context) {
+	session, err := manageableSession(s.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	if err := s.deleteSession(session, context.Query("confirmLegacyMatch") == "true"); err != nil {
+		respondError(context, err)
+		return
 	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "Session deleted."})
@@ -198,288 +250,268 @@ func (s SessionController) DeleteSession(context *gin.Context) {
 func (s SessionController) DeleteSessions(context *gin.Context) {
 	var sessions Sessions
 	if err := context.ShouldBindJSON(&sessions); err != nil {
-		context.JSON(http.StatusBadRequest, gin.H{"message": "Invalid payload parameters. " + err.Error(), "error": err.Error()})
+		respondError(context, badRequest("Invalid payload parameters.", err))
 		return
 	}
 
+	//nothing is deleted unless the caller may delete every session
+	var toDelete []*models.Session
 	for _, sessionName := range sessions.Sessions {
-		if session, err := s.sessionService.GetSessionByName(sessionName); err != nil {
-			context.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the session. " + err.Error(), "error": err})
-			context.Abort()
+		session, err := manageableSession(s.sessionService, context, sessionName)
+		if err != nil {
+			respondError(context, err)
+			return
+		}
+		toDelete = append(toDelete, session)
+	}
+	for _, session := range toDelete {
+		if err := s.deleteSession(session, context.Query("confirmLegacyMatch") == "true"); err != nil {
+			respondError(context, err)
 			return
-		} else {
-			s.deleteTeamMemberUsersBySession(*session)
-			if err := s.sessionService.DeleteSession(sessionName); err != nil {
-				context.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting session. " + err.Error(), "error": err})
-				context.Abort()
-				return
-			}
 		}
 	}
 	context.JSON(http.StatusOK, gin.H{"message": "Sessions deleted."})
 	return
 }
 
-func (s SessionController) Register(context *gin.Context) {
-	if context.Param("name") != "" {
-		session, err := s.sessionService.GetSessionByName(context.Param("name"))
-		if err != nil {
-			context.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving the session. " + err.Error(), "error": err})
-			context.Abort()
-			return
+// deleteSession cleans up the session's Lacework users and removes the session once they are all gone. A
+// session whose users could not all be deleted is kept cleanup_pending, with its retries restarted, for the
+// cleanup job. confirmLegacy allows matching the users of a session that predates registration records by
+// company suffix.
+func (s SessionController) deleteSession(session *models.Session, confirmLegacy bool) error {
+	if session.LifecycleState() != models.SESSION_LIFECYCLE_CLEANED {
+		session.CleanupAttempts = 0
+		if _, err := s.cleanupSession(session, 0, confirmLegacy); err != nil {
+			return err
 		}
+	}
+	return s.removeSession(session.Name)
+}
 
-		var registerUser RegisterUserReq
-		if err := context.ShouldBindJSON(&registerUser); err != nil {
-			context.JSON(http.StatusBadRequest, gin.H{"message": "Error binding request. " + err.Error(), "error": err.Error()})
-			return
-		}
+// AddCoHost shares the session with another principal, who may then view and edit it and its registrations.
+func (s SessionController) AddCoHost(context *gin.Context) {
+	s.updateCoHosts(context, s.sessionService.AddSessionCoHost)
+}
 
-		if session.InstanceType == INSTANCE_TYPE_DEFAULT {
-			session.LwUrl = defaultLwUrl
-			session.LwAccessKeyID = defaultLwAccessKeyID
-			session.LwSecretKey = defaultLwSecretKey
-			session.LwSubAccount = defaultLwSubAcct
-		}
+func (s SessionController) RemoveCoHost(context *gin.Context) {
+	s.updateCoHosts(context, s.sessionService.RemoveSessionCoHost)
+}
 
-		if accessToken, err := createAccessToken(session.LwUrl, session.LwAccessKeyID, session.LwSecretKey); err == nil {
-			if rspUsr, msg, err := addTeamMemberUser(session.Name, registerUser.Email, registerUser.FirstName, registerUser.LastName, registerUser.Company, session.LwUrl, accessToken, session.LwSubAccount); err != nil {
-				context.JSON(http.StatusInternalServerError, gin.H{"message": "Error adding team member. " + err.Error(), "error": err.Error() + " " + msg})
-				return
-			} else { //LACEWORK_USER_GROUP_READ_ONLY_USER
-				if session.LwUserGroup == "" {
-					session.LwUserGroup = "LACEWORK_USER_GROUP_READ_ONLY_USER"
-				}
-				if _, msg, err := addTeamUserToUserGroup(rspUsr.Data.UserGuid, session.LwUserGroup, session.LwUrl, accessToken, session.LwSubAccount); err != nil {
-					context.JSON(http.StatusInternalServerError, gin.H{"message": fmt.Sprintf("Error adding team member to group '%s'. %s %s", session.LwUserGroup, msg, err.Error()), "error": err.Error()})
-					return
-				}
-			}
-		} else {
-			context.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating access token. " + err.Error(), "error": err.Error()})
-			return
-		}
-		s.sessionService.IncrementSessionRegCount(session.Name)
-		context.JSON(http.StatusOK, registerUser)
+func (s SessionController) updateCoHosts(context *gin.Context, update func(string, string) (*models.Session, error)) {
+	session, err := manageableSession(s.sessionService, context, context.Param("name"))
+	if err != nil {
+		respondError(context, err)
 		return
 	}
-	context.JSON(http.StatusBadRequest, gin.H{"message": "Missing session name parameter."})
+	coHost := models.NormalizePrincipal(context.Param("coHost"))
+	if coHost == "" {
+		respondError(context, badRequest("Co-host cannot be blank.", nil))
+		return
+	}
+	newSession, err := update(session.Name, coHost)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	setETag(context, newSession)
+	context.JSON(http.StatusOK, models.NewSessionAdminView(*newSession))
 }
 
-func (s SessionController) StartCleanupCron() {
-	job := cron.New()
-	job.AddFunc("@hourly", func() {
-		log.Printf("Delete sessions cronjob started %s", time.Now().UTC())
-		//get all sessions
-		sessions, err := s.sessionService.GetAllSessions()
-		if err != nil {
-			log.Printf("Error retrieving sessions.: %s", err)
+// Register creates a Lacework user for an attendee. API keys scoped to register are trusted automation and skip
+// the rate limits and the challenge, but not the email rules.
+func (s SessionController) Register(context *gin.Context) {
+	principal := currentPrincipal(context)
+	trusted := principal != nil && principal.Method == auth.METHOD_API_KEY
+	if !trusted {
+		if err := s.registrationGuard.AllowClient(context); err != nil {
+			respondError(context, err)
 			return
 		}
-
-		for _, session := range sessions {
-			if session.ExpiresAt.Before(time.Now().UTC()) {
-				s.deleteTeamMemberUsersBySession(session)
-				//delete session
-				if err := s.sessionService.DeleteSession(session.Name); err != nil {
-					log.Printf("Error deleting session %s: %s", session.Name, err)
-					continue
-				}
-			}
-		}
-	})
-	log.Println("Started cron job to delete sessions and users.")
-	job.Start()
-
-}
-
-func createAccessToken(laceworkUrl string, accessKeyId string, secretKey string) (string, error) {
-	log.Printf("createAccessToken: laceworkUrl: %s, accessKeyId: %s, secretKey: %s", laceworkUrl, accessKeyId, secretKey)
-	requestPayload := AccessTokenReqPayload{
-		KeyId:      accessKeyId,
-		ExpiryTime: 86400,
 	}
-	if payloadBytes, err := json.Marshal(requestPayload); err == nil {
-		request, err := http.NewRequest(http.MethodPost, "https://"+laceworkUrl+"/api/v2/access/tokens", bytes.NewBuffer(payloadBytes))
-
-		if err != nil {
-			return "", err
-		}
-
-		request.Header.Add("X-LW-UAKS", secretKey)
-		request.Header.Add("content-type", "application/json")
-
-		if rsp, err := http.DefaultClient.Do(request); err == nil {
-			defer rsp.Body.Close()
-			rspData := AccessTokenRspPayload{}
-			if err := json.NewDecoder(rsp.Body).Decode(&rspData); err == nil {
-				log.Printf("AccessTokenRspPayload: %+v", rspData)
-			} else {
-				log.Printf("Unable to get response body: %v", err)
-				return "", err
-			}
-			if rsp.StatusCode == http.StatusCreated {
-				return rspData.Token, nil
-			} else {
-				return "", errors.New(fmt.Sprintf("Failed to get access token. Resp status is %d", rsp.Status))
-			}
-		} else {
-			return "", err
-		}
-	} else {
-		return "", err
+	session, err := s.sessionService.GetSessionByName(context.Param("name"))
+	if err != nil {
+		respondError(context, err)
+		return
 	}
-}
 
-func addTeamMemberUser(session string, email string, firstName string, lastName string, company string, laceworkUrl string, accessToken string, subAccountName string) (*PostTeamUsersRsp, string, error) {
-	requestPayload := PostTeamUsersReq{
-		Type:    "StandardUser",
-		Name:    firstName + " " + lastName,
-		Email:   email,
-		Company: company + "-" + session,
-	}
-
-	if payloadBytes, err := json.Marshal(requestPayload); err == nil {
-		if rsp, err := sendApiReq(http.MethodPost, laceworkUrl, "/api/v2/TeamUsers", accessToken, bytes.NewBuffer(payloadBytes), subAccountName); err == nil {
-			defer rsp.Body.Close()
-			if body, err := io.ReadAll(rsp.Body); err != nil {
-				return nil, fmt.Sprintf("Problem reading response body %v", err), err
-			} else {
-				var usrRsp PostTeamUsersRsp
-				if errMarsh := json.Unmarshal(body, &usrRsp); errMarsh != nil {
-					return nil, fmt.Sprintf("Problem unmarshalling %v", errMarsh), errMarsh
-				} else {
-					if rsp.StatusCode == http.StatusCreated {
-						return &usrRsp, rsp.Status, nil
-					} else {
-						return nil, rsp.Status, errors.New(fmt.Sprintf("User with this email address already exists."))
-					}
-				}
-			}
-		} else {
-			return nil, fmt.Sprintf("Problem sending request %v", err), err
+	var registerUser RegisterUserReq
+	if err := context.ShouldBindJSON(&registerUser); err != nil {
+		respondError(context, badRequest("Error binding request.", err))
+		return
+	}
+	if err := s.registrationGuard.CheckEmail(*session, registerUser.Email); err != nil {
+		respondError(context, err)
+		return
+	}
+	if !trusted {
+		if err := s.registrationGuard.VerifyChallenge(context, registerUser.ChallengeToken); err != nil {
+			respondError(context, err)
+			return
 		}
-	} else {
-		return nil, fmt.Sprintf("Problem marshalling request %v", err), err
 	}
-}
-
-func addTeamUserToUserGroup(userGuid string, userGroup string, laceworkUrl string, accessToken string, subAccountName string) (*PostUserGroupsRsp, string, error) {
-	requestPayload := PostUserGroupsReq{
-		UserGuids: []string{userGuid},
+	//access rules hold for API keys too, since they are about who may attend rather than who is calling
+	if err := checkRegistrationAccess(s.accessService, *session, registerUser.Email, registerUser.AccessCode); err != nil {
+		respondError(context, err)
+		return
 	}
-
-	if payloadBytes, err := json.Marshal(requestPayload); err == nil {
-		if rsp, err := sendApiReq(http.MethodPost, laceworkUrl, "/api/v2/UserGroups/"+userGroup+"/addUsers", accessToken, bytes.NewBuffer(payloadBytes), subAccountName); err == nil {
-			defer rsp.Body.Close()
-			if body, err := io.ReadAll(rsp.Body); err != nil {
-				return nil, fmt.Sprintf("Problem reading response body %v", err), err
-			} else {
-				var usrGrpRsp PostUserGroupsRsp
-				if errMarsh := json.Unmarshal(body, &usrGrpRsp); errMarsh != nil {
-					return nil, fmt.Sprintf("Problem unmarshalling %v", errMarsh), errMarsh
-				} else {
-					if rsp.StatusCode == http.StatusOK {
-						return &usrGrpRsp, rsp.Status, nil
-					} else {
-						return nil, rsp.Status, errors.New(fmt.Sprintf("Failed sending add team member to user group request. Response status is %d", rsp.StatusCode))
-					}
-				}
-			}
-		} else {
-			return nil, fmt.Sprintf("Problem sending request %v", err), err
+	accessCode := models.CanonicalAccessCode(registerUser.AccessCode)
+	registerUser.ChallengeToken, registerUser.AccessCode = "", ""
+	if !trusted {
+		if err := s.registrationGuard.AllowSession(context, session.Name); err != nil {
+			respondError(context, err)
+			return
 		}
-	} else {
-		return nil, fmt.Sprintf("Problem marshalling request %v", err), err
 	}
-}
 
-func (s SessionController) deleteTeamMemberUsersBySession(session models.Session) (string, error) {
-	if session.InstanceType == INSTANCE_TYPE_DEFAULT {
-		session.LwUrl = defaultLwUrl
-		session.LwAccessKeyID = defaultLwAccessKeyID
-		session.LwSecretKey = defaultLwSecretKey
-		session.LwSubAccount = defaultLwSubAcct
-	}
-	if accessToken, err := createAccessToken(session.LwUrl, session.LwAccessKeyID, session.LwSecretKey); err == nil {
-		if usrsRsp, msg, err := getSessionTeamMemberUsers(session.Name, session.LwUrl, accessToken, session.LwSubAccount); err == nil {
-			delCt := 0
-			for _, usr := range usrsRsp.Data {
-				if delRsp, err := deleteTeamMemberUser(usr.UserGuid, session.LwUrl, accessToken, session.LwSubAccount); err != nil {
-					log.Printf("Unable to delete user %v %v", usr, err)
+	//LACEWORK_USER_GROUP_READ_ONLY_USER
+	if session.LwUserGroup == "" {
+		session.LwUserGroup = "LACEWORK_USER_GROUP_READ_ONLY_USER"
+	}
+	registration := &models.Registration{
+		Session:   session.Name,
+		Email:     registerUser.Email,
+		FirstName: registerUser.FirstName,
+		LastName:  registerUser.LastName,
+		Company:   registerUser.Company,
+		UserGroup: session.LwUserGroup,
+		Status:    models.REGISTRATION_STATUS_PENDING,
+	}
+	registration.InstanceType, registration.LwUrl = session.InstanceType, instanceForSession(*session).Url
+	if trusted {
+		registration.RegisteredBy = principal.ID()
+	}
+	//held until the registration is recorded as complete, so that neither a second request for the same email
+	//nor the reconciler works on it meanwhile
+	release, locked, err := lockRegistration(s.leaseService, session.Name, registerUser.Email)
+	if err != nil {
+		respondError(context, err)
+		return
+	}
+	if !locked {
+		respondError(context, fmt.Errorf("%w: a registration for this email is already in progress", services.ErrConflict))
+		return
+	}
+	defer release()
+	//read before AddRegistration replaces it, to tell whether an existing user was created by this session
+	previous, err := s.registrationService.GetRegistration(session.Name, registerUser.Email)
+	if err != nil && !errors.Is(err, services.ErrRegistrationNotFound) {
+		respondError(context, err)
+		return
+	}
+	instance := instanceForSession(*session)
+	var accessToken string
+
+	//every step is undone if a later one fails. Registrations left pending by a crash are finished by the
+	//RegistrationReconciler.
+	var steps []sagaStep
+	if session.AccessModeState() == models.SESSION_ACCESS_ONE_TIME_CODE {
+		steps = append(steps, sagaStep{
+			name:   "redeem access code",
+			action: func() error { return s.accessService.RedeemAccessCode(session.Name, accessCode, registerUser.Email) },
+			compensate: func(error) error {
+				return s.accessService.ReleaseAccessCode(session.Name, accessCode, registerUser.Email)
+			},
+		})
+	}
+	steps = append(steps, []sagaStep{
+		{
+			name:   "reserve seat",
+			action: func() error { return s.sessionService.ReserveSessionSeat(session.Name) },
+			compensate: func(error) error {
+				return s.sessionService.ReleaseSessionSeat(session.Name)
+			},
+		},
+		{
+			name: "record registration",
+			action: func() error {
+				_, err := s.registrationService.AddRegistration(registration)
+				return err
+			},
+			compensate: func(cause error) error {
+				if registration.Status == models.REGISTRATION_STATUS_PENDING {
+					registration.Status = models.REGISTRATION_STATUS_FAILED
+				}
+				if registration.Error == "" {
+					registration.Error = cause.Error()
+				}
+				return s.registrationService.UpdateRegistration(registration)
+			},
+		},
+		{
+			name: "create team user",
+			action: func() error {
+				token, err := s.laceworkClient.CreateAccessToken(instance)
+				if err != nil {
+					return laceworkError("Error creating access token.", err)
+				}
+				accessToken = token.Token
+				rspUsr, msg, err := s.laceworkClient.AddTeamMemberUser(instance, accessToken, session.Name, registerUser.Email, registerUser.FirstName, registerUser.LastName, registerUser.Company)
+				if errors.Is(err, lacework.ErrUserExists) {
+					//reuse the existing account, which cleanup must keep unless this session created it
+					existingUsr, msg, err := s.laceworkClient.GetTeamUserByEmail(instance, accessToken, registerUser.Email)
+					if err != nil {
+						return laceworkError("Error looking up existing team member.", fmt.Errorf("%w %s", err, msg))
+					}
+					registration.UserGuid = existingUsr.UserGuid
+					registration.PreExisting = !createdForSession(previous, existingUsr.UserGuid)
+					log.Printf("Reusing existing user %s for session %s", existingUsr.UserGuid, session.Name)
+				} else if err != nil {
+					return laceworkError("Error adding team member.", fmt.Errorf("%w %s", err, msg))
 				} else {
-					log.Printf("Deleted user %v %s", usr, delRsp)
-					delCt++
+					registration.UserGuid = rspUsr.Data.UserGuid
 				}
-			}
-			return fmt.Sprintf("Deleted %d users", delCt), nil
-		} else {
-			return fmt.Sprintf("Problem unmarshalling %s %v", msg, err), err
-		}
-	} else {
-		//access token issue
-		return fmt.Sprintf("Error creating access token %v", err), err
+				if err := s.registrationService.UpdateRegistration(registration); err != nil {
+					log.Printf("Error recording user %s for session %s: %s", registration.UserGuid, session.Name, err)
+				}
+				return nil
+			},
+			compensate: func(error) error {
+				return rollbackTeamUser(s.laceworkClient, instance, accessToken, registration)
+			},
+		},
+		{
+			name: "add team user to group",
+			action: func() error {
+				if msg, err := addTeamUserToUserGroup(s.laceworkClient, instance, accessToken, registration.UserGuid, session.LwUserGroup, groupAddAttempts); err != nil {
+					return laceworkError(fmt.Sprintf("Error adding team member to group '%s'.", session.LwUserGroup), fmt.Errorf("%w %s", err, msg))
+				}
+				return nil
+			},
+		},
+	}...)
+	err = runSaga(func() string { return "Register " + registrationRef(registration) }, steps)
+	if err != nil {
+		respondError(context, err)
+		return
 	}
-}
 
-func deleteTeamMemberUser(userGuid string, laceworkUrl string, accessToken string, subAccountName string) (string, error) {
-	if rsp, err := sendApiReq(http.MethodDelete, laceworkUrl, "/api/v2/TeamUsers/"+userGuid, accessToken, nil, subAccountName); err == nil {
-		defer rsp.Body.Close()
-		if rsp.StatusCode == http.StatusNoContent {
-			return rsp.Status, nil
-		} else {
-			return rsp.Status, errors.New(fmt.Sprintf("Failed sending delete team member request. Response status is %d", rsp.StatusCode))
-		}
-	} else {
-		return fmt.Sprintf("Problem sending request %v", err), err
+	registration.Status = models.REGISTRATION_STATUS_REGISTERED
+	if err := s.registrationService.UpdateRegistration(registration); err != nil {
+		log.Printf("Error recording registration of %s for session %s: %s", registration.UserGuid, session.Name, err)
 	}
+	context.JSON(http.StatusOK, registerUser)
+	return
 }
 
-func getSessionTeamMemberUsers(session string, laceworkUrl string, accessToken string, subAccountName string) (*GetTeamUsersRsp, string, error) {
-	if rsp, err := sendApiReq(http.MethodGet, laceworkUrl, "/api/v2/TeamUsers/", accessToken, nil, subAccountName); err == nil {
-		defer rsp.Body.Close()
-		if body, err := io.ReadAll(rsp.Body); err != nil {
-			return nil, fmt.Sprintf("Problem reading response body %v", err), err
-		} else if rsp.StatusCode == http.StatusOK {
-			var usrsRsp GetTeamUsersRsp
-			if errMarsh := json.Unmarshal(body, &usrsRsp); errMarsh != nil {
-				return nil, fmt.Sprintf("Problem unmarshalling %v", errMarsh), errMarsh
-			} else {
-				var sessUsrs GetTeamUsersRsp
-				for _, usr := range usrsRsp.Data {
-					if strings.HasSuffix(usr.Company, session) {
-						sessUsrs.Data = append(sessUsrs.Data, usr)
-					}
-				}
-				log.Printf("Filtered users for %s %v", session, sessUsrs.Data)
-				return &sessUsrs, rsp.Status, nil
-			}
-		} else {
-			return nil, rsp.Status, errors.New(fmt.Sprintf("Failed sending add team member to user group request. Response status is %d", rsp.StatusCode))
-		}
-	} else {
-		return nil, fmt.Sprintf("Problem sending request %v", err), err
-	}
+func setETag(context *gin.Context, session *models.Session) {
+	context.Header("ETag", fmt.Sprintf(`"%d"`, session.Version))
 }
 
-func sendApiReq(method string, laceworkUrl string, api string, accessToken string, payload io.Reader, subAccountName string) (*http.Response, error) {
-	if request, err := http.NewRequest(method, "https://"+laceworkUrl+api, payload); err != nil {
-		log.Printf("Error creating API post request: %v %v\n", err, payload)
-		return nil, err
-	} else {
-		request.Header.Add("Authorization", accessToken)
-		request.Header.Add("content-type", "application/json")
-
-		if subAccountName != "" {
-			request.Header.Add("Account-Name", subAccountName)
-		}
-
-		requestDump, err := httputil.DumpRequest(request, true)
-		if err != nil {
-			log.Println(err)
+// instanceForSession resolves the Lacework instance for a session, substituting the default instance
+// credentials for DEFAULT sessions.
+func instanceForSession(session models.Session) lacework.Instance {
+	if session.InstanceType == INSTANCE_TYPE_DEFAULT {
+		return lacework.Instance{
+			Url:         defaultLwUrl,
+			AccessKeyID: defaultLwAccessKeyID,
+			SecretKey:   defaultLwSecretKey,
+			SubAccount:  defaultLwSubAcct,
 		}
-		log.Printf("Sending request: %s", string(requestDump))
-
-		return http.DefaultClient.Do(request)
+	}
+	return lacework.Instance{
+		Url:         session.LwUrl,
+		AccessKeyID: session.LwAccessKeyID,
+		SecretKey:   session.LwSecretKey,
+		SubAccount:  session.LwSubAccount,
 	}
 }
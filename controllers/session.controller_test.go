@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/lacework/laceworktest"
+	"github.com/jefferyfry/eventengine/models"
+	"github.com/jefferyfry/eventengine/services"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUserGroup = "LACEWORK_USER_GROUP_READ_ONLY_USER"
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+var testAdmin = &auth.Principal{Subject: "admin", Email: "admin@example.com", Role: auth.ROLE_ADMIN, Method: auth.METHOD_OIDC}
+
+// sessionFixture serves the session routes over the in-memory stores and a fake Lacework. Requests are made
+// as principal, which may be changed between requests. A nil principal is an anonymous attendee.
+type sessionFixture struct {
+	fake                *laceworktest.Server
+	sessionService      services.SessionService
+	registrationService services.RegistrationService
+	accessService       services.AccessService
+	controller          SessionController
+	router              *gin.Engine
+	principal           *auth.Principal
+}
+
+func newSessionFixture(t *testing.T, guardConfig RegistrationGuardConfig) *sessionFixture {
+	t.Helper()
+	backoff := groupAddBackoff
+	groupAddBackoff = 0
+	fake := laceworktest.NewServer()
+	t.Cleanup(func() {
+		groupAddBackoff = backoff
+		fake.Close()
+	})
+
+	f := &sessionFixture{
+		fake:                fake,
+		sessionService:      services.NewSessionServiceMemory(),
+		registrationService: services.NewRegistrationServiceMemory(),
+		accessService:       services.NewAccessServiceMemory(),
+		principal:           testAdmin,
+	}
+	f.controller = NewSessionController(f.sessionService, f.registrationService, f.accessService, services.NewLeaseServiceMemory(),
+		lacework.NewCachingClient(lacework.NewClient(fake.Config()), 0), NewRegistrationGuard(guardConfig))
+
+	f.router = gin.New()
+	f.router.Use(ErrorHandler(), func(context *gin.Context) {
+		if f.principal != nil {
+			context.Set(principalKey, f.principal)
+		}
+	})
+	viewer := RequireRoleOrScope(auth.ROLE_VIEWER, auth.SCOPE_SESSIONS_READ)
+	eventManager := RequireRole(auth.ROLE_EVENT_MANAGER)
+	sessions := f.router.Group("/api/sessions")
+	sessions.GET("/", viewer, f.controller.GetSessions)
+	sessions.GET("/:name", viewer, f.controller.GetSessionByName)
+	sessions.POST("/", RequireRoleOrScope(auth.ROLE_EVENT_MANAGER, auth.SCOPE_SESSIONS_CREATE), f.controller.AddSession)
+	sessions.PUT("/:name", eventManager, f.controller.UpdateSession)
+	sessions.PATCH("/:name", eventManager, f.controller.PatchSession)
+	sessions.DELETE("/:name", eventManager, f.controller.DeleteSession)
+	register := f.router.Group("/api/register")
+	register.GET("/:name", f.controller.GetPublicSession)
+	register.POST("/:name", RequireScopeForAPIKeys(auth.SCOPE_REGISTER), f.controller.Register)
+	return f
+}
+
+// addSession stores a CUSTOM session on the fake Lacework, expiring in an hour unless it says otherwise.
+func (f *sessionFixture) addSession(t *testing.T, session models.Session) {
+	t.Helper()
+	session.InstanceType = INSTANCE_TYPE_CUSTOM
+	session.LwUrl, session.LwAccessKeyID, session.LwSecretKey = "demo.lacework.net", "KEY", "SECRET"
+	session.LwUserGroup = testUserGroup
+	if session.ExpiresAt.IsZero() {
+		session.ExpiresAt = time.Now().Add(time.Hour)
+	}
+	if _, err := f.sessionService.AddSession(&session); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// do sends body as JSON. headers are name and value pairs.
+func (f *sessionFixture) do(method string, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	request := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	f.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// register posts an attendee's registration.
+func (f *sessionFixture) register(session string, email string, challengeToken string) *httptest.ResponseRecorder {
+	return f.do(http.MethodPost, "/api/register/"+session,
+		RegisterUserReq{Email: email, FirstName: "Ann", LastName: "Lee", Company: "Acme", ChallengeToken: challengeToken})
+}
+
+// envelope decodes a JSON object response.
+func envelope(recorder *httptest.ResponseRecorder) map[string]interface{} {
+	var body map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	return body
+}
+
+func TestSessionHandlers(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	create := models.SessionCreateReq{
+		Name:          "demo",
+		InstanceType:  INSTANCE_TYPE_CUSTOM,
+		LwUrl:         "demo.lacework.net",
+		LwAccessKeyID: "ACCESS_KEY_ID_1234",
+		LwSecretKey:   "_0123456789abcdef",
+		LwUserGroup:   testUserGroup,
+		ExpiresAt:     expiresAt,
+	}
+	update := models.SessionUpdateReq{
+		Version:      1,
+		Name:         "demo",
+		InstanceType: INSTANCE_TYPE_CUSTOM,
+		LwUrl:        "demo.lacework.net",
+		LwUserGroup:  "LACEWORK_USER_GROUP_POWER_USER",
+		ExpiresAt:    expiresAt.Add(time.Hour),
+	}
+	invalid := create
+	invalid.Name = "a b"
+
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		body       interface{}
+		attendee   bool
+		wantStatus int
+		wantETag   string
+		check      func(t *testing.T, body map[string]interface{})
+	}{
+		{
+			name: "create", method: http.MethodPost, path: "/api/sessions/", body: create,
+			wantStatus: http.StatusOK, wantETag: `"1"`,
+			check: func(t *testing.T, body map[string]interface{}) {
+				if body["createdBy"] != "admin@example.com" || body["owner"] != "admin@example.com" {
+					t.Errorf("createdBy and owner = %v and %v, want the caller", body["createdBy"], body["owner"])
+				}
+				if body["lwSecretKeySet"] != true || body["lwSecretKey"] != nil || body["lwSecretKeyHint"] != nil {
+					t.Errorf("secret key fields = %v", body)
+				}
+			},
+		},
+		{name: "create a duplicate", method: http.MethodPost, path: "/api/sessions/", body: create, wantStatus: http.StatusConflict},
+		{name: "create with an invalid name", method: http.MethodPost, path: "/api/sessions/", body: invalid, wantStatus: http.StatusUnprocessableEntity},
+		{name: "get", method: http.MethodGet, path: "/api/sessions/demo", wantStatus: http.StatusOK, wantETag: `"1"`},
+		{name: "get a missing session", method: http.MethodGet, path: "/api/sessions/missing", wantStatus: http.StatusNotFound},
+		{
+			name: "update", method: http.MethodPut, path: "/api/sessions/demo", body: update,
+			wantStatus: http.StatusOK, wantETag: `"2"`,
+			check: func(t *testing.T, body map[string]interface{}) {
+				if body["lwUserGroup"] != "LACEWORK_USER_GROUP_POWER_USER" || body["lwSecretKeySet"] != true {
+					t.Errorf("updated session = %v, want the new group and the old secret", body)
+				}
+			},
+		},
+		{
+			name: "public view", method: http.MethodGet, path: "/api/register/demo", attendee: true, wantStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]interface{}) {
+				if body["lwAccessKeyIDHint"] != nil || body["lwUrl"] != nil || body["lwSecretKeySet"] != nil {
+					t.Errorf("public view = %v, want no instance details", body)
+				}
+			},
+		},
+		{
+			name: "register", method: http.MethodPost, path: "/api/register/demo", attendee: true,
+			body:       RegisterUserReq{Email: "ann@example.com", FirstName: "Ann", LastName: "Lee", Company: "Acme"},
+			wantStatus: http.StatusOK,
+		},
+		{name: "attendees cannot list sessions", method: http.MethodGet, path: "/api/sessions/", attendee: true, wantStatus: http.StatusUnauthorized},
+		{name: "delete", method: http.MethodDelete, path: "/api/sessions/demo", wantStatus: http.StatusOK},
+		{name: "get after delete", method: http.MethodGet, path: "/api/sessions/demo", wantStatus: http.StatusNotFound},
+	}
+	for _, step := range steps {
+		f.principal = testAdmin
+		if step.attendee {
+			f.principal = nil
+		}
+		recorder := f.do(step.method, step.path, step.body)
+		if recorder.Code != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, recorder.Code, step.wantStatus, recorder.Body)
+		}
+		if step.wantETag != "" && recorder.Header().Get("ETag") != step.wantETag {
+			t.Errorf("%s: ETag = %s, want %s", step.name, recorder.Header().Get("ETag"), step.wantETag)
+		}
+		if step.check != nil {
+			step.check(t, envelope(recorder))
+		}
+
+		switch step.name {
+		case "register":
+			if users := f.fake.TeamUsers(); len(users) != 1 || users[0].Company != "Acme-demo" {
+				t.Errorf("team users after register = %v, want one of company Acme-demo", users)
+			}
+		case "delete":
+			if users := f.fake.TeamUsers(); len(users) != 0 {
+				t.Errorf("team users after delete = %v, want none", users)
+			}
+			if registrations, _ := f.registrationService.GetRegistrationsBySession("demo"); len(registrations) != 0 {
+				t.Errorf("registrations after delete = %v, want none", registrations)
+			}
+		}
+	}
+}
+
+func TestRegisterLogsNoEmail(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.addSession(t, models.Session{Name: "demo"})
+	f.fake.FailNext(http.MethodPost, "/api/v2/UserGroups", http.StatusInternalServerError, groupAddAttempts)
+	f.principal = nil
+
+	var out bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&out)
+	if recorder := f.register("demo", "ann@example.com", ""); recorder.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502: %s", recorder.Code, recorder.Body)
+	}
+	if strings.Contains(out.String(), "ann@example.com") {
+		t.Errorf("logged %q, which names the attendee's email", out.String())
+	}
+	if !strings.Contains(out.String(), "Register user ") {
+		t.Errorf("logged %q, want the failed registration named by its user", out.String())
+	}
+}
+
+func TestPatchSessionPreconditions(t *testing.T) {
+	group := "LACEWORK_USER_GROUP_POWER_USER"
+	tests := []struct {
+		name       string
+		body       models.SessionPatchReq
+		ifMatch    string
+		wantStatus int
+		wantCode   string
+		wantETag   string
+	}{
+		{name: "no version", body: models.SessionPatchReq{LwUserGroup: &group}, wantStatus: http.StatusPreconditionRequired, wantCode: "precondition_required"},
+		{name: "stale If-Match", body: models.SessionPatchReq{LwUserGroup: &group}, ifMatch: `"2"`, wantStatus: http.StatusPreconditionFailed, wantCode: "version_conflict"},
+		{name: "stale version", body: models.SessionPatchReq{LwUserGroup: &group, Version: 2}, wantStatus: http.StatusPreconditionFailed, wantCode: "version_conflict"},
+		{name: "invalid If-Match", body: models.SessionPatchReq{LwUserGroup: &group}, ifMatch: `"abc"`, wantStatus: http.StatusBadRequest},
+		{name: "If-Match", body: models.SessionPatchReq{LwUserGroup: &group}, ifMatch: `"1"`, wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "weak If-Match", body: models.SessionPatchReq{LwUserGroup: &group}, ifMatch: `W/"1"`, wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "If-Match overrides the version", body: models.SessionPatchReq{LwUserGroup: &group, Version: 2}, ifMatch: `"1"`, wantStatus: http.StatusOK, wantETag: `"2"`},
+		{name: "version", body: models.SessionPatchReq{LwUserGroup: &group, Version: 1}, wantStatus: http.StatusOK, wantETag: `"2"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newSessionFixture(t, RegistrationGuardConfig{})
+			f.addSession(t, models.Session{Name: "demo"})
+
+			var headers []string
+			if test.ifMatch != "" {
+				headers = []string{"If-Match", test.ifMatch}
+			}
+			recorder := f.do(http.MethodPatch, "/api/sessions/demo", test.body, headers...)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body)
+			}
+			if test.wantCode != "" && envelope(recorder)["code"] != test.wantCode {
+				t.Errorf("code = %v, want %s", envelope(recorder)["code"], test.wantCode)
+			}
+			if recorder.Header().Get("ETag") != test.wantETag {
+				t.Errorf("ETag = %q, want %q", recorder.Header().Get("ETag"), test.wantETag)
+			}
+			session, _ := f.sessionService.GetSessionByName("demo")
+			if changed := session.LwUserGroup == group; changed != (test.wantStatus == http.StatusOK) {
+				t.Errorf("group = %s after a %d", session.LwUserGroup, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestPatchSessionRename(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.addSession(t, models.Session{Name: "demo"})
+	f.addSession(t, models.Session{Name: "registered"})
+	f.registrationService.AddRegistration(&models.Registration{Session: "registered", Email: "ann@example.com"})
+
+	renamed, taken := "renamed", "registered"
+	if recorder := f.do(http.MethodPatch, "/api/sessions/demo", models.SessionPatchReq{Name: &taken, Version: 1}); recorder.Code != http.StatusConflict {
+		t.Errorf("renaming onto an existing session: status = %d, want 409: %s", recorder.Code, recorder.Body)
+	}
+	if recorder := f.do(http.MethodPatch, "/api/sessions/registered", models.SessionPatchReq{Name: &renamed, Version: 1}); recorder.Code != http.StatusConflict {
+		t.Errorf("renaming a session with registrations: status = %d, want 409: %s", recorder.Code, recorder.Body)
+	}
+	if recorder := f.do(http.MethodPatch, "/api/sessions/demo", models.SessionPatchReq{Name: &renamed, Version: 1}); recorder.Code != http.StatusOK {
+		t.Fatalf("renaming: status = %d, want 200: %s", recorder.Code, recorder.Body)
+	}
+	if _, err := f.sessionService.GetSessionByName("renamed"); err != nil {
+		t.Errorf("renamed session: %v", err)
+	}
+}
+
+// failingAccessService fails to move the records of renamed sessions.
+type failingAccessService struct {
+	services.AccessService
+}
+
+func (failingAccessService) RenameSession(oldName string, newName string) error {
+	return errors.New("unavailable")
+}
+
+func TestMoveSessionDataRollsBack(t *testing.T) {
+	f := newSessionFixture(t, RegistrationGuardConfig{})
+	f.addSession(t, models.Session{Name: "demo"})
+	//a registration that arrived while the session was being renamed
+	f.registrationService.AddRegistration(&models.Registration{Session: "demo", Email: "ann@example.com"})
+	renamed := "renamed"
+	if _, err := f.sessionService.PatchSession("demo", &models.SessionPatchReq{Name: &renamed}); err != nil {
+		t.Fatal(err)
+	}
+
+	controller := f.controller
+	controller.accessService = failingAccessService{f.accessService}
+	if err := controller.moveSessionData("demo", "renamed"); err == nil {
+		t.Fatal("moveSessionData() succeeded, want the access service's error")
+	}
+	if _, err := f.sessionService.GetSessionByName("demo"); err != nil {
+		t.Errorf("session after rollback: %v, want it back under its old name", err)
+	}
+	if registrations, _ := f.registrationService.GetRegistrationsBySession("demo"); len(registrations) != 1 {
+		t.Errorf("registrations under the old name = %v, want them moved back", registrations)
+	}
+	if registrations, _ := f.registrationService.GetRegistrationsBySession("renamed"); len(registrations) != 0 {
+		t.Errorf("registrations under the new name = %v, want none", registrations)
+	}
+}
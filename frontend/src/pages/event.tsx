@@ -21,15 +21,115 @@ type SessionParams = {
     sessionName: string;
 };
 
+interface PublicSession {
+    name: string;
+    expiresAt: string;
+    seatsLeft?: number;
+    state: string;
+    open: boolean;
+    accessMode: string;
+    challengeSiteKey?: string;
+}
+
+// challengeProviders are the widgets that work with the backend's siteverify challenge. They all render
+// explicitly with render(container, {sitekey, callback}). REACT_APP_CHALLENGE_PROVIDER picks one.
+const challengeProviders: { [name: string]: { script: string, global: string, ready?: boolean } } = {
+    turnstile: {script: "https://challenges.cloudflare.com/turnstile/v0/api.js?render=explicit", global: "turnstile"},
+    hcaptcha: {script: "https://js.hcaptcha.com/1/api.js?render=explicit", global: "hcaptcha"},
+    recaptcha: {script: "https://www.google.com/recaptcha/api.js?render=explicit", global: "grecaptcha", ready: true},
+};
+
+// ChallengeWidget shows the challenge for siteKey and reports its token, or "" once the token expires. The stub
+// challenge of local development asks for its token instead.
+function ChallengeWidget({siteKey, onToken}: { siteKey: string, onToken: (token: string) => void }) {
+    const container = React.useRef<HTMLDivElement>(null);
+
+    React.useEffect(() => {
+        const provider = challengeProviders[process.env.REACT_APP_CHALLENGE_PROVIDER || "turnstile"];
+        if (siteKey === "stub" || provider === undefined) {
+            return;
+        }
+        let cancelled = false;
+        const render = () => {
+            const widget = (window as any)[provider.global];
+            const show = () => {
+                if (!cancelled && container.current !== null) {
+                    widget.render(container.current, {
+                        sitekey: siteKey,
+                        callback: onToken,
+                        "expired-callback": () => onToken(""),
+                    });
+                }
+            };
+            if (provider.ready) {
+                widget.ready(show);
+            } else {
+                show();
+            }
+        };
+        let script = document.querySelector<HTMLScriptElement>(`script[src="${provider.script}"]`);
+        if (script === null) {
+            script = document.createElement("script");
+            script.src = provider.script;
+            script.async = true;
+            document.head.appendChild(script);
+        }
+        if ((window as any)[provider.global] !== undefined) {
+            render();
+        } else {
+            script.addEventListener("load", render);
+        }
+        return () => {
+            cancelled = true;
+            script?.removeEventListener("load", render);
+        };
+    }, [siteKey, onToken]);
+
+    if (siteKey === "stub") {
+        return (
+            <TextField
+                margin="dense"
+                id="challengeToken"
+                label="Challenge Token"
+                type="text"
+                fullWidth
+                onChange={(event) => onToken(event.target.value)}
+                variant="standard"
+            />
+        );
+    }
+    return <div ref={container} style={{marginTop: 10, marginBottom: 10}}/>;
+}
+
 export default function Event() {
     const [email, setEmail] = React.useState('');
     const [firstName, setFirstName] = React.useState('');
     const [lastName, setLastName] = React.useState('');
     const [company, setCompany] = React.useState('');
+    const [accessCode, setAccessCode] = React.useState('');
+    const [emailError, setEmailError] = React.useState('');
+    const [accessCodeError, setAccessCodeError] = React.useState('');
     const [openAddMessage, setOpenAddMessage] = React.useState(false);
     const [addMessage, setAddMessage] = React.useState("");
+    const [publicSession, setPublicSession] = React.useState<PublicSession | null>(null);
+    const [challengeToken, setChallengeToken] = React.useState('');
+    //a token is only good for one attempt, so every failed attempt shows a fresh challenge
+    const [challengeAttempt, setChallengeAttempt] = React.useState(0);
     const {sessionName} = useParams<SessionParams>();
 
+    React.useEffect(() => {
+        fetch(process.env.REACT_APP_API_URL+"/api/register/" + sessionName, {
+            method: 'GET',
+            headers: {
+                Accept: 'application/json',
+            }
+        }).then((response) => {
+            if (response.ok) {
+                response.json().then((data: PublicSession) => setPublicSession(data));
+            }
+        });
+    }, [sessionName]);
+
     const handleSubmit = () => {
         addTeamMemberUser();
     };
@@ -46,13 +146,22 @@ export default function Event() {
             headers: {
                 Accept: 'application/json',
             },
-            body: JSON.stringify({email: email, firstName: firstName, lastName: lastName, company: company})
+            body: JSON.stringify({email: email, firstName: firstName, lastName: lastName, company: company, accessCode: accessCode, challengeToken: challengeToken})
         });
 
         if (!response.ok) {
+            setChallengeToken('');
+            setChallengeAttempt(challengeAttempt + 1);
             response.json().then((data) => {
-                setAddMessage(data.message);
-                setOpenAddMessage(true);
+                //the attendee can correct these, so they stay on the form next to the field
+                if (data.code === "access_code_invalid") {
+                    setAccessCodeError(data.message);
+                } else if (data.code === "not_invited") {
+                    setEmailError(data.message);
+                } else {
+                    setAddMessage(data.message);
+                    setOpenAddMessage(true);
+                }
             })
         } else {
             setAddMessage("Check your email for access instructions!");
@@ -75,6 +184,12 @@ export default function Event() {
             <Paper sx={{width: '100%', mb: 2}}>
                 <Container maxWidth={"sm"} style={{padding: 20}}>
                     <div>Enter your email address, name & company to get access to Lacework!</div>
+                    {publicSession !== null && !publicSession.open &&
+                        <div>{publicSession.state === "full" ? "Sorry, this event is full." : "Registration for this event is closed."}</div>}
+                    {publicSession !== null && publicSession.open && publicSession.seatsLeft !== undefined &&
+                        <div>{publicSession.seatsLeft} seats left.</div>}
+                    {publicSession !== null && publicSession.accessMode === "invite" &&
+                        <div>This event is invite only. Use the email address you were invited with.</div>}
                     <TextField
                         autoFocus
                         margin="dense"
@@ -82,9 +197,12 @@ export default function Event() {
                         label="Email"
                         type="email"
                         fullWidth
-                        error={email.length < 4}
-                        helperText={email.length < 4 ? 'Min length > 3' : ''}
-                        onChange={(event) => setEmail(event.target.value)}
+                        error={email.length < 4 || emailError !== ''}
+                        helperText={email.length < 4 ? 'Min length > 3' : emailError}
+                        onChange={(event) => {
+                            setEmail(event.target.value);
+                            setEmailError('');
+                        }}
                         variant="standard"
                     />
                     <TextField
@@ -123,6 +241,23 @@ export default function Event() {
                         onChange={(event) => setCompany(event.target.value)}
                         variant="standard"
                     />
+                    {publicSession !== null && (publicSession.accessMode === "code" || publicSession.accessMode === "one_time_code") &&
+                        <TextField
+                            margin="dense"
+                            id="accessCode"
+                            label="Access Code"
+                            type="text"
+                            fullWidth
+                            error={accessCodeError !== ''}
+                            helperText={accessCodeError}
+                            onChange={(event) => {
+                                setAccessCode(event.target.value);
+                                setAccessCodeError('');
+                            }}
+                            variant="standard"
+                        />}
+                    {publicSession?.challengeSiteKey &&
+                        <ChallengeWidget key={challengeAttempt} siteKey={publicSession.challengeSiteKey} onToken={setChallengeToken}/>}
                     <Dialog open={openAddMessage}>
                         <DialogContent>
                             <DialogContentText>
@@ -134,7 +269,8 @@ export default function Event() {
                         </DialogActions>
                     </Dialog>
 
-                    <Button size="small" variant="contained" onClick={handleSubmit}>Submit</Button>
+                    <Button size="small" variant="contained" onClick={handleSubmit}
+                            disabled={publicSession !== null && (!publicSession.open || (!!publicSession.challengeSiteKey && challengeToken === ''))}>Submit</Button>
                 </Container>
             </Paper>
         </Box>
@@ -49,13 +49,15 @@ interface Data {
     instanceType: string;
     lwUrl: string;
     lwSubAccount: string;
-    lwAccessKeyID: string;
-    lwSecretKey: string;
+    lwAccessKeyIDHint: string;
+    lwAccessKeyIDSet: boolean;
+    lwSecretKeySet: boolean;
     lwUserGroup: string;
     createdBy: string;
     updatedBy: string;
     expiresAt: string;
     regCount: string;
+    version: number;
     lwLink: string;
 }
 
@@ -181,13 +183,13 @@ const headCells: readonly HeadCell[] = [
           label: 'SubAccount',
       },*/
     {
-        id: 'lwAccessKeyID',
+        id: 'lwAccessKeyIDHint',
         numeric: false,
         disablePadding: false,
         label: 'Access Key ID',
     },
     {
-        id: 'lwSecretKey',
+        id: 'lwSecretKeySet',
         numeric: false,
         disablePadding: false,
         label: 'Secret Key',
@@ -299,6 +301,7 @@ export default function EnhancedTable() {
     const [lwSub, setSessionLwSub] = React.useState("");
     const [lwAccessKeyID, setSessionLwAccessKeyID] = React.useState("");
     const [lwSecretKey, setSessionLwSecretKey] = React.useState("");
+    const [sessionVersion, setSessionVersion] = React.useState(0);
     const [lwUserGroup, setSessionLwUserGroup] = React.useState("LACEWORK_USER_GROUP_READ_ONLY_USER");
     const [sessionExpires, setSessionExpires] = React.useState(dayjs().add(3,'day'));
     const [rows, setRows] = React.useState([] as Data[]);
@@ -399,7 +402,8 @@ export default function EnhancedTable() {
                 lwSecretKey: lwSecretKey,
                 lwUserGroup: lwUserGroup,
                 updatedBy: user,
-                expiresAt: expiresAt
+                expiresAt: expiresAt,
+                version: sessionVersion
             })
         });
 
@@ -571,9 +575,10 @@ export default function EnhancedTable() {
                 setSessionLwUrl(row.lwUrl)
                 setSessionLwSub(row.lwSubAccount)
                 setSessionExpires(dayjs(row.expiresAt))
-                setSessionLwAccessKeyID(row.lwAccessKeyID)
-                setSessionLwSecretKey(row.lwSecretKey)
+                setSessionLwAccessKeyID("")
+                setSessionLwSecretKey("")
                 setSessionLwUserGroup(row.lwUserGroup)
+                setSessionVersion(row.version)
             }
         }
 
@@ -876,8 +881,8 @@ export default function EnhancedTable() {
                                     value={lwAccessKeyID}
                                     fullWidth
                                     variant="standard"
-                                    error={lwAccessKeyID.length < 4}
-                                    helperText={lwAccessKeyID.length < 4 ? 'Min length > 3' : ''}
+                                    error={lwAccessKeyID.length > 0 && lwAccessKeyID.length < 4}
+                                    helperText={lwAccessKeyID.length > 0 && lwAccessKeyID.length < 4 ? 'Min length > 3' : 'Leave blank to keep the current key'}
                                     onChange={(event) => setSessionLwAccessKeyID(event.target.value)}
                                 />
                                 <TextField
@@ -890,8 +895,8 @@ export default function EnhancedTable() {
                                     value={lwSecretKey}
                                     fullWidth
                                     variant="standard"
-                                    error={lwSecretKey.length < 4}
-                                    helperText={lwSecretKey.length < 4 ? 'Min length > 3' : ''}
+                                    error={lwSecretKey.length > 0 && lwSecretKey.length < 4}
+                                    helperText={lwSecretKey.length > 0 && lwSecretKey.length < 4 ? 'Min length > 3' : 'Leave blank to keep the current key'}
                                     onChange={(event) => setSessionLwSecretKey(event.target.value)}
                                 />
                                 <TextField
@@ -1037,22 +1042,22 @@ export default function EnhancedTable() {
                                                        scope="row"
                                                        padding="none"
                                                        width="10%">{row.lwSubAccount}</TableCell>*/}
-                                            <Tooltip title={row.lwAccessKeyID}>
+                                            <Tooltip title={row.lwAccessKeyIDSet ? row.lwAccessKeyIDHint : ""}>
                                                 <TableCell component="th"
                                                            id={labelId}
                                                            scope="row"
                                                            padding="none"
                                                            width="10%"
-                                                           align="left">{row.lwAccessKeyID.slice(0, 7) + "..."}
+                                                           align="left">{row.lwAccessKeyIDHint}
                                                 </TableCell>
                                             </Tooltip>
-                                            <Tooltip title={row.lwSecretKey}>
+                                            <Tooltip title={row.lwSecretKeySet ? "Secret key is set" : ""}>
                                                 <TableCell component="th"
                                                            id={labelId}
                                                            scope="row"
                                                            padding="none"
                                                            width="10%"
-                                                           align="left">{row.lwSecretKey.slice(0, 7) + "..."}
+                                                           align="left">{row.lwSecretKeySet ? "****" : ""}
                                                 </TableCell>
                                             </Tooltip>
                                             <Tooltip title={row.lwUserGroup}>
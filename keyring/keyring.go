@@ -0,0 +1,149 @@
+// Package keyring envelope-encrypts secrets stored in the database. Each value is sealed with a fresh data key
+// and the data key is sealed with a named master key, so master keys can be rotated by re-wrapping values.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jefferyfry/eventengine/config"
+	"github.com/jefferyfry/eventengine/models"
+	"io"
+	"os"
+	"strings"
+)
+
+const keySize = 32
+
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// New builds a keyring from master keys keyed by id. primary is the id used to encrypt new values.
+func New(primary string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %s is not in the keyring", primary)
+	}
+	for id, key := range keys {
+		if len(key) != keySize {
+			return nil, fmt.Errorf("key %s must be %d bytes, got %d", id, keySize, len(key))
+		}
+	}
+	return &Keyring{primary, keys}, nil
+}
+
+// FromEnv loads master keys from eventengine_secret_keys or the file named by eventengine_secret_keys_file.
+// Both hold comma or newline separated id:base64key entries. eventengine_secret_primary_key selects the key
+// used for new values and defaults to the first entry. It returns nil, nil when no keys are configured.
+func FromEnv() (*Keyring, error) {
+	entries := config.GetString("eventengine_secret_keys", "")
+	if path := config.GetString("eventengine_secret_keys_file", ""); path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read secret keys file: %w", err)
+		}
+		entries = string(contents)
+	}
+	if strings.TrimSpace(entries) == "" {
+		return nil, nil
+	}
+
+	keys := map[string][]byte{}
+	primary := ""
+	for _, entry := range strings.FieldsFunc(entries, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, errors.New("secret keys must be formatted as id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("secret key %s is not valid base64: %w", id, err)
+		}
+		if primary == "" {
+			primary = id
+		}
+		keys[id] = key
+	}
+	return New(config.GetString("eventengine_secret_primary_key", primary), keys)
+}
+
+// Encrypt seals plaintext under a new data key wrapped by the primary master key.
+func (k *Keyring) Encrypt(plaintext string) (*models.EncryptedValue, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	nonce, ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return nil, err
+	}
+	keyNonce, wrappedKey, err := seal(k.keys[k.primary], dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &models.EncryptedValue{
+		KeyID:      k.primary,
+		WrappedKey: wrappedKey,
+		KeyNonce:   keyNonce,
+		Nonce:      nonce,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// Decrypt unwraps the data key with the master key that sealed it and opens the value.
+func (k *Keyring) Decrypt(value *models.EncryptedValue) (string, error) {
+	masterKey, ok := k.keys[value.KeyID]
+	if !ok {
+		return "", fmt.Errorf("secret was encrypted with unknown key %s", value.KeyID)
+	}
+	dataKey, err := open(masterKey, value.KeyNonce, value.WrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("unable to unwrap data key: %w", err)
+	}
+	plaintext, err := open(dataKey, value.Nonce, value.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether value was sealed with a master key other than the primary.
+func (k *Keyring) NeedsRotation(value *models.EncryptedValue) bool {
+	return value.KeyID != k.primary
+}
+
+func seal(key []byte, plaintext []byte) ([]byte, []byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func open(key []byte, nonce []byte, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
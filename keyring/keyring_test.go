@@ -0,0 +1,150 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/jefferyfry/eventengine/models"
+	"testing"
+)
+
+func testKey(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, keySize)
+}
+
+func mustKeyring(t *testing.T, primary string, keys map[string][]byte) *Keyring {
+	t.Helper()
+	k, err := New(primary, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestRoundTrip(t *testing.T) {
+	k := mustKeyring(t, "k1", map[string][]byte{"k1": testKey(1)})
+	for _, plaintext := range []string{"_0123456789abcdef", ""} {
+		value, err := k.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.KeyID != "k1" {
+			t.Errorf("Encrypt(%q) sealed with %s, want k1", plaintext, value.KeyID)
+		}
+		got, err := k.Decrypt(value)
+		if err != nil || got != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plaintext, got, err)
+		}
+	}
+
+	first, _ := k.Encrypt("secret")
+	second, _ := k.Encrypt("secret")
+	if bytes.Equal(first.Ciphertext, second.Ciphertext) || bytes.Equal(first.WrappedKey, second.WrappedKey) {
+		t.Error("encrypting the same value twice gave the same ciphertext, want a fresh data key and nonce")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old := mustKeyring(t, "k1", map[string][]byte{"k1": testKey(1)})
+	value, _ := old.Encrypt("secret")
+
+	rotated := mustKeyring(t, "k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if !rotated.NeedsRotation(value) {
+		t.Error("NeedsRotation() = false for a value sealed with a retired key")
+	}
+	if got, err := rotated.Decrypt(value); err != nil || got != "secret" {
+		t.Errorf("Decrypt() with the retired key still present = %q, %v", got, err)
+	}
+	reencrypted, _ := rotated.Encrypt("secret")
+	if reencrypted.KeyID != "k2" || rotated.NeedsRotation(reencrypted) {
+		t.Errorf("new values are sealed with %s, want k2", reencrypted.KeyID)
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	k := mustKeyring(t, "k1", map[string][]byte{"k1": testKey(1)})
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		tamper  func(value *models.EncryptedValue)
+	}{
+		{name: "an unknown key id", keyring: mustKeyring(t, "k2", map[string][]byte{"k2": testKey(1)})},
+		{name: "the wrong key under the same id", keyring: mustKeyring(t, "k1", map[string][]byte{"k1": testKey(2)})},
+		{name: "tampered ciphertext", keyring: k, tamper: func(value *models.EncryptedValue) { value.Ciphertext[0] ^= 1 }},
+		{name: "a tampered wrapped key", keyring: k, tamper: func(value *models.EncryptedValue) { value.WrappedKey[0] ^= 1 }},
+		{name: "a tampered nonce", keyring: k, tamper: func(value *models.EncryptedValue) { value.Nonce[0] ^= 1 }},
+		{name: "a relabelled key id", keyring: mustKeyring(t, "k1", map[string][]byte{"k1": testKey(1), "k2": testKey(2)}),
+			tamper: func(value *models.EncryptedValue) { value.KeyID = "k2" }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := k.Encrypt("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.tamper != nil {
+				test.tamper(value)
+			}
+			if got, err := test.keyring.Decrypt(value); err == nil {
+				t.Errorf("Decrypt() = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		keys    map[string][]byte
+		wantErr bool
+	}{
+		{name: "valid", primary: "k1", keys: map[string][]byte{"k1": testKey(1), "k2": testKey(2)}},
+		{name: "missing primary", primary: "k3", keys: map[string][]byte{"k1": testKey(1)}, wantErr: true},
+		{name: "short key", primary: "k1", keys: map[string][]byte{"k1": testKey(1), "k2": []byte("short")}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := New(test.primary, test.keys); (err != nil) != test.wantErr {
+				t.Errorf("New() error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	k1, k2 := base64.StdEncoding.EncodeToString(testKey(1)), base64.StdEncoding.EncodeToString(testKey(2))
+	tests := []struct {
+		name        string
+		keys        string
+		primary     string
+		wantNil     bool
+		wantPrimary string
+		wantErr     bool
+	}{
+		{name: "unset", wantNil: true},
+		{name: "first entry is primary", keys: "k1:" + k1 + ",k2:" + k2, wantPrimary: "k1"},
+		{name: "newline separated with a chosen primary", keys: "k1:" + k1 + "\n k2:" + k2 + "\n", primary: "k2", wantPrimary: "k2"},
+		{name: "missing id", keys: k1, wantErr: true},
+		{name: "invalid base64", keys: "k1:not base64", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("eventengine_secret_keys", test.keys)
+			t.Setenv("eventengine_secret_keys_file", "")
+			t.Setenv("eventengine_secret_primary_key", test.primary)
+			k, err := FromEnv()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("FromEnv() error = %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if (k == nil) != test.wantNil {
+				t.Fatalf("FromEnv() = %v, want nil %v", k, test.wantNil)
+			}
+			if k != nil && k.primary != test.wantPrimary {
+				t.Errorf("primary = %s, want %s", k.primary, test.wantPrimary)
+			}
+		})
+	}
+}
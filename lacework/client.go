@@ -0,0 +1,401 @@
+package lacework
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jefferyfry/eventengine/config"
+	"github.com/jefferyfry/eventengine/ratelimit"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Instance identifies a Lacework tenant and the API key used to call it.
+type Instance struct {
+	Url         string
+	AccessKeyID string
+	SecretKey   string
+	SubAccount  string
+}
+
+type AccessTokenReqPayload struct {
+	KeyId      string `json:"keyId"`
+	ExpiryTime int    `json:"expiryTime"`
+}
+
+type AccessTokenRspPayload struct {
+	ExpiresAt string `json:"expiresAt"`
+	Token     string `json:"token"`
+}
+
+type PostTeamUsersReq struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Company string `json:"company"`
+}
+
+type PostTeamUsersRsp struct {
+	Data TeamUsers `json:"data"`
+}
+
+type TeamUsers struct {
+	Name          string       `json:"name"`
+	Company       string       `json:"company,omitempty"`
+	Email         string       `json:"email"`
+	UserGuid      string       `json:"userGuid"`
+	UserEnabled   int          `json:"userEnabled"`
+	Type          string       `json:"type"`
+	UserGroups    []UserGroups `json:"userGroups,omitempty"`
+	LastLoginTime int          `json:"lastLoginTime"`
+	OrgAccess     string       `json:"orgAccess"`
+}
+
+type UserGroups struct {
+	UserGroupGuid string `json:"userGroupGuid"`
+	UserGroupName string `json:"userGroupName"`
+}
+
+type PostUserGroupsReq struct {
+	UserGuids []string `json:"userGuids"`
+}
+
+type PostUserGroupsRsp struct {
+	UserGuids      []string `json:"userGuids"`
+	UserGroupGuids []string `json:"userGroupGuids"`
+}
+
+type GetTeamUsersRsp struct {
+	Data   []TeamUsers `json:"data"`
+	Paging *Paging     `json:"paging,omitempty"`
+}
+
+// Paging is returned with list responses that have more rows than fit in one page.
+type Paging struct {
+	Rows      int        `json:"rows"`
+	TotalRows int        `json:"totalRows"`
+	Urls      PagingUrls `json:"urls"`
+}
+
+type PagingUrls struct {
+	NextPage string `json:"nextPage"`
+}
+
+var (
+	// ErrUnauthorized is returned when Lacework rejects the access token, typically because it expired or was revoked.
+	ErrUnauthorized = errors.New("lacework access token was rejected")
+	// ErrUserExists is returned by AddTeamMemberUser when a team user already has the email address.
+	ErrUserExists = errors.New("user with this email address already exists")
+	// ErrUserNotFound is returned by GetTeamUserByEmail when no team user has the email address.
+	ErrUserNotFound = errors.New("team user not found")
+)
+
+// Client is the subset of the Lacework API v2 used by Event Engine.
+type Client interface {
+	CreateAccessToken(instance Instance) (*AccessTokenRspPayload, error)
+	AddTeamMemberUser(instance Instance, accessToken string, session string, email string, firstName string, lastName string, company string) (*PostTeamUsersRsp, string, error)
+	AddTeamUserToUserGroup(instance Instance, accessToken string, userGuid string, userGroup string) (*PostUserGroupsRsp, string, error)
+	RemoveTeamUserFromUserGroup(instance Instance, accessToken string, userGuid string, userGroup string) (string, error)
+	// GetSessionTeamMemberUsers returns the users whose company ends in "-<session>". That includes the users of
+	// any session whose name ends in "-<session>", so callers must filter those out.
+	GetSessionTeamMemberUsers(instance Instance, accessToken string, session string) (*GetTeamUsersRsp, string, error)
+	GetTeamUserByEmail(instance Instance, accessToken string, email string) (*TeamUsers, string, error)
+	// ListTeamUsers calls fn for every team user, following nextPage links and holding one page at a time.
+	// Returning ErrStopListing from fn ends the listing without an error.
+	ListTeamUsers(instance Instance, accessToken string, fn func(TeamUsers) error) (string, error)
+	DeleteTeamMemberUser(instance Instance, accessToken string, userGuid string) (string, error)
+}
+
+type Config struct {
+	// Scheme used to reach Lacework instances. Defaults to https.
+	Scheme string
+	// BaseURL, when set, replaces scheme://<instance url> for every instance. Used to point at a fake server.
+	BaseURL string
+	// HTTPClient sends the requests. Defaults to a client on a transport shared by every ClientImpl. Its
+	// transport is wrapped with retries, rate limiting and logging.
+	HTTPClient *http.Client
+	// LogLevel controls how much of each request is logged. Credentials and attendee PII are always masked.
+	LogLevel LogLevel
+	// Timeout bounds each attempt of a request. Zero means no timeout.
+	Timeout time.Duration
+	// MaxRetries is how many times a rate limited, unavailable or failed request is retried.
+	MaxRetries int
+	// RetryBaseDelay and RetryMaxDelay shape the jittered exponential backoff between retries.
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// RateLimit is the number of requests per second allowed to each instance, with bursts of up to RateBurst.
+	// Zero disables rate limiting.
+	RateLimit float64
+	RateBurst int
+}
+
+func ConfigFromEnv() Config {
+	return Config{
+		Scheme:         config.GetString("eventengine_lw_scheme", "https"),
+		BaseURL:        config.GetString("eventengine_lw_base_url", ""),
+		LogLevel:       ParseLogLevel(config.GetString("eventengine_lw_log_level", "basic")),
+		Timeout:        config.GetDuration("eventengine_lw_timeout", 30*time.Second),
+		MaxRetries:     config.GetInt("eventengine_lw_max_retries", 3),
+		RetryBaseDelay: config.GetDuration("eventengine_lw_retry_base_delay", 500*time.Millisecond),
+		RetryMaxDelay:  config.GetDuration("eventengine_lw_retry_max_delay", 30*time.Second),
+		RateLimit:      float64(config.GetInt("eventengine_lw_rate_limit", 10)),
+		RateBurst:      config.GetInt("eventengine_lw_rate_burst", 20),
+	}
+}
+
+// sharedTransport pools connections to Lacework across every ClientImpl.
+var sharedTransport = func() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 20
+	return transport
+}()
+
+type ClientImpl struct {
+	config Config
+}
+
+func NewClient(config Config) Client {
+	if config.Scheme == "" {
+		config.Scheme = "https"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Transport: sharedTransport}
+	}
+	transport := config.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	httpClient := *config.HTTPClient
+	httpClient.Transport = RetryTransport{
+		Transport: RateLimitTransport{
+			Transport: LoggingTransport{Transport: transport, Level: config.LogLevel},
+			Buckets:   ratelimit.NewBuckets(config.RateLimit, config.RateBurst),
+		},
+		Timeout:    config.Timeout,
+		MaxRetries: config.MaxRetries,
+		BaseDelay:  config.RetryBaseDelay,
+		MaxDelay:   config.RetryMaxDelay,
+	}
+	config.HTTPClient = &httpClient
+	return &ClientImpl{config}
+}
+
+func (c ClientImpl) CreateAccessToken(instance Instance) (*AccessTokenRspPayload, error) {
+	requestPayload := AccessTokenReqPayload{
+		KeyId:      instance.AccessKeyID,
+		ExpiryTime: 86400,
+	}
+	if payloadBytes, err := json.Marshal(requestPayload); err == nil {
+		request, err := http.NewRequest(http.MethodPost, c.baseUrl(instance)+"/api/v2/access/tokens", bytes.NewBuffer(payloadBytes))
+
+		if err != nil {
+			return nil, err
+		}
+
+		request.Header.Add("X-LW-UAKS", instance.SecretKey)
+		request.Header.Add("content-type", "application/json")
+		//a new token can always be asked for again
+		request = Retryable(request)
+
+		if rsp, err := c.config.HTTPClient.Do(request); err == nil {
+			defer rsp.Body.Close()
+			rspData := AccessTokenRspPayload{}
+			if err := json.NewDecoder(rsp.Body).Decode(&rspData); err == nil {
+				log.Printf("Access token for %s expires at %s", instance.Url, rspData.ExpiresAt)
+			} else {
+				log.Printf("Unable to get response body: %v", err)
+				return nil, err
+			}
+			if rsp.StatusCode == http.StatusCreated {
+				return &rspData, nil
+			} else {
+				return nil, errors.New(fmt.Sprintf("Failed to get access token. Resp status is %s", rsp.Status))
+			}
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+func (c ClientImpl) AddTeamMemberUser(instance Instance, accessToken string, session string, email string, firstName string, lastName string, company string) (*PostTeamUsersRsp, string, error) {
+	requestPayload := PostTeamUsersReq{
+		Type:    "StandardUser",
+		Name:    firstName + " " + lastName,
+		Email:   email,
+		Company: company + "-" + session,
+	}
+
+	if payloadBytes, err := json.Marshal(requestPayload); err == nil {
+		if rsp, err := c.sendApiReq(http.MethodPost, instance, "/api/v2/TeamUsers", accessToken, bytes.NewBuffer(payloadBytes)); err == nil {
+			defer rsp.Body.Close()
+			if body, err := io.ReadAll(rsp.Body); err != nil {
+				return nil, fmt.Sprintf("Problem reading response body %v", err), err
+			} else {
+				var usrRsp PostTeamUsersRsp
+				if errMarsh := json.Unmarshal(body, &usrRsp); errMarsh != nil {
+					return nil, fmt.Sprintf("Problem unmarshalling %v", errMarsh), errMarsh
+				} else {
+					if rsp.StatusCode == http.StatusCreated {
+						return &usrRsp, rsp.Status, nil
+					} else if rsp.StatusCode == http.StatusUnauthorized {
+						return nil, rsp.Status, ErrUnauthorized
+					} else if rsp.StatusCode == http.StatusConflict || (rsp.StatusCode == http.StatusBadRequest && userExistsResponse(body)) {
+						return nil, rsp.Status, ErrUserExists
+					} else if rsp.StatusCode == http.StatusBadRequest {
+						return nil, rsp.Status, errors.New(fmt.Sprintf("Lacework rejected the team member: %s", strings.TrimSpace(string(body))))
+					} else {
+						return nil, rsp.Status, errors.New(fmt.Sprintf("Failed sending add team member request. Response status is %d", rsp.StatusCode))
+					}
+				}
+			}
+		} else {
+			return nil, fmt.Sprintf("Problem sending request %v", err), err
+		}
+	} else {
+		return nil, fmt.Sprintf("Problem marshalling request %v", err), err
+	}
+}
+
+// userExistsResponse reports whether a 400 response to creating a team user says the user already exists, as
+// opposed to rejecting the request as invalid.
+func userExistsResponse(body []byte) bool {
+	return strings.Contains(strings.ToLower(string(body)), "already exist")
+}
+
+func (c ClientImpl) AddTeamUserToUserGroup(instance Instance, accessToken string, userGuid string, userGroup string) (*PostUserGroupsRsp, string, error) {
+	requestPayload := PostUserGroupsReq{
+		UserGuids: []string{userGuid},
+	}
+
+	if payloadBytes, err := json.Marshal(requestPayload); err == nil {
+		if rsp, err := c.sendApiReq(http.MethodPost, instance, "/api/v2/UserGroups/"+userGroup+"/addUsers", accessToken, bytes.NewBuffer(payloadBytes)); err == nil {
+			defer rsp.Body.Close()
+			if body, err := io.ReadAll(rsp.Body); err != nil {
+				return nil, fmt.Sprintf("Problem reading response body %v", err), err
+			} else {
+				var usrGrpRsp PostUserGroupsRsp
+				if errMarsh := json.Unmarshal(body, &usrGrpRsp); errMarsh != nil {
+					return nil, fmt.Sprintf("Problem unmarshalling %v", errMarsh), errMarsh
+				} else {
+					if rsp.StatusCode == http.StatusOK {
+						return &usrGrpRsp, rsp.Status, nil
+					} else if rsp.StatusCode == http.StatusUnauthorized {
+						return nil, rsp.Status, ErrUnauthorized
+					} else {
+						return nil, rsp.Status, errors.New(fmt.Sprintf("Failed sending add team member to user group request. Response status is %d", rsp.StatusCode))
+					}
+				}
+			}
+		} else {
+			return nil, fmt.Sprintf("Problem sending request %v", err), err
+		}
+	} else {
+		return nil, fmt.Sprintf("Problem marshalling request %v", err), err
+	}
+}
+
+func (c ClientImpl) RemoveTeamUserFromUserGroup(instance Instance, accessToken string, userGuid string, userGroup string) (string, error) {
+	requestPayload := PostUserGroupsReq{
+		UserGuids: []string{userGuid},
+	}
+
+	if payloadBytes, err := json.Marshal(requestPayload); err == nil {
+		if rsp, err := c.sendApiReq(http.MethodPost, instance, "/api/v2/UserGroups/"+userGroup+"/removeUsers", accessToken, bytes.NewBuffer(payloadBytes)); err == nil {
+			defer rsp.Body.Close()
+			if rsp.StatusCode == http.StatusOK || rsp.StatusCode == http.StatusNoContent {
+				return rsp.Status, nil
+			} else if rsp.StatusCode == http.StatusUnauthorized {
+				return rsp.Status, ErrUnauthorized
+			} else {
+				return rsp.Status, errors.New(fmt.Sprintf("Failed sending remove team member from user group request. Response status is %d", rsp.StatusCode))
+			}
+		} else {
+			return fmt.Sprintf("Problem sending request %v", err), err
+		}
+	} else {
+		return fmt.Sprintf("Problem marshalling request %v", err), err
+	}
+}
+
+func (c ClientImpl) DeleteTeamMemberUser(instance Instance, accessToken string, userGuid string) (string, error) {
+	if rsp, err := c.sendApiReq(http.MethodDelete, instance, "/api/v2/TeamUsers/"+userGuid, accessToken, nil); err == nil {
+		defer rsp.Body.Close()
+		if rsp.StatusCode == http.StatusNoContent {
+			return rsp.Status, nil
+		} else if rsp.StatusCode == http.StatusUnauthorized {
+			return rsp.Status, ErrUnauthorized
+		} else {
+			return rsp.Status, errors.New(fmt.Sprintf("Failed sending delete team member request. Response status is %d", rsp.StatusCode))
+		}
+	} else {
+		return fmt.Sprintf("Problem sending request %v", err), err
+	}
+}
+
+func (c ClientImpl) GetSessionTeamMemberUsers(instance Instance, accessToken string, session string) (*GetTeamUsersRsp, string, error) {
+	var sessUsrs GetTeamUsersRsp
+	total := 0
+	msg, err := c.ListTeamUsers(instance, accessToken, func(usr TeamUsers) error {
+		total++
+		if strings.HasSuffix(usr.Company, "-"+session) {
+			sessUsrs.Data = append(sessUsrs.Data, usr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, msg, err
+	}
+	log.Printf("Filtered %d of %d users for %s", len(sessUsrs.Data), total, session)
+	return &sessUsrs, msg, nil
+}
+
+func (c ClientImpl) GetTeamUserByEmail(instance Instance, accessToken string, email string) (*TeamUsers, string, error) {
+	var found *TeamUsers
+	msg, err := c.ListTeamUsers(instance, accessToken, func(usr TeamUsers) error {
+		if strings.EqualFold(usr.Email, email) {
+			found = &usr
+			return ErrStopListing
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, msg, err
+	}
+	if found == nil {
+		return nil, msg, ErrUserNotFound
+	}
+	return found, msg, nil
+}
+
+func (c ClientImpl) sendApiReq(method string, instance Instance, api string, accessToken string, payload io.Reader) (*http.Response, error) {
+	return c.sendReq(method, instance, c.baseUrl(instance)+api, accessToken, payload)
+}
+
+func (c ClientImpl) sendReq(method string, instance Instance, url string, accessToken string, payload io.Reader) (*http.Response, error) {
+	if request, err := http.NewRequest(method, url, payload); err != nil {
+		log.Printf("Error creating API request %s %s: %v", method, url, err)
+		return nil, err
+	} else {
+		request.Header.Add("Authorization", accessToken)
+		request.Header.Add("content-type", "application/json")
+
+		if instance.SubAccount != "" {
+			request.Header.Add("Account-Name", instance.SubAccount)
+		}
+
+		return c.config.HTTPClient.Do(request)
+	}
+}
+
+func (c ClientImpl) baseUrl(instance Instance) string {
+	if c.config.BaseURL != "" {
+		return strings.TrimSuffix(c.config.BaseURL, "/")
+	}
+	return c.config.Scheme + "://" + instance.Url
+}
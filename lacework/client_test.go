@@ -0,0 +1,89 @@
+package lacework_test
+
+import (
+	"errors"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/lacework/laceworktest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddTeamMemberUserResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantExists bool
+		wantErr    bool
+	}{
+		{name: "created", status: http.StatusCreated, body: `{"data": {"userGuid": "GUID_1"}}`},
+		{name: "conflict", status: http.StatusConflict, body: `{"message": "User already exists"}`, wantExists: true, wantErr: true},
+		{name: "bad request saying the user exists", status: http.StatusBadRequest, body: `{"message": "User with this email already exists."}`, wantExists: true, wantErr: true},
+		{name: "bad request for invalid input", status: http.StatusBadRequest, body: `{"message": "Invalid email"}`, wantErr: true},
+		{name: "server error", status: http.StatusInternalServerError, body: `{"message": "oops"}`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			client := lacework.NewClient(lacework.Config{Scheme: "http", BaseURL: server.URL, HTTPClient: server.Client()})
+
+			_, _, err := client.AddTeamMemberUser(lacework.Instance{Url: "demo.lacework.net"}, "token", "demo", "ann@example.com", "Ann", "Lee", "Acme")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("AddTeamMemberUser() error = %v, want error %v", err, test.wantErr)
+			}
+			if errors.Is(err, lacework.ErrUserExists) != test.wantExists {
+				t.Errorf("AddTeamMemberUser() error = %v, want ErrUserExists %v", err, test.wantExists)
+			}
+		})
+	}
+}
+
+func TestClientAgainstFake(t *testing.T) {
+	fake := laceworktest.NewServer()
+	defer fake.Close()
+	client := lacework.NewCachingClient(lacework.NewClient(fake.Config()), 0)
+	instance := lacework.Instance{Url: "demo.lacework.net", AccessKeyID: "KEY", SecretKey: "SECRET"}
+
+	token, err := client.CreateAccessToken(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, _, err := client.AddTeamMemberUser(instance, token.Token, "demo", "ann@example.com", "Ann", "Lee", "Acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Data.Company != "Acme-demo" {
+		t.Errorf("Company = %q, want Acme-demo", created.Data.Company)
+	}
+	if _, _, err := client.AddTeamMemberUser(instance, token.Token, "demo", "ANN@example.com", "Ann", "Lee", "Acme"); !errors.Is(err, lacework.ErrUserExists) {
+		t.Errorf("adding the same email again = %v, want ErrUserExists", err)
+	}
+	found, _, err := client.GetTeamUserByEmail(instance, token.Token, "ann@example.com")
+	if err != nil || found.UserGuid != created.Data.UserGuid {
+		t.Errorf("GetTeamUserByEmail() = %+v, %v, want %s", found, err, created.Data.UserGuid)
+	}
+	if _, _, err := client.AddTeamUserToUserGroup(instance, token.Token, created.Data.UserGuid, "LACEWORK_USER_GROUP_READ_ONLY_USER"); err != nil {
+		t.Fatal(err)
+	}
+	if members := fake.UserGroupMembers("LACEWORK_USER_GROUP_READ_ONLY_USER"); len(members) != 1 || members[0] != created.Data.UserGuid {
+		t.Errorf("group members = %v, want %s", members, created.Data.UserGuid)
+	}
+	if _, err := client.RemoveTeamUserFromUserGroup(instance, token.Token, created.Data.UserGuid, "LACEWORK_USER_GROUP_READ_ONLY_USER"); err != nil {
+		t.Fatal(err)
+	}
+	if members := fake.UserGroupMembers("LACEWORK_USER_GROUP_READ_ONLY_USER"); len(members) != 0 {
+		t.Errorf("group members after removal = %v, want none", members)
+	}
+	if _, err := client.DeleteTeamMemberUser(instance, token.Token, created.Data.UserGuid); err != nil {
+		t.Fatal(err)
+	}
+	if users := fake.TeamUsers(); len(users) != 0 {
+		t.Errorf("team users after delete = %v, want none", users)
+	}
+}
@@ -0,0 +1,298 @@
+// Package laceworktest provides an in-process fake of the Lacework API v2 endpoints used by Event Engine so
+// the register and cleanup flows can be exercised without a real tenant.
+package laceworktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jefferyfry/eventengine/lacework"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type failure struct {
+	method string
+	path   string
+	status int
+	count  int
+}
+
+// Server is a fake Lacework API. Tokens are minted for any access key, and every other call must present a
+// token minted by this server.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	nextGuid   int
+	tokens     map[string]time.Time
+	teamUsers  map[string]lacework.TeamUsers
+	userGroups map[string][]string
+	failures   []*failure
+	requests   []string
+	pageSize   int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		tokens:     map[string]time.Time{},
+		teamUsers:  map[string]lacework.TeamUsers{},
+		userGroups: map[string][]string{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/access/tokens", s.handleAccessTokens)
+	mux.HandleFunc("/api/v2/TeamUsers", s.handleTeamUsers)
+	mux.HandleFunc("/api/v2/TeamUsers/", s.handleTeamUsers)
+	mux.HandleFunc("/api/v2/UserGroups/", s.handleUserGroups)
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+// Config returns a lacework.Config that sends every instance's requests to this server.
+func (s *Server) Config() lacework.Config {
+	return lacework.Config{
+		Scheme:     "http",
+		BaseURL:    s.URL,
+		HTTPClient: s.Client(),
+	}
+}
+
+// TeamUsers returns a snapshot of the team users currently in the fake tenant.
+func (s *Server) TeamUsers() []lacework.TeamUsers {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make([]lacework.TeamUsers, 0, len(s.teamUsers))
+	for _, usr := range s.teamUsers {
+		users = append(users, usr)
+	}
+	return users
+}
+
+// UserGroupMembers returns the user guids added to userGroup and not removed since.
+func (s *Server) UserGroupMembers(userGroup string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.userGroups[userGroup]...)
+}
+
+// AddTeamUser seeds a pre-existing team user and returns it with its generated guid.
+func (s *Server) AddTeamUser(usr lacework.TeamUsers) lacework.TeamUsers {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usr.UserGuid = s.newGuid()
+	s.teamUsers[usr.UserGuid] = usr
+	return usr
+}
+
+// SetPageSize makes GET /api/v2/TeamUsers return at most pageSize users per page with a nextPage link, like a
+// large tenant. Zero returns every user in one page.
+func (s *Server) SetPageSize(pageSize int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = pageSize
+}
+
+// RevokeTokens invalidates every access token minted so far, as if they had expired.
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]time.Time{}
+}
+
+// FailNext makes the next count requests matching method and path prefix respond with status. 429 responses
+// carry a one second Retry-After.
+func (s *Server) FailNext(method string, pathPrefix string, status int, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{method, pathPrefix, status, count})
+}
+
+// Requests returns "METHOD /path" for every request received, in order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		for _, f := range s.failures {
+			if f.count > 0 && f.method == r.Method && strings.HasPrefix(r.URL.Path, f.path) {
+				f.count--
+				s.mu.Unlock()
+				if f.status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "1")
+				}
+				writeJSON(w, f.status, map[string]string{"message": "injected failure"})
+				return
+			}
+		}
+		s.mu.Unlock()
+
+		if r.URL.Path != "/api/v2/access/tokens" && !s.authorized(r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Invalid token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt, ok := s.tokens[token]
+	return ok && time.Now().Before(expiresAt)
+}
+
+func (s *Server) handleAccessTokens(w http.ResponseWriter, r *http.Request) {
+	var req lacework.AccessTokenReqPayload
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil || req.KeyId == "" || r.Header.Get("X-LW-UAKS") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Invalid access token request"})
+		return
+	}
+	s.mu.Lock()
+	token := fmt.Sprintf("token-%s", s.newGuid())
+	expiresAt := time.Now().Add(time.Duration(req.ExpiryTime) * time.Second).UTC()
+	s.tokens[token] = expiresAt
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, lacework.AccessTokenRspPayload{
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+		Token:     token,
+	})
+}
+
+func (s *Server) handleTeamUsers(w http.ResponseWriter, r *http.Request) {
+	userGuid := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v2/TeamUsers"), "/")
+	switch {
+	case r.Method == http.MethodGet && userGuid == "":
+		writeJSON(w, http.StatusOK, s.teamUsersPage(r.URL.Query().Get("page")))
+	case r.Method == http.MethodPost && userGuid == "":
+		var req lacework.PostTeamUsersReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Invalid team user"})
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, usr := range s.teamUsers {
+			if strings.EqualFold(usr.Email, req.Email) {
+				writeJSON(w, http.StatusConflict, map[string]string{"message": "User already exists"})
+				return
+			}
+		}
+		usr := lacework.TeamUsers{
+			Name:        req.Name,
+			Company:     req.Company,
+			Email:       req.Email,
+			UserGuid:    s.newGuid(),
+			UserEnabled: 1,
+			Type:        req.Type,
+		}
+		s.teamUsers[usr.UserGuid] = usr
+		writeJSON(w, http.StatusCreated, lacework.PostTeamUsersRsp{Data: usr})
+	case r.Method == http.MethodDelete && userGuid != "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.teamUsers[userGuid]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "User not found"})
+			return
+		}
+		delete(s.teamUsers, userGuid)
+		for group, members := range s.userGroups {
+			s.userGroups[group] = without(members, userGuid)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"message": "Method not allowed"})
+	}
+}
+
+func (s *Server) handleUserGroups(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v2/UserGroups/"), "/")
+	if r.Method != http.MethodPost || len(parts) != 2 || (parts[1] != "addUsers" && parts[1] != "removeUsers") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not found"})
+		return
+	}
+	userGroup := parts[0]
+	var req lacework.PostUserGroupsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Invalid user group request"})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, userGuid := range req.UserGuids {
+		if _, ok := s.teamUsers[userGuid]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Unknown user " + userGuid})
+			return
+		}
+	}
+	for _, userGuid := range req.UserGuids {
+		s.userGroups[userGroup] = without(s.userGroups[userGroup], userGuid)
+		if parts[1] == "addUsers" {
+			s.userGroups[userGroup] = append(s.userGroups[userGroup], userGuid)
+		}
+	}
+	writeJSON(w, http.StatusOK, lacework.PostUserGroupsRsp{
+		UserGuids:      req.UserGuids,
+		UserGroupGuids: []string{userGroup},
+	})
+}
+
+// teamUsersPage returns the users of page, in guid order, with a link to the next page.
+func (s *Server) teamUsersPage(page string) lacework.GetTeamUsersRsp {
+	users := s.TeamUsers()
+	sort.Slice(users, func(i, j int) bool { return users[i].UserGuid < users[j].UserGuid })
+	s.mu.Lock()
+	pageSize := s.pageSize
+	s.mu.Unlock()
+	if pageSize <= 0 {
+		return lacework.GetTeamUsersRsp{Data: users}
+	}
+
+	start, _ := strconv.Atoi(page)
+	if start < 0 || start > len(users) {
+		start = len(users)
+	}
+	end := start + pageSize
+	if end > len(users) {
+		end = len(users)
+	}
+	rsp := lacework.GetTeamUsersRsp{
+		Data:   users[start:end],
+		Paging: &lacework.Paging{Rows: end - start, TotalRows: len(users)},
+	}
+	if end < len(users) {
+		rsp.Paging.Urls.NextPage = fmt.Sprintf("%s/api/v2/TeamUsers/?page=%d", s.URL, end)
+	}
+	return rsp
+}
+
+// newGuid must be called with s.mu held.
+func (s *Server) newGuid() string {
+	s.nextGuid++
+	return fmt.Sprintf("FAKE_%08d", s.nextGuid)
+}
+
+func without(list []string, item string) []string {
+	var out []string
+	for _, i := range list {
+		if i != item {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
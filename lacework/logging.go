@@ -0,0 +1,165 @@
+package lacework
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	// LogOff disables request logging.
+	LogOff LogLevel = iota
+	// LogBasic logs method, URL, status and duration.
+	LogBasic
+	// LogHeaders adds request and response headers with credentials masked.
+	LogHeaders
+	// LogBody adds JSON bodies with credentials and attendee PII scrubbed.
+	LogBody
+)
+
+const redacted = "[REDACTED]"
+
+// redactedHeaders are masked whenever headers are logged.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"X-Lw-Uaks":           true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// redactedFields are JSON keys, compared case-insensitively, whose values are scrubbed from logged bodies.
+var redactedFields = map[string]bool{
+	"token":     true,
+	"secret":    true,
+	"secretkey": true,
+	"email":     true,
+	"name":      true,
+	"firstname": true,
+	"lastname":  true,
+	"company":   true,
+	"username":  true,
+}
+
+// ParseLogLevel accepts off, basic, headers or body and defaults to basic.
+func ParseLogLevel(level string) LogLevel {
+	switch strings.ToLower(level) {
+	case "off", "none":
+		return LogOff
+	case "headers":
+		return LogHeaders
+	case "body":
+		return LogBody
+	default:
+		return LogBasic
+	}
+}
+
+// LoggingTransport is an http.RoundTripper that logs Lacework calls without leaking credentials or PII.
+type LoggingTransport struct {
+	Transport http.RoundTripper
+	Level     LogLevel
+}
+
+func (t LoggingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if t.Level == LogOff {
+		return t.Transport.RoundTrip(request)
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "Lacework request: %s %s", request.Method, request.URL.Redacted())
+	if t.Level >= LogHeaders {
+		out.WriteString(" headers: " + redactHeaders(request.Header))
+	}
+	if t.Level >= LogBody && request.GetBody != nil {
+		if body, err := request.GetBody(); err == nil {
+			payload, _ := io.ReadAll(body)
+			body.Close()
+			out.WriteString(" body: " + scrubBody(payload))
+		}
+	}
+
+	start := time.Now()
+	rsp, err := t.Transport.RoundTrip(request)
+	if err != nil {
+		log.Printf("%s failed after %s: %v", out.String(), time.Since(start), err)
+		return rsp, err
+	}
+	fmt.Fprintf(&out, " -> %s in %s", rsp.Status, time.Since(start))
+	if t.Level >= LogHeaders {
+		out.WriteString(" headers: " + redactHeaders(rsp.Header))
+	}
+	if t.Level >= LogBody && rsp.Body != nil {
+		payload, readErr := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		rsp.Body = io.NopCloser(bytes.NewReader(payload))
+		if readErr == nil {
+			out.WriteString(" body: " + scrubBody(payload))
+		}
+	}
+	log.Println(out.String())
+	return rsp, nil
+}
+
+func redactHeaders(header http.Header) string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		value := strings.Join(header[key], ",")
+		if redactedHeaders[http.CanonicalHeaderKey(key)] {
+			value = redacted
+		}
+		parts = append(parts, key+"="+value)
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// scrubBody returns the JSON payload with sensitive fields masked. Non-JSON payloads are never logged.
+func scrubBody(payload []byte) string {
+	if len(payload) == 0 {
+		return "<empty>"
+	}
+	var body interface{}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return fmt.Sprintf("<%d bytes of non-JSON body omitted>", len(payload))
+	}
+	scrubbed, err := json.Marshal(scrubValue(body))
+	if err != nil {
+		return fmt.Sprintf("<%d bytes omitted>", len(payload))
+	}
+	return string(scrubbed)
+}
+
+func scrubValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redactedFields[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = scrubValue(field)
+			}
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = scrubValue(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,112 @@
+package lacework_test
+
+import (
+	"bytes"
+	"github.com/jefferyfry/eventengine/lacework"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// captureLog returns what fn logs.
+func captureLog(t *testing.T, fn func()) string {
+	t.Helper()
+	var out bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&out)
+	fn()
+	return out.String()
+}
+
+func TestLoggingTransportRedacts(t *testing.T) {
+	const requestBody = `{"email": "ann@example.com", "firstName": "Ann", "props": {"company": "Acme-demo"}, "userEnabled": 1}`
+	const responseBody = `{"data": [{"userGuid": "GUID_1", "userName": "ann@example.com", "token": "tok-123"}]}`
+	transport := roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		header.Set("Set-Cookie", "session=cookie-value")
+		return &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(responseBody))}, nil
+	})
+	secrets := []string{"ann@example.com", "Ann", "Acme-demo", "tok-123", "Bearer secret-token", "uaks-secret", "cookie-value"}
+
+	tests := []struct {
+		name     string
+		level    lacework.LogLevel
+		wantLogs []string
+	}{
+		{name: "off", level: lacework.LogOff},
+		{name: "basic", level: lacework.LogBasic, wantLogs: []string{"POST https://demo.lacework.net/api/v2/TeamUsers", "200 OK"}},
+		{name: "headers", level: lacework.LogHeaders, wantLogs: []string{"Authorization=[REDACTED]", "X-Lw-Uaks=[REDACTED]", "Set-Cookie=[REDACTED]", "Content-Type=application/json"}},
+		{name: "body", level: lacework.LogBody, wantLogs: []string{`"email":"[REDACTED]"`, `"company":"[REDACTED]"`, `"userEnabled":1`, `"userGuid":"GUID_1"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodPost, "https://demo.lacework.net/api/v2/TeamUsers", strings.NewReader(requestBody))
+			request.Header.Set("Authorization", "Bearer secret-token")
+			request.Header.Set("X-LW-UAKS", "uaks-secret")
+			request.Header.Set("Content-Type", "application/json")
+
+			var rsp *http.Response
+			logged := captureLog(t, func() {
+				var err error
+				rsp, err = lacework.LoggingTransport{Transport: transport, Level: test.level}.RoundTrip(request)
+				if err != nil {
+					t.Fatal(err)
+				}
+			})
+			if test.level == lacework.LogOff && logged != "" {
+				t.Errorf("logged %q, want nothing", logged)
+			}
+			for _, want := range test.wantLogs {
+				if !strings.Contains(logged, want) {
+					t.Errorf("logged %q, want %q in it", logged, want)
+				}
+			}
+			for _, secret := range secrets {
+				if strings.Contains(logged, secret) {
+					t.Errorf("logged %q, which leaks %q", logged, secret)
+				}
+			}
+			if body, _ := io.ReadAll(rsp.Body); string(body) != responseBody {
+				t.Errorf("response body = %s, want it unchanged", body)
+			}
+		})
+	}
+}
+
+func TestLoggingTransportOmitsNonJSONBodies(t *testing.T) {
+	transport := roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		return &http.Response{Status: "502 Bad Gateway", StatusCode: http.StatusBadGateway, Body: io.NopCloser(strings.NewReader("<html>ann@example.com</html>"))}, nil
+	})
+	request, _ := http.NewRequest(http.MethodGet, "https://demo.lacework.net/api/v2/TeamUsers", nil)
+	logged := captureLog(t, func() {
+		lacework.LoggingTransport{Transport: transport, Level: lacework.LogBody}.RoundTrip(request)
+	})
+	if strings.Contains(logged, "ann@example.com") || !strings.Contains(logged, "non-JSON body omitted") {
+		t.Errorf("logged %q, want the non-JSON body omitted", logged)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := map[string]lacework.LogLevel{
+		"off":     lacework.LogOff,
+		"none":    lacework.LogOff,
+		"BASIC":   lacework.LogBasic,
+		"headers": lacework.LogHeaders,
+		"body":    lacework.LogBody,
+		"":        lacework.LogBasic,
+		"verbose": lacework.LogBasic,
+	}
+	for level, want := range tests {
+		if got := lacework.ParseLogLevel(level); got != want {
+			t.Errorf("ParseLogLevel(%q) = %d, want %d", level, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package lacework
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ErrStopListing ends ListTeamUsers early when returned by its callback.
+var ErrStopListing = errors.New("stop listing")
+
+func (c ClientImpl) ListTeamUsers(instance Instance, accessToken string, fn func(TeamUsers) error) (string, error) {
+	base, err := url.Parse(c.baseUrl(instance))
+	if err != nil {
+		return fmt.Sprintf("Invalid instance url %v", err), err
+	}
+	pageUrl := base.String() + "/api/v2/TeamUsers/"
+	seen := map[string]bool{}
+	msg := ""
+	for pageUrl != "" {
+		if seen[pageUrl] {
+			return msg, fmt.Errorf("team users paging repeated %s", pageUrl)
+		}
+		seen[pageUrl] = true
+
+		var nextPage string
+		nextPage, msg, err = c.listTeamUsersPage(instance, accessToken, pageUrl, fn)
+		if errors.Is(err, ErrStopListing) {
+			return msg, nil
+		}
+		if err != nil {
+			return msg, err
+		}
+		if nextPage != "" {
+			//the access token must only ever be sent to the instance itself
+			next, err := url.Parse(nextPage)
+			if err != nil || next.Scheme != base.Scheme || next.Host != base.Host {
+				return msg, fmt.Errorf("refusing to follow team users nextPage %s outside %s", nextPage, base.Host)
+			}
+		}
+		pageUrl = nextPage
+	}
+	return msg, nil
+}
+
+// listTeamUsersPage streams the users of one page to fn and returns the next page url, if any.
+func (c ClientImpl) listTeamUsersPage(instance Instance, accessToken string, pageUrl string, fn func(TeamUsers) error) (string, string, error) {
+	rsp, err := c.sendReq(http.MethodGet, instance, pageUrl, accessToken, nil)
+	if err != nil {
+		return "", fmt.Sprintf("Problem sending request %v", err), err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusUnauthorized {
+		return "", rsp.Status, ErrUnauthorized
+	} else if rsp.StatusCode != http.StatusOK {
+		return "", rsp.Status, errors.New(fmt.Sprintf("Failed sending get team members request. Response status is %d", rsp.StatusCode))
+	}
+
+	var paging Paging
+	decoder := json.NewDecoder(rsp.Body)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return "", fmt.Sprintf("Problem unmarshalling %v", err), err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Sprintf("Problem unmarshalling %v", err), err
+		}
+		switch key {
+		case "data":
+			token, err := decoder.Token()
+			if err != nil {
+				return "", fmt.Sprintf("Problem unmarshalling %v", err), err
+			}
+			if token == nil {
+				continue
+			}
+			if token != json.Delim('[') {
+				err := fmt.Errorf("expected [ but found %v", token)
+				return "", fmt.Sprintf("Problem unmarshalling %v", err), err
+			}
+			for decoder.More() {
+				var usr TeamUsers
+				if err := decoder.Decode(&usr); err != nil {
+					return "", fmt.Sprintf("Problem unmarshalling %v", err), err
+				}
+				if err := fn(usr); err != nil {
+					return "", rsp.Status, err
+				}
+			}
+			if err := expectDelim(decoder, ']'); err != nil {
+				return "", fmt.Sprintf("Problem unmarshalling %v", err), err
+			}
+		case "paging":
+			if err := decoder.Decode(&paging); err != nil {
+				return "", fmt.Sprintf("Problem unmarshalling %v", err), err
+			}
+		default:
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return "", fmt.Sprintf("Problem unmarshalling %v", err), err
+			}
+		}
+	}
+	return paging.Urls.NextPage, rsp.Status, nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %s but found %v", delim, token)
+	}
+	return nil
+}
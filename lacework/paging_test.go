@@ -0,0 +1,140 @@
+package lacework_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/lacework/laceworktest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestListTeamUsersPages(t *testing.T) {
+	fake := laceworktest.NewServer()
+	defer fake.Close()
+	fake.SetPageSize(3)
+	for i := 0; i < 7; i++ {
+		fake.AddTeamUser(lacework.TeamUsers{Email: fmt.Sprintf("user%d@example.com", i), Company: "Acme-demo"})
+	}
+	client := lacework.NewClient(fake.Config())
+	instance := lacework.Instance{Url: "demo.lacework.net", AccessKeyID: "KEY", SecretKey: "SECRET"}
+	token, err := client.CreateAccessToken(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	if _, err := client.ListTeamUsers(instance, token.Token, func(usr lacework.TeamUsers) error {
+		if seen[usr.UserGuid] {
+			t.Errorf("user %s listed twice", usr.UserGuid)
+		}
+		seen[usr.UserGuid] = true
+		return nil
+	}); err != nil {
+		t.Fatalf("ListTeamUsers() = %v", err)
+	}
+	if len(seen) != 7 {
+		t.Errorf("listed %d users, want 7", len(seen))
+	}
+	if pages := countRequests(fake, "GET /api/v2/TeamUsers"); pages != 3 {
+		t.Errorf("page requests = %d, want 3", pages)
+	}
+
+	//stopping early reads no further pages
+	listed := 0
+	if _, err := client.ListTeamUsers(instance, token.Token, func(lacework.TeamUsers) error {
+		listed++
+		if listed == 2 {
+			return lacework.ErrStopListing
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("ListTeamUsers() stopped early = %v", err)
+	}
+	if pages := countRequests(fake, "GET /api/v2/TeamUsers"); listed != 2 || pages != 4 {
+		t.Errorf("listed %d users with %d page requests in all, want 2 users and one more page", listed, pages)
+	}
+}
+
+func countRequests(fake *laceworktest.Server, prefix string) int {
+	count := 0
+	for _, request := range fake.Requests() {
+		if strings.HasPrefix(request, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestListTeamUsersResponses(t *testing.T) {
+	//elsewhere stands in for another host that must never see the access token
+	var elsewhereHits int32
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&elsewhereHits, 1)
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer elsewhere.Close()
+
+	tests := []struct {
+		name   string
+		status int
+		// body is the first page, with %s replaced by the server's own host.
+		body      string
+		wantUsers int
+		wantErr   error
+		wantError string
+	}{
+		{name: "one page", status: http.StatusOK, body: `{"data": [{"userGuid": "GUID_1"}, {"userGuid": "GUID_2"}], "paging": {"urls": {}}}`, wantUsers: 2},
+		{name: "null data", status: http.StatusOK, body: `{"data": null}`},
+		{name: "unknown fields", status: http.StatusOK, body: `{"extra": {"a": [1]}, "data": [{"userGuid": "GUID_1"}]}`, wantUsers: 1},
+		{name: "next page on another host", status: http.StatusOK,
+			body:      `{"data": [{"userGuid": "GUID_1"}], "paging": {"urls": {"nextPage": "` + elsewhere.URL + `/api/v2/TeamUsers/?page=1"}}}`,
+			wantUsers: 1, wantError: "refusing to follow"},
+		{name: "next page over another scheme", status: http.StatusOK,
+			body:      `{"data": [], "paging": {"urls": {"nextPage": "https://%s/api/v2/TeamUsers/?page=1"}}}`,
+			wantError: "refusing to follow"},
+		{name: "next page repeating itself", status: http.StatusOK,
+			body:      `{"data": [{"userGuid": "GUID_1"}], "paging": {"urls": {"nextPage": "http://%s/api/v2/TeamUsers/"}}}`,
+			wantUsers: 1, wantError: "repeated"},
+		{name: "unauthorized", status: http.StatusUnauthorized, body: `{}`, wantErr: lacework.ErrUnauthorized},
+		{name: "server error", status: http.StatusInternalServerError, body: `{}`, wantError: "500"},
+		{name: "truncated", status: http.StatusOK, body: `{"data": [{"userGuid": "GUID_1"}`, wantUsers: 1, wantError: "unexpected end"},
+		{name: "data not a list", status: http.StatusOK, body: `{"data": {"userGuid": "GUID_1"}}`, wantError: "expected ["},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(test.status)
+				w.Write([]byte(strings.ReplaceAll(test.body, "%s", strings.TrimPrefix(server.URL, "http://"))))
+			}))
+			defer server.Close()
+			client := lacework.NewClient(lacework.Config{Scheme: "http", BaseURL: server.URL, HTTPClient: server.Client()})
+
+			users := 0
+			_, err := client.ListTeamUsers(lacework.Instance{Url: "demo.lacework.net"}, "token", func(lacework.TeamUsers) error {
+				users++
+				return nil
+			})
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Errorf("ListTeamUsers() = %v, want %v", err, test.wantErr)
+			}
+			if test.wantError != "" && (err == nil || !strings.Contains(err.Error(), test.wantError)) {
+				t.Errorf("ListTeamUsers() = %v, want an error containing %q", err, test.wantError)
+			}
+			if test.wantErr == nil && test.wantError == "" && err != nil {
+				t.Errorf("ListTeamUsers() = %v", err)
+			}
+			if users != test.wantUsers {
+				t.Errorf("listed %d users, want %d", users, test.wantUsers)
+			}
+		})
+	}
+	if hits := atomic.LoadInt32(&elsewhereHits); hits != 0 {
+		t.Errorf("another host got %d requests, want none", hits)
+	}
+}
@@ -0,0 +1,186 @@
+package lacework
+
+import (
+	"context"
+	"github.com/jefferyfry/eventengine/ratelimit"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// retryStatuses are the responses worth retrying: rate limiting and gateway errors that Lacework returns
+// while it is under load.
+var retryStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// RetryTransport is an http.RoundTripper that bounds every attempt by Timeout and retries network errors and
+// retryStatuses up to MaxRetries times. Requests that are not idempotent, such as creating a team user, and
+// that were not marked Retryable are only retried on a 429 or when the attempt failed before the request was written, so Lacework never sees
+// them twice. It waits for Retry-After when Lacework sends one and otherwise backs
+// off exponentially from BaseDelay with full jitter. No wait exceeds MaxDelay.
+type RetryTransport struct {
+	Transport  http.RoundTripper
+	Timeout    time.Duration
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func (t RetryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		attemptRequest := request
+		if attempt > 0 && request.Body != nil {
+			if request.GetBody == nil {
+				//the body cannot be replayed
+				return t.roundTrip(request)
+			}
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptRequest = request.Clone(request.Context())
+			attemptRequest.Body = body
+		}
+
+		//the transport reports the write from its own goroutine
+		var wrote atomic.Bool
+		attemptRequest = attemptRequest.WithContext(httptrace.WithClientTrace(attemptRequest.Context(), &httptrace.ClientTrace{
+			WroteRequest: func(httptrace.WroteRequestInfo) { wrote.Store(true) },
+		}))
+
+		rsp, err := t.roundTrip(attemptRequest)
+		if attempt >= t.MaxRetries || (err == nil && !retryStatuses[rsp.StatusCode]) || request.Context().Err() != nil {
+			return rsp, err
+		}
+		if !idempotent(request) && ((err == nil && rsp.StatusCode != http.StatusTooManyRequests) || (err != nil && wrote.Load())) {
+			//Lacework may have acted on the request, sending it again could repeat it
+			return rsp, err
+		}
+
+		delay := t.backoff(attempt)
+		if err == nil {
+			if retryAfter, ok := parseRetryAfter(rsp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+			io.Copy(io.Discard, rsp.Body)
+			rsp.Body.Close()
+			log.Printf("Lacework %s %s returned %s. Retrying in %s (retry %d of %d).", request.Method, request.URL.Redacted(), rsp.Status, delay, attempt+1, t.MaxRetries)
+		} else {
+			log.Printf("Lacework %s %s failed: %v. Retrying in %s (retry %d of %d).", request.Method, request.URL.Redacted(), err, delay, attempt+1, t.MaxRetries)
+		}
+		if t.MaxDelay > 0 && delay > t.MaxDelay {
+			delay = t.MaxDelay
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		}
+	}
+}
+
+type retryableKey struct{}
+
+// Retryable marks a request whose method is not idempotent but which can be sent again without harm, such as
+// asking for a new access token. RetryTransport retries it like a GET.
+func Retryable(request *http.Request) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), retryableKey{}, true))
+}
+
+// idempotent reports whether a request can be sent again without repeating its effect. Like net/http, a
+// request carrying an Idempotency-Key or X-Idempotency-Key header counts as idempotent.
+func idempotent(request *http.Request) bool {
+	switch request.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if retryable, _ := request.Context().Value(retryableKey{}).(bool); retryable {
+		return true
+	}
+	if _, ok := request.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	_, ok := request.Header["X-Idempotency-Key"]
+	return ok
+}
+
+// roundTrip sends one attempt bounded by Timeout. The timeout stays armed until the response body is closed.
+func (t RetryTransport) roundTrip(request *http.Request) (*http.Response, error) {
+	if t.Timeout <= 0 {
+		return t.Transport.RoundTrip(request)
+	}
+	ctx, cancel := context.WithTimeout(request.Context(), t.Timeout)
+	rsp, err := t.Transport.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	rsp.Body = cancelOnClose{rsp.Body, cancel}
+	return rsp, nil
+}
+
+// backoff returns a random delay between 0 and BaseDelay * 2^attempt.
+func (t RetryTransport) backoff(attempt int) time.Duration {
+	ceiling := t.BaseDelay << uint(attempt)
+	if t.MaxDelay > 0 && (ceiling <= 0 || ceiling > t.MaxDelay) {
+		ceiling = t.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// parseRetryAfter accepts delay seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// RateLimitTransport is an http.RoundTripper that takes a token from the bucket of the request's host before
+// sending it, so each Lacework instance gets its own request budget.
+type RateLimitTransport struct {
+	Transport http.RoundTripper
+	Buckets   *ratelimit.Buckets
+}
+
+func (t RateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if err := t.Buckets.Wait(request.Context(), request.URL.Host); err != nil {
+		return nil, err
+	}
+	return t.Transport.RoundTrip(request)
+}
@@ -0,0 +1,137 @@
+package lacework_test
+
+import (
+	"github.com/jefferyfry/eventengine/lacework"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		idempotencyKey bool
+		retryable      bool
+		status         int
+		wantAttempts   int32
+	}{
+		{name: "get on a gateway error", method: http.MethodGet, status: http.StatusBadGateway, wantAttempts: 4},
+		{name: "delete on unavailable", method: http.MethodDelete, status: http.StatusServiceUnavailable, wantAttempts: 4},
+		{name: "get on a client error", method: http.MethodGet, status: http.StatusBadRequest, wantAttempts: 1},
+		{name: "post on a gateway error", method: http.MethodPost, status: http.StatusBadGateway, wantAttempts: 1},
+		{name: "post on a gateway timeout", method: http.MethodPost, status: http.StatusGatewayTimeout, wantAttempts: 1},
+		{name: "post when rate limited", method: http.MethodPost, status: http.StatusTooManyRequests, wantAttempts: 4},
+		{name: "post with an idempotency key", method: http.MethodPost, idempotencyKey: true, status: http.StatusBadGateway, wantAttempts: 4},
+		{name: "post marked retryable", method: http.MethodPost, retryable: true, status: http.StatusBadGateway, wantAttempts: 4},
+		{name: "post marked retryable on a client error", method: http.MethodPost, retryable: true, status: http.StatusBadRequest, wantAttempts: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+			client := &http.Client{Transport: lacework.RetryTransport{Transport: http.DefaultTransport, MaxRetries: 3}}
+
+			request, err := http.NewRequest(test.method, server.URL, strings.NewReader(`{}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.idempotencyKey {
+				request.Header.Set("Idempotency-Key", "key-1")
+			}
+			if test.retryable {
+				request = lacework.Retryable(request)
+			}
+			rsp, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rsp.Body.Close()
+			if rsp.StatusCode != test.status {
+				t.Errorf("status = %d, want %d", rsp.StatusCode, test.status)
+			}
+			if attempts := atomic.LoadInt32(&attempts); attempts != test.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryTransportConnectionRefused(t *testing.T) {
+	//nothing listens on the closed server, so no request was ever sent and a POST is safe to retry
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	var attempts int32
+	counting := roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&attempts, 1)
+		return http.DefaultTransport.RoundTrip(request)
+	})
+	client := &http.Client{Transport: lacework.RetryTransport{Transport: counting, MaxRetries: 2}}
+	if _, err := client.Post(url, "application/json", strings.NewReader(`{}`)); err == nil {
+		t.Fatal("POST to a closed server succeeded")
+	}
+	if attempts := atomic.LoadInt32(&attempts); attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+}
+
+func TestRetryTransportConnectionDroppedAfterSend(t *testing.T) {
+	//Lacework may have created the user before the connection dropped, so the POST is not sent again
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: lacework.RetryTransport{Transport: http.DefaultTransport, MaxRetries: 2}}
+	if _, err := client.Post(server.URL, "application/json", strings.NewReader(`{}`)); err == nil {
+		t.Fatal("POST over a dropped connection succeeded")
+	}
+	if attempts := atomic.LoadInt32(&attempts); attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+func TestCreateAccessTokenIsRetryable(t *testing.T) {
+	var attempts, sentKey int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header["Idempotency-Key"]; ok {
+			atomic.AddInt32(&sentKey, 1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": "tok-123", "expiresAt": "2030-01-01T00:00:00Z"}`))
+	}))
+	defer server.Close()
+	client := lacework.NewClient(lacework.Config{Scheme: "http", BaseURL: server.URL,
+		HTTPClient: &http.Client{Transport: lacework.RetryTransport{Transport: http.DefaultTransport, MaxRetries: 2}}})
+
+	token, err := client.CreateAccessToken(lacework.Instance{Url: "demo.lacework.net", AccessKeyID: "KEY", SecretKey: "SECRET"})
+	if err != nil || token.Token != "tok-123" {
+		t.Fatalf("CreateAccessToken() = %+v, %v, want tok-123", token, err)
+	}
+	if attempts := atomic.LoadInt32(&attempts); attempts != 2 {
+		t.Errorf("attempts = %d, want 2", attempts)
+	}
+	if atomic.LoadInt32(&sentKey) != 0 {
+		t.Error("an Idempotency-Key header was sent")
+	}
+}
@@ -0,0 +1,181 @@
+package lacework
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// fallbackTokenLifetime is used when Lacework returns an expiresAt that cannot be parsed.
+const fallbackTokenLifetime = time.Hour
+
+// errRefreshAborted is returned to callers waiting on a refresh that ended without a result.
+var errRefreshAborted = errors.New("access token refresh aborted")
+
+type tokenKey struct {
+	url         string
+	accessKeyID string
+	subAccount  string
+}
+
+type cachedToken struct {
+	token     AccessTokenRspPayload
+	expiresAt time.Time
+}
+
+// tokenRefresh is an in-flight CreateAccessToken call shared by concurrent callers.
+type tokenRefresh struct {
+	done  chan struct{}
+	token *AccessTokenRspPayload
+	err   error
+}
+
+// CachingClient wraps a Client and reuses access tokens per (url, access key id, sub-account) until
+// refreshBefore their expiry. Concurrent refreshes for the same instance are collapsed into one request and
+// a token rejected with a 401 is dropped and the call retried once with a fresh token.
+type CachingClient struct {
+	client        Client
+	refreshBefore time.Duration
+
+	mu        sync.Mutex
+	tokens    map[tokenKey]cachedToken
+	refreshes map[tokenKey]*tokenRefresh
+}
+
+func NewCachingClient(client Client, refreshBefore time.Duration) Client {
+	return &CachingClient{
+		client:        client,
+		refreshBefore: refreshBefore,
+		tokens:        map[tokenKey]cachedToken{},
+		refreshes:     map[tokenKey]*tokenRefresh{},
+	}
+}
+
+func (c *CachingClient) CreateAccessToken(instance Instance) (*AccessTokenRspPayload, error) {
+	key := keyForInstance(instance)
+
+	c.mu.Lock()
+	if cached, ok := c.tokens[key]; ok && time.Now().Add(c.refreshBefore).Before(cached.expiresAt) {
+		c.mu.Unlock()
+		token := cached.token
+		return &token, nil
+	}
+	if refresh, ok := c.refreshes[key]; ok {
+		c.mu.Unlock()
+		<-refresh.done
+		return refresh.token, refresh.err
+	}
+	refresh := &tokenRefresh{done: make(chan struct{}), err: errRefreshAborted}
+	c.refreshes[key] = refresh
+	c.mu.Unlock()
+	//release the waiters even if CreateAccessToken panics
+	defer func() {
+		c.mu.Lock()
+		delete(c.refreshes, key)
+		c.mu.Unlock()
+		close(refresh.done)
+	}()
+
+	token, err := c.client.CreateAccessToken(instance)
+	if err == nil {
+		expiresAt, parseErr := time.Parse(time.RFC3339, token.ExpiresAt)
+		if parseErr != nil {
+			log.Printf("Unable to parse access token expiry %s for %s: %s", token.ExpiresAt, instance.Url, parseErr)
+			expiresAt = time.Now().Add(fallbackTokenLifetime)
+		}
+		c.mu.Lock()
+		c.tokens[key] = cachedToken{*token, expiresAt}
+		c.mu.Unlock()
+	}
+	refresh.token, refresh.err = token, err
+
+	return token, err
+}
+
+// Invalidate drops the cached token for instance if it is still accessToken.
+func (c *CachingClient) Invalidate(instance Instance, accessToken string) {
+	key := keyForInstance(instance)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.tokens[key]; ok && cached.token.Token == accessToken {
+		delete(c.tokens, key)
+	}
+}
+
+func (c *CachingClient) AddTeamMemberUser(instance Instance, accessToken string, session string, email string, firstName string, lastName string, company string) (*PostTeamUsersRsp, string, error) {
+	rsp, msg, err := c.client.AddTeamMemberUser(instance, accessToken, session, email, firstName, lastName, company)
+	if token, ok := c.retryToken(instance, accessToken, err); ok {
+		return c.client.AddTeamMemberUser(instance, token, session, email, firstName, lastName, company)
+	}
+	return rsp, msg, err
+}
+
+func (c *CachingClient) AddTeamUserToUserGroup(instance Instance, accessToken string, userGuid string, userGroup string) (*PostUserGroupsRsp, string, error) {
+	rsp, msg, err := c.client.AddTeamUserToUserGroup(instance, accessToken, userGuid, userGroup)
+	if token, ok := c.retryToken(instance, accessToken, err); ok {
+		return c.client.AddTeamUserToUserGroup(instance, token, userGuid, userGroup)
+	}
+	return rsp, msg, err
+}
+
+func (c *CachingClient) RemoveTeamUserFromUserGroup(instance Instance, accessToken string, userGuid string, userGroup string) (string, error) {
+	msg, err := c.client.RemoveTeamUserFromUserGroup(instance, accessToken, userGuid, userGroup)
+	if token, ok := c.retryToken(instance, accessToken, err); ok {
+		return c.client.RemoveTeamUserFromUserGroup(instance, token, userGuid, userGroup)
+	}
+	return msg, err
+}
+
+func (c *CachingClient) GetSessionTeamMemberUsers(instance Instance, accessToken string, session string) (*GetTeamUsersRsp, string, error) {
+	rsp, msg, err := c.client.GetSessionTeamMemberUsers(instance, accessToken, session)
+	if token, ok := c.retryToken(instance, accessToken, err); ok {
+		return c.client.GetSessionTeamMemberUsers(instance, token, session)
+	}
+	return rsp, msg, err
+}
+
+func (c *CachingClient) GetTeamUserByEmail(instance Instance, accessToken string, email string) (*TeamUsers, string, error) {
+	rsp, msg, err := c.client.GetTeamUserByEmail(instance, accessToken, email)
+	if token, ok := c.retryToken(instance, accessToken, err); ok {
+		return c.client.GetTeamUserByEmail(instance, token, email)
+	}
+	return rsp, msg, err
+}
+
+// ListTeamUsers restarts the listing with a fresh token when the token is rejected, so fn may see users of
+// earlier pages again.
+func (c *CachingClient) ListTeamUsers(instance Instance, accessToken string, fn func(TeamUsers) error) (string, error) {
+	msg, err := c.client.ListTeamUsers(instance, accessToken, fn)
+	if token, ok := c.retryToken(instance, accessToken, err); ok {
+		return c.client.ListTeamUsers(instance, token, fn)
+	}
+	return msg, err
+}
+
+func (c *CachingClient) DeleteTeamMemberUser(instance Instance, accessToken string, userGuid string) (string, error) {
+	msg, err := c.client.DeleteTeamMemberUser(instance, accessToken, userGuid)
+	if token, ok := c.retryToken(instance, accessToken, err); ok {
+		return c.client.DeleteTeamMemberUser(instance, token, userGuid)
+	}
+	return msg, err
+}
+
+// retryToken invalidates accessToken when err is a 401 and returns a fresh token to retry with.
+func (c *CachingClient) retryToken(instance Instance, accessToken string, err error) (string, bool) {
+	if !errors.Is(err, ErrUnauthorized) {
+		return "", false
+	}
+	log.Printf("Access token for %s was rejected. Refreshing.", instance.Url)
+	c.Invalidate(instance, accessToken)
+	token, err := c.CreateAccessToken(instance)
+	if err != nil {
+		log.Printf("Unable to refresh access token for %s: %s", instance.Url, err)
+		return "", false
+	}
+	return token.Token, true
+}
+
+func keyForInstance(instance Instance) tokenKey {
+	return tokenKey{instance.Url, instance.AccessKeyID, instance.SubAccount}
+}
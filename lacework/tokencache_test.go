@@ -0,0 +1,148 @@
+package lacework_test
+
+import (
+	"errors"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/lacework/laceworktest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenRequests counts the access token requests the fake received.
+func tokenRequests(fake *laceworktest.Server) int {
+	count := 0
+	for _, request := range fake.Requests() {
+		if request == "POST /api/v2/access/tokens" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestCachingClientTokens(t *testing.T) {
+	instance := lacework.Instance{Url: "demo.lacework.net", AccessKeyID: "KEY", SecretKey: "SECRET"}
+	tests := []struct {
+		name          string
+		refreshBefore time.Duration
+		instances     []lacework.Instance
+		wantRequests  int
+	}{
+		{name: "reused until refreshBefore its expiry", refreshBefore: time.Minute, instances: []lacework.Instance{instance, instance, instance}, wantRequests: 1},
+		{name: "refreshed within refreshBefore its expiry", refreshBefore: 25 * time.Hour, instances: []lacework.Instance{instance, instance}, wantRequests: 2},
+		{
+			name:          "cached per access key and sub-account",
+			refreshBefore: time.Minute,
+			instances: []lacework.Instance{
+				instance,
+				{Url: "demo.lacework.net", AccessKeyID: "OTHER", SecretKey: "SECRET"},
+				{Url: "demo.lacework.net", AccessKeyID: "KEY", SecretKey: "SECRET", SubAccount: "sub"},
+			},
+			wantRequests: 3,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := laceworktest.NewServer()
+			defer fake.Close()
+			client := lacework.NewCachingClient(lacework.NewClient(fake.Config()), test.refreshBefore)
+
+			for _, instance := range test.instances {
+				if _, err := client.CreateAccessToken(instance); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := tokenRequests(fake); got != test.wantRequests {
+				t.Errorf("access token requests = %d, want %d", got, test.wantRequests)
+			}
+		})
+	}
+}
+
+func TestCachingClientCollapsesConcurrentRefreshes(t *testing.T) {
+	fake := laceworktest.NewServer()
+	defer fake.Close()
+	client := lacework.NewCachingClient(lacework.NewClient(fake.Config()), 0)
+	instance := lacework.Instance{Url: "demo.lacework.net", AccessKeyID: "KEY", SecretKey: "SECRET"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.CreateAccessToken(instance); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := tokenRequests(fake); got != 1 {
+		t.Errorf("access token requests = %d, want 1", got)
+	}
+}
+
+func TestCachingClientRetriesRejectedToken(t *testing.T) {
+	fake := laceworktest.NewServer()
+	defer fake.Close()
+	client := lacework.NewCachingClient(lacework.NewClient(fake.Config()), 0)
+	instance := lacework.Instance{Url: "demo.lacework.net", AccessKeyID: "KEY", SecretKey: "SECRET"}
+
+	token, err := client.CreateAccessToken(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.RevokeTokens()
+	if _, _, err := client.AddTeamMemberUser(instance, token.Token, "demo", "ann@example.com", "Ann", "Lee", "Acme"); err != nil {
+		t.Fatalf("AddTeamMemberUser() with a revoked token = %v, want a retry with a new token", err)
+	}
+	if got := tokenRequests(fake); got != 2 {
+		t.Errorf("access token requests = %d, want 2", got)
+	}
+}
+
+// panickingClient panics on its first CreateAccessToken call once release is closed.
+type panickingClient struct {
+	lacework.Client
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (c *panickingClient) CreateAccessToken(instance lacework.Instance) (*lacework.AccessTokenRspPayload, error) {
+	first := false
+	c.once.Do(func() { first = true })
+	if !first {
+		return nil, errors.New("unavailable")
+	}
+	close(c.started)
+	<-c.release
+	panic("refresh failed")
+}
+
+func TestCachingClientReleasesWaitersWhenRefreshPanics(t *testing.T) {
+	stub := &panickingClient{started: make(chan struct{}), release: make(chan struct{})}
+	client := lacework.NewCachingClient(stub, 0)
+	instance := lacework.Instance{Url: "demo.lacework.net", AccessKeyID: "KEY", SecretKey: "SECRET"}
+
+	go func() {
+		defer func() { recover() }()
+		client.CreateAccessToken(instance)
+	}()
+	<-stub.started
+	waiter := make(chan error)
+	go func() {
+		_, err := client.CreateAccessToken(instance)
+		waiter <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(stub.release)
+
+	select {
+	case err := <-waiter:
+		if err == nil {
+			t.Error("CreateAccessToken() after a panicked refresh succeeded, want an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CreateAccessToken() still waiting on a panicked refresh")
+	}
+}
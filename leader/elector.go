@@ -0,0 +1,121 @@
+// Package leader elects one replica to run the background jobs, using a lease that the leader keeps renewing.
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/jefferyfry/eventengine/services"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Elector competes for a named lease and reports whether this replica currently holds it. The lease is renewed
+// every third of its ttl, so a replica that stops renewing loses leadership within ttl.
+type Elector struct {
+	leases services.LeaseService
+	name   string
+	owner  string
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	leader    bool
+	renewedAt time.Time
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewElector returns an Elector for the lease name. owner identifies this replica, for example the pod name,
+// and gets a random suffix so restarts never reuse a previous owner's lease.
+func NewElector(leases services.LeaseService, name string, owner string, ttl time.Duration) *Elector {
+	if owner == "" {
+		owner, _ = os.Hostname()
+	}
+	return &Elector{
+		leases: leases,
+		name:   name,
+		owner:  uniqueOwner(owner),
+		ttl:    ttl,
+	}
+}
+
+// uniqueOwner adds a random suffix to owner so restarts never reuse a previous owner's lease.
+func uniqueOwner(owner string) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", owner, hex.EncodeToString(suffix))
+}
+
+// Start competes for the lease in the background until Stop is called.
+func (e *Elector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		for {
+			e.tryAcquire()
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	log.Printf("Competing for the %s lease as %s.", e.name, e.owner)
+}
+
+// Stop ends the competition and releases the lease so another replica can take over without waiting for it
+// to expire.
+func (e *Elector) Stop() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	<-e.done
+	e.mu.Lock()
+	wasLeader := e.leader
+	e.leader = false
+	e.mu.Unlock()
+	if wasLeader {
+		if err := e.leases.ReleaseLease(e.name, e.owner); err != nil {
+			log.Printf("Error releasing the %s lease: %s", e.name, err)
+		}
+	}
+}
+
+// IsLeader reports whether this replica holds the lease. A leader that could not renew in time is no longer
+// considered leader, since another replica may have taken over.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader && time.Since(e.renewedAt) < e.ttl
+}
+
+func (e *Elector) tryAcquire() {
+	attemptedAt := time.Now()
+	acquired, err := e.leases.AcquireLease(e.name, e.owner, e.ttl)
+	if err != nil {
+		log.Printf("Error renewing the %s lease: %s", e.name, err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if acquired != e.leader {
+		if acquired {
+			log.Printf("Acquired the %s lease. This replica now runs the background jobs.", e.name)
+		} else {
+			log.Printf("Lost the %s lease to another replica.", e.name)
+		}
+	}
+	e.leader = acquired
+	if acquired {
+		e.renewedAt = attemptedAt
+	}
+}
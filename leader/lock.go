@@ -0,0 +1,45 @@
+package leader
+
+import (
+	"github.com/jefferyfry/eventengine/services"
+	"log"
+	"os"
+	"time"
+)
+
+// Lock takes the lease name for one job, such as a cleanup run, so that no other replica runs it at the same
+// time. The lease is renewed every third of ttl until release is called, and expires after ttl if this replica
+// dies. Lock returns false while another replica holds the lease.
+func Lock(leases services.LeaseService, name string, ttl time.Duration) (release func(), acquired bool, err error) {
+	hostname, _ := os.Hostname()
+	owner := uniqueOwner(hostname)
+	if acquired, err = leases.AcquireLease(name, owner, ttl); err != nil || !acquired {
+		return nil, false, err
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if renewed, err := leases.AcquireLease(name, owner, ttl); err != nil {
+					log.Printf("Error renewing the %s lease: %s", name, err)
+				} else if !renewed {
+					log.Printf("Lost the %s lease to another replica.", name)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		if err := leases.ReleaseLease(name, owner); err != nil {
+			log.Printf("Error releasing the %s lease: %s", name, err)
+		}
+	}, true, nil
+}
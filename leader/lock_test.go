@@ -0,0 +1,48 @@
+package leader
+
+import (
+	"github.com/jefferyfry/eventengine/services"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	leases := services.NewLeaseServiceMemory()
+
+	release, acquired, err := Lock(leases, "cleanup-run", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("Lock() = %v, %v, want the lease", acquired, err)
+	}
+
+	//another replica, or another request on this one, is turned away while the lease is held
+	if _, acquired, err := Lock(leases, "cleanup-run", time.Minute); err != nil || acquired {
+		t.Errorf("second Lock() = %v, %v, want false", acquired, err)
+	}
+	if other, acquired, err := Lock(leases, "cleanup-session-demo", time.Minute); err != nil || !acquired {
+		t.Errorf("Lock() of another name = %v, %v, want the lease", acquired, err)
+	} else {
+		other()
+	}
+
+	release()
+	again, acquired, err := Lock(leases, "cleanup-run", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("Lock() after release = %v, %v, want the lease", acquired, err)
+	}
+	again()
+}
+
+func TestLockRenews(t *testing.T) {
+	leases := services.NewLeaseServiceMemory()
+	release, acquired, err := Lock(leases, "cleanup-run", 60*time.Millisecond)
+	if err != nil || !acquired {
+		t.Fatalf("Lock() = %v, %v, want the lease", acquired, err)
+	}
+	defer release()
+
+	//well past the ttl, the renewals keep the lease
+	time.Sleep(200 * time.Millisecond)
+	if acquired, err := leases.AcquireLease("cleanup-run", "other-replica", time.Minute); err != nil || acquired {
+		t.Errorf("AcquireLease() by another owner = %v, %v, want false", acquired, err)
+	}
+}
@@ -2,33 +2,143 @@ package main
 
 import (
 	"context"
+	"errors"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/config"
 	"github.com/jefferyfry/eventengine/controllers"
+	"github.com/jefferyfry/eventengine/keyring"
+	"github.com/jefferyfry/eventengine/lacework"
+	"github.com/jefferyfry/eventengine/leader"
 	"github.com/jefferyfry/eventengine/routes"
 	services2 "github.com/jefferyfry/eventengine/services"
+	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var (
-	server *gin.Engine
-	ctx    context.Context
+	server      *gin.Engine
+	ctx         context.Context
+	mongoClient *mongo.Client
 
 	sessionService         services2.SessionService
+	registrationService    services2.RegistrationService
+	cleanupRunService      services2.CleanupRunService
+	leaseService           services2.LeaseService
+	apiKeyService          services2.APIKeyService
+	accessService          services2.AccessService
 	sessionController      controllers.SessionController
 	sessionRouteController routes.SessionRouteController
+
+	registrationController      controllers.RegistrationController
+	registrationRouteController routes.RegistrationRouteController
+
+	cleanupController      controllers.CleanupController
+	cleanupRouteController routes.CleanupRouteController
+
+	apiKeyController      controllers.APIKeyController
+	apiKeyRouteController routes.APIKeyRouteController
+
+	accessController      controllers.AccessController
+	accessRouteController routes.AccessRouteController
+
+	elector       *leader.Elector
+	authenticator *auth.Authenticator
 )
 
-func init() {
-	sessionService = services2.NewSessionServiceImpl(ctx)
-	sessionController = controllers.NewSessionController(sessionService)
+func main() {
+	ctx = context.Background()
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to start: %s", err)
+	}
+	if authenticator, err = auth.NewAuthenticator(authConfig); err != nil {
+		log.Fatalf("Unable to start: %s", err)
+	}
+	switch store := config.GetString("eventengine_store", "mongo"); store {
+	case "memory":
+		log.Println("Using the in-memory store. Data will not be persisted.")
+		sessionService = services2.NewSessionServiceMemory()
+		registrationService = services2.NewRegistrationServiceMemory()
+		cleanupRunService = services2.NewCleanupRunServiceMemory()
+		leaseService = services2.NewLeaseServiceMemory()
+		apiKeyService = services2.NewAPIKeyServiceMemory()
+		accessService = services2.NewAccessServiceMemory()
+	case "mongo":
+		mongoConfig := services2.MongoConfigFromEnv()
+		client, err := services2.NewMongoClient(ctx, mongoConfig)
+		if err != nil {
+			log.Fatalf("Unable to start: %s", err)
+		}
+		mongoClient = client
+		log.Printf("Connected to mongo database %s.", mongoConfig.Database)
+		if err := services2.EnsureSchema(ctx, mongoClient, mongoConfig); err != nil {
+			log.Fatalf("Unable to prepare the database schema: %s", err)
+		}
+		secretKeyring, err := keyring.FromEnv()
+		if err != nil {
+			log.Fatalf("Unable to load secret keys: %s", err)
+		}
+		sessionServiceImpl := services2.NewSessionServiceImpl(ctx, mongoClient, mongoConfig, secretKeyring)
+		if config.GetBool("eventengine_secret_reencrypt", false) {
+			count, err := sessionServiceImpl.ReencryptSecrets()
+			if err != nil {
+				log.Fatalf("Unable to re-encrypt session secrets: %s", err)
+			}
+			log.Printf("Re-encrypted secrets for %d sessions.", count)
+		}
+		sessionService = sessionServiceImpl
+		registrationService = services2.NewRegistrationServiceImpl(ctx, mongoClient, mongoConfig)
+		cleanupRunService = services2.NewCleanupRunServiceImpl(ctx, mongoClient, mongoConfig)
+		leaseService = services2.NewLeaseServiceImpl(ctx, mongoClient, mongoConfig)
+		apiKeyService = services2.NewAPIKeyServiceImpl(ctx, mongoClient, mongoConfig)
+		accessService = services2.NewAccessServiceImpl(ctx, mongoClient, mongoConfig)
+	default:
+		log.Fatalf("Unknown eventengine_store %s. Expected mongo or memory.", store)
+	}
+	laceworkClient := lacework.NewCachingClient(lacework.NewClient(lacework.ConfigFromEnv()),
+		config.GetDuration("eventengine_lw_token_refresh_before", 5*time.Minute))
+	registrationGuardConfig, err := controllers.RegistrationGuardConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to start: %s", err)
+	}
+	sessionController = controllers.NewSessionController(sessionService, registrationService, accessService, leaseService, laceworkClient, controllers.NewRegistrationGuard(registrationGuardConfig))
 	sessionRouteController = routes.NewSessionRouteController(sessionController)
+	registrationController = controllers.NewRegistrationController(sessionService, registrationService, laceworkClient)
+	registrationRouteController = routes.NewRegistrationRouteController(registrationController)
+	//only the replica holding the lease runs the background jobs
+	elector = leader.NewElector(leaseService, config.GetString("eventengine_leader_lease_name", "background-jobs"),
+		config.GetString("eventengine_instance_id", ""), config.GetDuration("eventengine_leader_lease_ttl", 30*time.Second))
+	elector.Start()
+	controllers.NewRegistrationReconciler(sessionService, registrationService, leaseService, laceworkClient,
+		config.GetDuration("eventengine_reconcile_grace", 2*time.Minute),
+		config.GetInt("eventengine_reconcile_max_attempts", 5)).Start(config.GetDuration("eventengine_reconcile_interval", time.Minute), elector.IsLeader)
+	cleanupController = controllers.NewCleanupController(sessionService, registrationService, accessService, leaseService, cleanupRunService, laceworkClient, controllers.CleanupConfigFromEnv())
+	cleanupRouteController = routes.NewCleanupRouteController(cleanupController)
+	if err := cleanupController.StartScheduler(elector.IsLeader); err != nil {
+		log.Fatalf("Unable to start: %s", err)
+	}
+	apiKeyController = controllers.NewAPIKeyController(apiKeyService)
+	apiKeyRouteController = routes.NewAPIKeyRouteController(apiKeyController)
+	accessController = controllers.NewAccessController(sessionService, accessService)
+	accessRouteController = routes.NewAccessRouteController(accessController)
 	server = gin.Default()
-}
+	//the client address behind these proxies is taken from X-Forwarded-For, which the registration rate limits
+	//rely on. By default the ingress and anything else inside the cluster network is trusted.
+	trustedProxies := config.GetList("eventengine_trusted_proxies")
+	if len(trustedProxies) == 0 {
+		trustedProxies = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "::1/128", "fc00::/7"}
+	}
+	if err := server.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid eventengine_trusted_proxies: %s", err)
+	}
 
-func main() {
 	startServer()
 }
 
@@ -36,8 +146,11 @@ func startServer() {
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{"*"}
 	corsConfig.AllowCredentials = true
+	corsConfig.AddAllowHeaders("If-Match", "Authorization", "X-API-Key")
+	corsConfig.AddExposeHeaders("ETag")
 
 	server.Use(cors.New(corsConfig))
+	server.Use(controllers.ErrorHandler())
 	server.Static("/static", "./static")
 
 	routerHealth := server.Group("/healthz")
@@ -45,7 +158,39 @@ func startServer() {
 		ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": "ok"})
 	})
 	routerApi := server.Group("/api")
+	routerApi.Use(controllers.Authenticate(authenticator, apiKeyService))
 	sessionRouteController.SessionRoute(routerApi)
+	registrationRouteController.RegistrationRoute(routerApi)
+	cleanupRouteController.CleanupRoute(routerApi)
+	apiKeyRouteController.APIKeyRoute(routerApi)
+	accessRouteController.AccessRoute(routerApi)
 	serverPort := os.Getenv("eventengine_serverPort")
-	log.Fatal(server.Run(":" + serverPort))
+
+	httpServer := &http.Server{
+		Addr:    ":" + serverPort,
+		Handler: server,
+	}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, config.GetDuration("eventengine_shutdown_timeout", 15*time.Second))
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %s", err)
+	}
+	elector.Stop()
+	if mongoClient != nil {
+		if err := mongoClient.Disconnect(shutdownCtx); err != nil {
+			log.Printf("Error disconnecting from mongo: %s", err)
+		}
+	}
+	log.Println("Server stopped.")
 }
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Session access modes. Anyone with the event link may register for open sessions. Code sessions need the
+// session's shared AccessCode, one_time_code sessions an unused code from a batch generated for the session,
+// and invite sessions an email on the session's invite list.
+const (
+	SESSION_ACCESS_OPEN          string = "open"
+	SESSION_ACCESS_CODE          string = "code"
+	SESSION_ACCESS_ONE_TIME_CODE string = "one_time_code"
+	SESSION_ACCESS_INVITE        string = "invite"
+)
+
+// AccessCode is a one-time code of a session, stored in CanonicalAccessCode form. UsedBy is the email that
+// redeemed it.
+type AccessCode struct {
+	Session   string     `json:"session" bson:"session"`
+	Code      string     `json:"code" bson:"code"`
+	Batch     string     `json:"batch" bson:"batch"`
+	CreatedBy string     `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	UsedBy    string     `json:"usedBy,omitempty" bson:"usedBy,omitempty"`
+	UsedAt    *time.Time `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
+
+// Invite puts an email, stored lower case, on the invite list of a session.
+type Invite struct {
+	Session   string    `json:"session" bson:"session"`
+	Email     string    `json:"email" bson:"email"`
+	CreatedBy string    `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// AccessCodesCreateReq is the payload for POST /api/sessions/:name/accesscodes.
+type AccessCodesCreateReq struct {
+	Count int `json:"count" binding:"required,min=1,max=1000"`
+}
+
+// InvitesAddReq is the JSON payload for POST /api/sessions/:name/invites. The invites can also be uploaded as
+// CSV.
+type InvitesAddReq struct {
+	Emails []string `json:"emails" binding:"required,min=1"`
+}
+
+// InvitesAdded reports an invite upload. Emails already on the list are not added again.
+type InvitesAdded struct {
+	Added int `json:"added"`
+	Total int `json:"total"`
+}
+
+// NormalizeAccessCode makes codes comparable however they are typed: upper case letters and digits only.
+func NormalizeAccessCode(code string) string {
+	var normalized strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			normalized.WriteRune(r)
+		}
+	}
+	return normalized.String()
+}
+
+// CanonicalAccessCode is the normalized code in groups of four, such as ABCD-EFGH-JKLM.
+func CanonicalAccessCode(code string) string {
+	normalized := NormalizeAccessCode(code)
+	var groups []string
+	for len(normalized) > 4 {
+		groups = append(groups, normalized[:4])
+		normalized = normalized[4:]
+	}
+	return strings.Join(append(groups, normalized), "-")
+}
+
+// ValidAccessMode reports whether mode is one of the SESSION_ACCESS modes. Empty means open.
+func ValidAccessMode(mode string) bool {
+	switch mode {
+	case "", SESSION_ACCESS_OPEN, SESSION_ACCESS_CODE, SESSION_ACCESS_ONE_TIME_CODE, SESSION_ACCESS_INVITE:
+		return true
+	}
+	return false
+}
+
+// ValidateAccess checks an access mode and the shared code it needs.
+func ValidateAccess(mode string, code string) error {
+	if !ValidAccessMode(mode) {
+		return errors.New("accessMode must be open, code, one_time_code or invite")
+	}
+	if mode == SESSION_ACCESS_CODE && len(NormalizeAccessCode(code)) < 4 {
+		return errors.New("accessCode must have at least 4 letters or digits for code sessions")
+	}
+	return nil
+}
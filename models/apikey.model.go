@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// APIKey lets automation, such as the CTF integration, call the API without a user. Only a hash of the secret
+// is stored. A key may do what its Scopes allow and sees the sessions of Team, if any, and the sessions it
+// created.
+type APIKey struct {
+	ID         string     `json:"id" bson:"_id"`
+	Name       string     `json:"name" bson:"name"`
+	SecretHash string     `json:"-" bson:"secretHash"`
+	Scopes     []string   `json:"scopes" bson:"scopes"`
+	Team       string     `json:"team,omitempty" bson:"team,omitempty"`
+	CreatedBy  string     `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+	RevokedBy  string     `json:"revokedBy,omitempty" bson:"revokedBy,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	LastUsedIP string     `json:"lastUsedIP,omitempty" bson:"lastUsedIP,omitempty"`
+}
+
+// Usable reports whether the key is neither revoked nor expired at now.
+func (k APIKey) Usable(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// APIKeyCreateReq mints a key. ExpiresIn, such as "720h", is used when ExpiresAt is not set. A key without
+// either never expires.
+type APIKeyCreateReq struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	Team      string     `json:"team"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	ExpiresIn string     `json:"expiresIn"`
+}
+
+// APIKeyCreated is returned once, when a key is minted. Key is the only copy of the secret.
+type APIKeyCreated struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+const (
+	CLEANUP_TRIGGER_SCHEDULED string = "scheduled"
+	CLEANUP_TRIGGER_MANUAL    string = "manual"
+
+	CLEANUP_STATUS_RUNNING   string = "running"
+	CLEANUP_STATUS_COMPLETED string = "completed"
+	CLEANUP_STATUS_FAILED    string = "failed"
+)
+
+// CleanupRun records one pass of the cleanup job over the expired sessions. SessionsDeleted counts the sessions
+// whose users were all deleted and SessionsPurged the cleaned sessions removed after the retention period. A
+// dry run counts the users it would delete without deleting anything.
+type CleanupRun struct {
+	ID               string           `json:"id" bson:"_id"`
+	Trigger          string           `json:"trigger" bson:"trigger"`
+	TriggeredBy      string           `json:"triggeredBy,omitempty" bson:"triggeredBy,omitempty"`
+	DryRun           bool             `json:"dryRun" bson:"dryRun"`
+	Grace            string           `json:"grace" bson:"grace"`
+	Status           string           `json:"status" bson:"status"`
+	Error            string           `json:"error,omitempty" bson:"error,omitempty"`
+	StartedAt        time.Time        `json:"startedAt" bson:"startedAt"`
+	FinishedAt       *time.Time       `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+	SessionsExamined int              `json:"sessionsExamined" bson:"sessionsExamined"`
+	SessionsExpired  int              `json:"sessionsExpired" bson:"sessionsExpired"`
+	SessionsDeleted  int              `json:"sessionsDeleted" bson:"sessionsDeleted"`
+	SessionsPurged   int              `json:"sessionsPurged" bson:"sessionsPurged"`
+	UsersDeleted     int              `json:"usersDeleted" bson:"usersDeleted"`
+	Failures         []CleanupFailure `json:"failures" bson:"failures"`
+}
+
+// CleanupFailure is a session or user the cleanup run could not delete.
+type CleanupFailure struct {
+	Session  string `json:"session" bson:"session"`
+	UserGuid string `json:"userGuid,omitempty" bson:"userGuid,omitempty"`
+	Error    string `json:"error" bson:"error"`
+}
+
+// StuckCleanup is a session whose cleanup has failed at least once, with the users it still has to delete.
+type StuckCleanup struct {
+	Session          string     `json:"session"`
+	Lifecycle        string     `json:"lifecycle"`
+	ExpiresAt        time.Time  `json:"expiresAt"`
+	CleanupAttempts  int        `json:"cleanupAttempts"`
+	CleanupError     string     `json:"cleanupError"`
+	CleanupAttemptAt *time.Time `json:"cleanupAttemptAt,omitempty"`
+	RemainingUsers   []string   `json:"remainingUsers"`
+	// LegacyUsers is set when some of the session's users can only be matched by company suffix. Retrying it
+	// then needs confirmLegacyMatch.
+	LegacyUsers bool `json:"legacyUsers,omitempty"`
+}
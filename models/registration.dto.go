@@ -0,0 +1,45 @@
+package models
+
+const (
+	REGISTRATION_PAGE_SIZE_DEFAULT int = 50
+	REGISTRATION_PAGE_SIZE_MAX     int = 500
+)
+
+// RegistrationQuery filters and pages the registrations of a session. Search matches email, first name,
+// last name and company, ignoring case. A PageSize of 0 returns every match.
+type RegistrationQuery struct {
+	Search   string `form:"q"`
+	Status   string `form:"status" binding:"omitempty,oneof=pending registered failed deleted rolling_back"`
+	Page     int    `form:"page" binding:"min=0"`
+	PageSize int    `form:"pageSize" binding:"min=0,max=500"`
+}
+
+// Paged defaults Page to the first page and PageSize to REGISTRATION_PAGE_SIZE_DEFAULT.
+func (q RegistrationQuery) Paged() RegistrationQuery {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = REGISTRATION_PAGE_SIZE_DEFAULT
+	}
+	if q.PageSize > REGISTRATION_PAGE_SIZE_MAX {
+		q.PageSize = REGISTRATION_PAGE_SIZE_MAX
+	}
+	return q
+}
+
+// Skip is the number of matches before the requested page.
+func (q RegistrationQuery) Skip() int {
+	if q.Page < 1 || q.PageSize < 1 {
+		return 0
+	}
+	return (q.Page - 1) * q.PageSize
+}
+
+// RegistrationPage is the response for GET /api/sessions/:name/registrations.
+type RegistrationPage struct {
+	Registrations []Registration `json:"registrations"`
+	Total         int64          `json:"total"`
+	Page          int            `json:"page"`
+	PageSize      int            `json:"pageSize"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	REGISTRATION_STATUS_PENDING    string = "pending"
+	REGISTRATION_STATUS_REGISTERED string = "registered"
+	REGISTRATION_STATUS_FAILED     string = "failed"
+	REGISTRATION_STATUS_DELETED    string = "deleted"
+	// REGISTRATION_STATUS_ROLLING_BACK marks a failed registration whose Lacework user still has to be deleted.
+	REGISTRATION_STATUS_ROLLING_BACK string = "rolling_back"
+)
+
+// Registration links an attendee to a session and to the Lacework team user created for them. Email is
+// stored lower case and is unique per session. PreExisting marks a Lacework user that existed before the
+// registration, which cleanup must never delete. Pending and rolling back registrations are finished by the
+// RegistrationReconciler, which counts its tries in Attempts. RegisteredBy names the API key that registered the
+// attendee on their behalf. InstanceType and LwUrl record the instance the user was created on, so that the
+// user can still be rolled back after its session is deleted.
+type Registration struct {
+	Session      string    `json:"session" bson:"session"`
+	Email        string    `json:"email" bson:"email"`
+	FirstName    string    `json:"firstName" bson:"firstName"`
+	LastName     string    `json:"lastName" bson:"lastName"`
+	Company      string    `json:"company" bson:"company"`
+	UserGuid     string    `json:"userGuid" bson:"userGuid"`
+	UserGroup    string    `json:"userGroup" bson:"userGroup"`
+	PreExisting  bool      `json:"preExisting" bson:"preExisting"`
+	Status       string    `json:"status" bson:"status"`
+	Error        string    `json:"error,omitempty" bson:"error,omitempty"`
+	Attempts     int       `json:"attempts" bson:"attempts"`
+	RegisteredBy string    `json:"registeredBy,omitempty" bson:"registeredBy,omitempty"`
+	InstanceType string    `json:"instanceType,omitempty" bson:"instanceType,omitempty"`
+	LwUrl        string    `json:"lwUrl,omitempty" bson:"lwUrl,omitempty"`
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedAt"`
+}
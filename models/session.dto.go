@@ -0,0 +1,410 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	INSTANCE_TYPE_CUSTOM  string = "CUSTOM"
+	INSTANCE_TYPE_DEFAULT string = "DEFAULT"
+)
+
+// emailDomainPattern accepts domain names such as example.com or mail.example.co.uk.
+var emailDomainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z0-9-]{2,63}$`)
+
+// sessionNamePattern keeps session names safe to use in URLs and as the Lacework company suffix.
+var sessionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{3,63}$`)
+
+// SessionCreateReq is the admin payload for POST /api/sessions.
+type SessionCreateReq struct {
+	Name                string    `json:"name" binding:"required"`
+	InstanceType        string    `json:"instanceType" binding:"required,oneof=CUSTOM DEFAULT"`
+	LwUrl               string    `json:"lwUrl"`
+	LwSubAccount        string    `json:"lwSubAccount"`
+	LwAccessKeyID       string    `json:"lwAccessKeyID"`
+	LwSecretKey         string    `json:"lwSecretKey"`
+	LwUserGroup         string    `json:"lwUserGroup"`
+	CreatedBy           string    `json:"createdBy"`
+	ExpiresAt           time.Time `json:"expiresAt" binding:"required"`
+	MaxRegistrations    int       `json:"maxRegistrations" binding:"min=0"`
+	Team                string    `json:"team"`
+	CoHosts             []string  `json:"coHosts"`
+	AllowedEmailDomains []string  `json:"allowedEmailDomains"`
+	BlockedEmailDomains []string  `json:"blockedEmailDomains"`
+	AccessMode          string    `json:"accessMode"`
+	AccessCode          string    `json:"accessCode"`
+}
+
+func (r SessionCreateReq) Validate() error {
+	if err := validateSessionName(r.Name); err != nil {
+		return err
+	}
+	if !r.ExpiresAt.After(time.Now()) {
+		return errors.New("expiresAt must be in the future")
+	}
+	if r.InstanceType == INSTANCE_TYPE_CUSTOM && (r.LwUrl == "" || r.LwAccessKeyID == "" || r.LwSecretKey == "") {
+		return errors.New("lwUrl, lwAccessKeyID and lwSecretKey are required for CUSTOM sessions")
+	}
+	if err := validateEmailDomains(r.AllowedEmailDomains); err != nil {
+		return err
+	}
+	if err := validateEmailDomains(r.BlockedEmailDomains); err != nil {
+		return err
+	}
+	return ValidateAccess(r.AccessMode, r.AccessCode)
+}
+
+func (r SessionCreateReq) ToSession() *Session {
+	return &Session{
+		Name:                r.Name,
+		InstanceType:        r.InstanceType,
+		LwUrl:               r.LwUrl,
+		LwSubAccount:        r.LwSubAccount,
+		LwAccessKeyID:       r.LwAccessKeyID,
+		LwSecretKey:         r.LwSecretKey,
+		LwUserGroup:         r.LwUserGroup,
+		CreatedBy:           r.CreatedBy,
+		UpdatedBy:           r.CreatedBy,
+		ExpiresAt:           r.ExpiresAt,
+		MaxRegistrations:    r.MaxRegistrations,
+		Owner:               NormalizePrincipal(r.CreatedBy),
+		Team:                r.Team,
+		CoHosts:             normalizeCoHosts(r.CoHosts),
+		AllowedEmailDomains: NormalizeEmailDomains(r.AllowedEmailDomains),
+		BlockedEmailDomains: NormalizeEmailDomains(r.BlockedEmailDomains),
+		AccessMode:          r.AccessMode,
+		AccessCode:          r.AccessCode,
+	}
+}
+
+func normalizeCoHosts(coHosts []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, coHost := range coHosts {
+		if coHost = NormalizePrincipal(coHost); coHost != "" && !seen[coHost] {
+			seen[coHost] = true
+			normalized = append(normalized, coHost)
+		}
+	}
+	return normalized
+}
+
+// SessionUpdateReq is the admin payload for PUT /api/sessions/:name. Blank credentials keep the stored ones.
+// Version, or an If-Match header, is required and makes the update conditional on the stored version.
+type SessionUpdateReq struct {
+	Version          int64     `json:"version"`
+	Name             string    `json:"name" binding:"required"`
+	InstanceType     string    `json:"instanceType" binding:"required,oneof=CUSTOM DEFAULT"`
+	LwUrl            string    `json:"lwUrl"`
+	LwSubAccount     string    `json:"lwSubAccount"`
+	LwAccessKeyID    string    `json:"lwAccessKeyID"`
+	LwSecretKey      string    `json:"lwSecretKey"`
+	LwUserGroup      string    `json:"lwUserGroup"`
+	UpdatedBy        string    `json:"updatedBy"`
+	ExpiresAt        time.Time `json:"expiresAt" binding:"required"`
+	MaxRegistrations int       `json:"maxRegistrations" binding:"min=0"`
+}
+
+func (r SessionUpdateReq) Validate() error {
+	if err := validateSessionName(r.Name); err != nil {
+		return err
+	}
+	if !r.ExpiresAt.After(time.Now()) {
+		return errors.New("expiresAt must be in the future")
+	}
+	if r.InstanceType == INSTANCE_TYPE_CUSTOM && r.LwUrl == "" {
+		return errors.New("lwUrl is required for CUSTOM sessions")
+	}
+	return nil
+}
+
+// ToPatch converts the full update into a patch that sets every mutable field.
+func (r SessionUpdateReq) ToPatch() *SessionPatchReq {
+	return &SessionPatchReq{
+		Name:             &r.Name,
+		InstanceType:     &r.InstanceType,
+		LwUrl:            &r.LwUrl,
+		LwSubAccount:     &r.LwSubAccount,
+		LwAccessKeyID:    &r.LwAccessKeyID,
+		LwSecretKey:      &r.LwSecretKey,
+		LwUserGroup:      &r.LwUserGroup,
+		UpdatedBy:        &r.UpdatedBy,
+		ExpiresAt:        &r.ExpiresAt,
+		MaxRegistrations: &r.MaxRegistrations,
+		Version:          r.Version,
+	}
+}
+
+// SessionPatchReq is the admin payload for PATCH /api/sessions/:name. Only fields present are changed and
+// blank credentials keep the stored ones. CreatedAt, CreatedBy, UpdatedAt and RegCount are immutable and are
+// only declared so that attempts to change them can be rejected. The admin API requires Version, or If-Match.
+type SessionPatchReq struct {
+	Name             *string    `json:"name"`
+	InstanceType     *string    `json:"instanceType" binding:"omitempty,oneof=CUSTOM DEFAULT"`
+	LwUrl            *string    `json:"lwUrl"`
+	LwSubAccount     *string    `json:"lwSubAccount"`
+	LwAccessKeyID    *string    `json:"lwAccessKeyID"`
+	LwSecretKey      *string    `json:"lwSecretKey"`
+	LwUserGroup      *string    `json:"lwUserGroup"`
+	UpdatedBy        *string    `json:"updatedBy"`
+	ExpiresAt        *time.Time `json:"expiresAt"`
+	MaxRegistrations *int       `json:"maxRegistrations" binding:"omitempty,min=0"`
+	Team             *string    `json:"team"`
+	Owner            *string    `json:"owner"`
+	// AllowedEmailDomains and BlockedEmailDomains replace the stored lists. An empty list clears them.
+	AllowedEmailDomains *[]string `json:"allowedEmailDomains"`
+	BlockedEmailDomains *[]string `json:"blockedEmailDomains"`
+	// AccessMode and AccessCode are checked against each other once applied to the stored session.
+	AccessMode *string `json:"accessMode"`
+	AccessCode *string `json:"accessCode"`
+	Version    int64   `json:"version"`
+
+	CreatedAt *time.Time `json:"createdAt"`
+	CreatedBy *string    `json:"createdBy"`
+	UpdatedAt *time.Time `json:"updatedAt"`
+	RegCount  *int       `json:"regCount"`
+}
+
+func (r SessionPatchReq) Validate() error {
+	if r.CreatedAt != nil || r.CreatedBy != nil || r.UpdatedAt != nil || r.RegCount != nil {
+		return errors.New("createdAt, createdBy, updatedAt and regCount cannot be changed")
+	}
+	if r.Name != nil {
+		if err := validateSessionName(*r.Name); err != nil {
+			return err
+		}
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return errors.New("expiresAt must be in the future")
+	}
+	if r.Owner != nil && NormalizePrincipal(*r.Owner) == "" {
+		return errors.New("owner cannot be blank")
+	}
+	if r.AllowedEmailDomains != nil {
+		if err := validateEmailDomains(*r.AllowedEmailDomains); err != nil {
+			return err
+		}
+	}
+	if r.BlockedEmailDomains != nil {
+		if err := validateEmailDomains(*r.BlockedEmailDomains); err != nil {
+			return err
+		}
+	}
+	if r.AccessMode != nil && !ValidAccessMode(*r.AccessMode) {
+		return errors.New("accessMode must be open, code, one_time_code or invite")
+	}
+	return nil
+}
+
+// Apply copies the fields present in the patch onto session.
+func (r SessionPatchReq) Apply(session *Session) {
+	if r.Name != nil {
+		session.Name = *r.Name
+	}
+	if r.InstanceType != nil {
+		session.InstanceType = *r.InstanceType
+	}
+	if r.LwUrl != nil {
+		session.LwUrl = *r.LwUrl
+	}
+	if r.LwSubAccount != nil {
+		session.LwSubAccount = *r.LwSubAccount
+	}
+	if r.LwAccessKeyID != nil && *r.LwAccessKeyID != "" {
+		session.LwAccessKeyID = *r.LwAccessKeyID
+	}
+	if r.LwSecretKey != nil && *r.LwSecretKey != "" {
+		session.LwSecretKey = *r.LwSecretKey
+	}
+	if r.LwUserGroup != nil {
+		session.LwUserGroup = *r.LwUserGroup
+	}
+	if r.UpdatedBy != nil {
+		session.UpdatedBy = *r.UpdatedBy
+	}
+	if r.ExpiresAt != nil {
+		session.ExpiresAt = *r.ExpiresAt
+	}
+	if r.MaxRegistrations != nil {
+		session.MaxRegistrations = *r.MaxRegistrations
+	}
+	if r.Team != nil {
+		session.Team = *r.Team
+	}
+	if r.Owner != nil {
+		session.Owner = NormalizePrincipal(*r.Owner)
+	}
+	if r.AllowedEmailDomains != nil {
+		session.AllowedEmailDomains = NormalizeEmailDomains(*r.AllowedEmailDomains)
+	}
+	if r.BlockedEmailDomains != nil {
+		session.BlockedEmailDomains = NormalizeEmailDomains(*r.BlockedEmailDomains)
+	}
+	if r.AccessMode != nil {
+		session.AccessMode = *r.AccessMode
+	}
+	if r.AccessCode != nil {
+		session.AccessCode = *r.AccessCode
+	}
+}
+
+// SessionAdminView is the session as returned by the admin API. The access key ID is reduced to a masked hint
+// and a set flag, and the secret key to only the set flag.
+type SessionAdminView struct {
+	Name                string     `json:"name"`
+	InstanceType        string     `json:"instanceType"`
+	LwUrl               string     `json:"lwUrl"`
+	LwSubAccount        string     `json:"lwSubAccount"`
+	LwAccessKeyIDHint   string     `json:"lwAccessKeyIDHint,omitempty"`
+	LwAccessKeyIDSet    bool       `json:"lwAccessKeyIDSet"`
+	LwSecretKeySet      bool       `json:"lwSecretKeySet"`
+	LwUserGroup         string     `json:"lwUserGroup"`
+	CreatedBy           string     `json:"createdBy"`
+	UpdatedBy           string     `json:"updatedBy"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+	ExpiresAt           time.Time  `json:"expiresAt"`
+	RegCount            int        `json:"regCount"`
+	MaxRegistrations    int        `json:"maxRegistrations"`
+	Version             int64      `json:"version"`
+	Owner               string     `json:"owner"`
+	Team                string     `json:"team"`
+	CoHosts             []string   `json:"coHosts"`
+	AllowedEmailDomains []string   `json:"allowedEmailDomains"`
+	BlockedEmailDomains []string   `json:"blockedEmailDomains"`
+	AccessMode          string     `json:"accessMode"`
+	AccessCode          string     `json:"accessCode,omitempty"`
+	Lifecycle           string     `json:"lifecycle"`
+	CleanupAttempts     int        `json:"cleanupAttempts,omitempty"`
+	CleanupError        string     `json:"cleanupError,omitempty"`
+	CleanedAt           *time.Time `json:"cleanedAt,omitempty"`
+}
+
+func NewSessionAdminView(session Session) SessionAdminView {
+	return SessionAdminView{
+		Name:                session.Name,
+		InstanceType:        session.InstanceType,
+		LwUrl:               session.LwUrl,
+		LwSubAccount:        session.LwSubAccount,
+		LwAccessKeyIDHint:   maskSecret(session.LwAccessKeyID, 4),
+		LwAccessKeyIDSet:    session.LwAccessKeyID != "",
+		LwSecretKeySet:      session.LwSecretKey != "",
+		LwUserGroup:         session.LwUserGroup,
+		CreatedBy:           session.CreatedBy,
+		UpdatedBy:           session.UpdatedBy,
+		CreatedAt:           session.CreatedAt,
+		UpdatedAt:           session.UpdatedAt,
+		ExpiresAt:           session.ExpiresAt,
+		RegCount:            session.RegCount,
+		MaxRegistrations:    session.MaxRegistrations,
+		Version:             session.Version,
+		Owner:               session.Owner,
+		Team:                session.Team,
+		CoHosts:             append([]string{}, session.CoHosts...),
+		AllowedEmailDomains: append([]string{}, session.AllowedEmailDomains...),
+		BlockedEmailDomains: append([]string{}, session.BlockedEmailDomains...),
+		AccessMode:          session.AccessModeState(),
+		AccessCode:          session.AccessCode,
+		Lifecycle:           session.LifecycleState(),
+		CleanupAttempts:     session.CleanupAttempts,
+		CleanupError:        session.CleanupError,
+		CleanedAt:           session.CleanedAt,
+	}
+}
+
+func NewSessionAdminViews(sessions []Session) []SessionAdminView {
+	views := make([]SessionAdminView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, NewSessionAdminView(session))
+	}
+	return views
+}
+
+const (
+	SESSION_STATE_OPEN   string = "open"
+	SESSION_STATE_FULL   string = "full"
+	SESSION_STATE_CLOSED string = "closed"
+)
+
+// SessionPublicView is the session as shown on the unauthenticated event page.
+type SessionPublicView struct {
+	Name      string    `json:"name"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// SeatsLeft is omitted for sessions without a registration limit.
+	SeatsLeft *int   `json:"seatsLeft,omitempty"`
+	State     string `json:"state"`
+	Open      bool   `json:"open"`
+	// AccessMode tells the event page whether to ask for an access code.
+	AccessMode string `json:"accessMode"`
+	// ChallengeSiteKey is set when attendees must solve a challenge to register.
+	ChallengeSiteKey string `json:"challengeSiteKey,omitempty"`
+}
+
+func NewSessionPublicView(session Session) SessionPublicView {
+	view := SessionPublicView{
+		Name:       session.Name,
+		ExpiresAt:  session.ExpiresAt,
+		State:      SESSION_STATE_OPEN,
+		AccessMode: session.AccessModeState(),
+	}
+	if session.MaxRegistrations > 0 {
+		seatsLeft := session.MaxRegistrations - session.RegCount
+		if seatsLeft < 0 {
+			seatsLeft = 0
+		}
+		view.SeatsLeft = &seatsLeft
+		if seatsLeft == 0 {
+			view.State = SESSION_STATE_FULL
+		}
+	}
+	if !session.ExpiresAt.After(time.Now()) || session.InCleanup() {
+		view.State = SESSION_STATE_CLOSED
+	}
+	view.Open = view.State == SESSION_STATE_OPEN
+	return view
+}
+
+// NormalizeEmailDomains lower cases domains and drops a leading @, blanks and duplicates.
+func NormalizeEmailDomains(domains []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+		if domain != "" && !seen[domain] {
+			seen[domain] = true
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
+
+func validateEmailDomains(domains []string) error {
+	for _, domain := range NormalizeEmailDomains(domains) {
+		if !emailDomainPattern.MatchString(domain) {
+			return fmt.Errorf("invalid email domain %q", domain)
+		}
+	}
+	return nil
+}
+
+func validateSessionName(name string) error {
+	if !sessionNamePattern.MatchString(name) {
+		return errors.New("name must be 4 to 64 letters, digits, '-' or '_' and start with a letter or digit")
+	}
+	return nil
+}
+
+// maskSecret keeps the first prefix and last four characters of long values and masks everything else.
+func maskSecret(value string, prefix int) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) < 12 {
+		return "****"
+	}
+	return value[:prefix] + "****" + value[len(value)-4:]
+}
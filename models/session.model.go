@@ -1,19 +1,127 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// Session lifecycle states. A session is active until it expires, expiring during the cleanup grace period and
+// then cleanup_pending until every Lacework user recorded for it is deleted. Cleanups that keep failing end in
+// cleanup_failed and wait for an admin. Cleaned sessions are kept for the cleanup retention period.
+const (
+	SESSION_LIFECYCLE_ACTIVE          string = "active"
+	SESSION_LIFECYCLE_EXPIRING        string = "expiring"
+	SESSION_LIFECYCLE_CLEANUP_PENDING string = "cleanup_pending"
+	SESSION_LIFECYCLE_CLEANED         string = "cleaned"
+	SESSION_LIFECYCLE_CLEANUP_FAILED  string = "cleanup_failed"
+)
 
 type Session struct {
-	Name          string    `json:"name" binding:"required" bson:"name"`
-	InstanceType  string    `json:"instanceType" bson:"instanceType" binding:"required"`
-	LwUrl         string    `json:"lwUrl" bson:"lwUrl"`
-	LwSubAccount  string    `json:"lwSubAccount" bson:"lwSubAccount"`
-	LwAccessKeyID string    `json:"lwAccessKeyID" bson:"lwAccessKeyID"`
-	LwSecretKey   string    `json:"lwSecretKey" bson:"lwSecretKey"`
-	LwUserGroup   string    `json:"lwUserGroup" bson:"lwUserGroup"`
-	CreatedBy     string    `json:"createdBy" bson:"createdBy"`
-	UpdatedBy     string    `json:"updatedBy" bson:"updatedBy"`
-	CreatedAt     time.Time `json:"createdAt" bson:"createdAt"`
-	UpdatedAt     time.Time `json:"updatedAt" bson:"updatedAt"`
-	ExpiresAt     time.Time `json:"expiresAt" bson:"expiresAt" binding:"required"`
-	RegCount      int       `json:"regCount" bson:"regCount"`
+	Name         string `json:"name" bson:"name"`
+	InstanceType string `json:"instanceType" bson:"instanceType"`
+	LwUrl        string `json:"lwUrl" bson:"lwUrl"`
+	LwSubAccount string `json:"lwSubAccount" bson:"lwSubAccount"`
+	// LwAccessKeyID and LwSecretKey are only stored in plaintext when no keyring is configured and are never
+	// serialized to JSON.
+	LwAccessKeyID    string          `json:"-" bson:"lwAccessKeyID,omitempty"`
+	LwSecretKey      string          `json:"-" bson:"lwSecretKey,omitempty"`
+	LwAccessKeyIDEnc *EncryptedValue `json:"-" bson:"lwAccessKeyIDEnc,omitempty"`
+	LwSecretKeyEnc   *EncryptedValue `json:"-" bson:"lwSecretKeyEnc,omitempty"`
+	LwUserGroup      string          `json:"lwUserGroup" bson:"lwUserGroup"`
+	CreatedBy        string          `json:"createdBy" bson:"createdBy"`
+	UpdatedBy        string          `json:"updatedBy" bson:"updatedBy"`
+	CreatedAt        time.Time       `json:"createdAt" bson:"createdAt"`
+	UpdatedAt        time.Time       `json:"updatedAt" bson:"updatedAt"`
+	ExpiresAt        time.Time       `json:"expiresAt" bson:"expiresAt"`
+	RegCount         int             `json:"regCount" bson:"regCount"`
+	// MaxRegistrations caps RegCount. Zero means unlimited.
+	MaxRegistrations int `json:"maxRegistrations" bson:"maxRegistrations"`
+	// Version is incremented by every update made through the API and used as the session ETag. Lifecycle
+	// changes made by cleanup advance LifecycleVersion instead, so they do not fail the edits of event managers.
+	Version          int64 `json:"version" bson:"version"`
+	LifecycleVersion int64 `json:"-" bson:"lifecycleVersion,omitempty"`
+	// Owner and Team limit who may see and change the session, and CoHosts are the callers it is shared with.
+	// Owner and CoHosts hold lowercase principal ids. Sessions stored before ownership existed have neither
+	// owner nor team and are visible to everyone.
+	Owner   string   `json:"owner" bson:"owner,omitempty"`
+	Team    string   `json:"team" bson:"team,omitempty"`
+	CoHosts []string `json:"coHosts" bson:"coHosts,omitempty"`
+	// AllowedEmailDomains, when set, limits registration to emails of these domains and their subdomains.
+	// BlockedEmailDomains are refused even when allowed.
+	AllowedEmailDomains []string `json:"allowedEmailDomains" bson:"allowedEmailDomains,omitempty"`
+	BlockedEmailDomains []string `json:"blockedEmailDomains" bson:"blockedEmailDomains,omitempty"`
+	// AccessMode is one of the SESSION_ACCESS modes. AccessCode is the shared code of code sessions.
+	AccessMode string `json:"accessMode" bson:"accessMode,omitempty"`
+	AccessCode string `json:"accessCode,omitempty" bson:"accessCode,omitempty"`
+	// LegacyUsers marks sessions created before registrations were recorded. Their users can only be found by
+	// the "-<session>" company suffix, which other sessions' users may share, so cleanup only matches it once an
+	// admin confirms. It is cleared once a cleanup has deleted them.
+	LegacyUsers bool `json:"legacyUsers,omitempty" bson:"legacyUsers,omitempty"`
+	// Lifecycle is one of the SESSION_LIFECYCLE states. Sessions stored before it existed are active.
+	Lifecycle        string     `json:"lifecycle" bson:"lifecycle,omitempty"`
+	CleanupAttempts  int        `json:"cleanupAttempts" bson:"cleanupAttempts,omitempty"`
+	CleanupError     string     `json:"cleanupError,omitempty" bson:"cleanupError,omitempty"`
+	CleanupAttemptAt *time.Time `json:"cleanupAttemptAt,omitempty" bson:"cleanupAttemptAt,omitempty"`
+	CleanedAt        *time.Time `json:"cleanedAt,omitempty" bson:"cleanedAt,omitempty"`
+}
+
+// LifecycleState returns Lifecycle, treating sessions stored without one as active.
+func (s Session) LifecycleState() string {
+	if s.Lifecycle == "" {
+		return SESSION_LIFECYCLE_ACTIVE
+	}
+	return s.Lifecycle
+}
+
+// InCleanup reports whether the session's users are being, or have been, deleted. Such sessions take no new
+// registrations.
+func (s Session) InCleanup() bool {
+	switch s.LifecycleState() {
+	case SESSION_LIFECYCLE_CLEANUP_PENDING, SESSION_LIFECYCLE_CLEANED, SESSION_LIFECYCLE_CLEANUP_FAILED:
+		return true
+	}
+	return false
+}
+
+// EncryptedValue is an envelope-encrypted secret. The data key that sealed Ciphertext is itself sealed by
+// the master key KeyID.
+type EncryptedValue struct {
+	KeyID      string `bson:"keyId"`
+	WrappedKey []byte `bson:"wrappedKey"`
+	KeyNonce   []byte `bson:"keyNonce"`
+	Nonce      []byte `bson:"nonce"`
+	Ciphertext []byte `bson:"ciphertext"`
+}
+
+// AccessModeState returns AccessMode, treating sessions stored without one as open.
+func (s Session) AccessModeState() string {
+	if s.AccessMode == "" {
+		return SESSION_ACCESS_OPEN
+	}
+	return s.AccessMode
+}
+
+// EmailDomainAllowed applies AllowedEmailDomains and BlockedEmailDomains to email.
+func (s Session) EmailDomainAllowed(email string) bool {
+	domain := EmailDomain(email)
+	if MatchesDomain(domain, s.BlockedEmailDomains) {
+		return false
+	}
+	return len(s.AllowedEmailDomains) == 0 || MatchesDomain(domain, s.AllowedEmailDomains)
+}
+
+// EmailDomain returns the lower case domain of email.
+func EmailDomain(email string) string {
+	domain := email[strings.LastIndex(email, "@")+1:]
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// MatchesDomain reports whether domain is one of domains or a subdomain of one.
+func MatchesDomain(domain string, domains []string) bool {
+	for _, d := range domains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,50 @@
+package models
+
+import "strings"
+
+// SessionScope is the set of sessions a caller may see. All is set for admins, and for every caller when
+// authentication is disabled.
+type SessionScope struct {
+	All       bool
+	Principal string
+	Teams     []string
+}
+
+// CanView reports whether the caller owns the session, co-hosts it or belongs to its team.
+func (s SessionScope) CanView(session Session) bool {
+	if s.CanManage(session) {
+		return true
+	}
+	for _, coHost := range session.CoHosts {
+		if coHost == s.Principal {
+			return true
+		}
+	}
+	return false
+}
+
+// CanManage reports whether the caller may delete the session and change who it is shared with. Co-hosts may
+// run the event but not give it away.
+func (s SessionScope) CanManage(session Session) bool {
+	if s.All || (session.Owner == "" && session.Team == "") {
+		return true
+	}
+	if s.Principal != "" && session.Owner == s.Principal {
+		return true
+	}
+	return session.Team != "" && s.InTeam(session.Team)
+}
+
+func (s SessionScope) InTeam(team string) bool {
+	for _, t := range s.Teams {
+		if t == team {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizePrincipal makes principal ids comparable. Emails are case-insensitive.
+func NormalizePrincipal(id string) string {
+	return strings.ToLower(strings.TrimSpace(id))
+}
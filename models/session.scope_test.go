@@ -0,0 +1,44 @@
+package models
+
+import "testing"
+
+func TestSessionScope(t *testing.T) {
+	owned := Session{Name: "owned", Owner: "ann@example.com"}
+	teamed := Session{Name: "teamed", Owner: "bob@example.com", Team: "emea"}
+	shared := Session{Name: "shared", Owner: "bob@example.com", CoHosts: []string{"ann@example.com"}}
+	unowned := Session{Name: "unowned"}
+	tests := []struct {
+		name       string
+		scope      SessionScope
+		session    Session
+		wantView   bool
+		wantManage bool
+	}{
+		{name: "admin", scope: SessionScope{All: true}, session: teamed, wantView: true, wantManage: true},
+		{name: "owner", scope: SessionScope{Principal: "ann@example.com"}, session: owned, wantView: true, wantManage: true},
+		{name: "someone else's session", scope: SessionScope{Principal: "carl@example.com"}, session: owned},
+		{name: "team member", scope: SessionScope{Principal: "ann@example.com", Teams: []string{"apac", "emea"}}, session: teamed, wantView: true, wantManage: true},
+		{name: "other team", scope: SessionScope{Principal: "ann@example.com", Teams: []string{"apac"}}, session: teamed},
+		{name: "co-host views but does not manage", scope: SessionScope{Principal: "ann@example.com"}, session: shared, wantView: true},
+		{name: "session from before ownership", scope: SessionScope{Principal: "ann@example.com"}, session: unowned, wantView: true, wantManage: true},
+		//an unauthenticated scope has no principal, which must not match a session without an owner but with a team
+		{name: "empty principal", scope: SessionScope{}, session: Session{Name: "team only", Team: "emea"}},
+		{name: "empty team", scope: SessionScope{Principal: "ann@example.com", Teams: []string{""}}, session: Session{Name: "owner only", Owner: "bob@example.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.scope.CanView(test.session); got != test.wantView {
+				t.Errorf("CanView(%s) = %v, want %v", test.session.Name, got, test.wantView)
+			}
+			if got := test.scope.CanManage(test.session); got != test.wantManage {
+				t.Errorf("CanManage(%s) = %v, want %v", test.session.Name, got, test.wantManage)
+			}
+		})
+	}
+}
+
+func TestNormalizePrincipal(t *testing.T) {
+	if got := NormalizePrincipal("  Ann@Example.COM "); got != "ann@example.com" {
+		t.Errorf("NormalizePrincipal() = %q, want ann@example.com", got)
+	}
+}
@@ -0,0 +1,144 @@
+// Package ratelimit provides token bucket rate limiters, alone or keyed by a string such as a Lacework
+// instance or a client IP.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket that refills at rate tokens per second up to burst tokens. A nil *Bucket never
+// limits.
+type Bucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full bucket, or nil when rate is not positive.
+func NewBucket(rate float64, burst int) *Bucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Allow takes a token if one is available without waiting.
+func (b *Bucket) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Wait takes a token, blocking until one is available or ctx is done.
+func (b *Bucket) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	b.refill(time.Now())
+	b.tokens--
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		//give the reserved token back
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// idle reports whether the bucket has refilled completely, so dropping it changes nothing.
+func (b *Bucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// refill must be called with b.mu held.
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// sweepInterval is how often Buckets drops buckets that have refilled completely.
+const sweepInterval = time.Minute
+
+// Buckets holds one Bucket per key, created full on first use. Idle buckets are dropped so keys such as
+// client IPs do not accumulate.
+type Buckets struct {
+	rate  float64
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+func NewBuckets(rate float64, burst int) *Buckets {
+	return &Buckets{rate: rate, burst: burst, buckets: map[string]*Bucket{}, lastSweep: time.Now()}
+}
+
+// Get returns the bucket for key, or nil when the rate is not positive.
+func (b *Buckets) Get(key string) *Bucket {
+	if b == nil || b.rate <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now := time.Now(); now.Sub(b.lastSweep) > sweepInterval {
+		for k, bucket := range b.buckets {
+			if bucket.idle(now) {
+				delete(b.buckets, k)
+			}
+		}
+		b.lastSweep = now
+	}
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = NewBucket(b.rate, b.burst)
+		b.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// Allow takes a token from the bucket for key without waiting.
+func (b *Buckets) Allow(key string) bool {
+	return b.Get(key).Allow()
+}
+
+// Wait takes a token from the bucket for key, blocking until one is available or ctx is done.
+func (b *Buckets) Wait(ctx context.Context, key string) error {
+	return b.Get(key).Wait(ctx)
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/controllers"
+)
+
+type AccessRouteController struct {
+	accessController controllers.AccessController
+}
+
+func NewAccessRouteController(accessController controllers.AccessController) AccessRouteController {
+	return AccessRouteController{accessController}
+}
+
+func (rc *AccessRouteController) AccessRoute(rg *gin.RouterGroup) {
+	routerAccess := rg.Group("/sessions/:name")
+
+	viewer := controllers.RequireRole(auth.ROLE_VIEWER)
+	eventManager := controllers.RequireRole(auth.ROLE_EVENT_MANAGER)
+
+	routerAccess.GET("/accesscodes", viewer, rc.accessController.GetAccessCodes)
+	routerAccess.GET("/accesscodes.csv", viewer, rc.accessController.ExportAccessCodes)
+	routerAccess.POST("/accesscodes", eventManager, rc.accessController.CreateAccessCodes)
+	routerAccess.GET("/invites", viewer, rc.accessController.GetInvites)
+	routerAccess.POST("/invites", eventManager, rc.accessController.AddInvites)
+	routerAccess.DELETE("/invites/:email", eventManager, rc.accessController.DeleteInvite)
+}
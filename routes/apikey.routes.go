@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/controllers"
+)
+
+type APIKeyRouteController struct {
+	apiKeyController controllers.APIKeyController
+}
+
+func NewAPIKeyRouteController(apiKeyController controllers.APIKeyController) APIKeyRouteController {
+	return APIKeyRouteController{apiKeyController}
+}
+
+func (rc *APIKeyRouteController) APIKeyRoute(rg *gin.RouterGroup) {
+	routerAPIKeys := rg.Group("/apikeys")
+	admin := controllers.RequireRole(auth.ROLE_ADMIN)
+
+	routerAPIKeys.GET("/", admin, rc.apiKeyController.GetAPIKeys)
+	routerAPIKeys.POST("/", admin, rc.apiKeyController.CreateAPIKey)
+	routerAPIKeys.GET("/:id", admin, rc.apiKeyController.GetAPIKey)
+	routerAPIKeys.DELETE("/:id", admin, rc.apiKeyController.RevokeAPIKey)
+}
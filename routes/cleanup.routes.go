@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/controllers"
+)
+
+type CleanupRouteController struct {
+	cleanupController controllers.CleanupController
+}
+
+func NewCleanupRouteController(cleanupController controllers.CleanupController) CleanupRouteController {
+	return CleanupRouteController{cleanupController}
+}
+
+func (rc *CleanupRouteController) CleanupRoute(rg *gin.RouterGroup) {
+	routerCleanup := rg.Group("/cleanup")
+	viewer := controllers.RequireRole(auth.ROLE_VIEWER)
+	admin := controllers.RequireRole(auth.ROLE_ADMIN)
+
+	//runs name every session they touched, whoever owns it
+	routerCleanup.GET("/runs", admin, rc.cleanupController.GetCleanupRuns)
+	routerCleanup.POST("/runs", admin, rc.cleanupController.TriggerCleanup)
+	routerCleanup.GET("/stuck", viewer, rc.cleanupController.GetStuckCleanups)
+	routerCleanup.POST("/stuck/:name/retry", admin, rc.cleanupController.RetryCleanup)
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
+	"github.com/jefferyfry/eventengine/controllers"
+)
+
+type RegistrationRouteController struct {
+	registrationController controllers.RegistrationController
+}
+
+func NewRegistrationRouteController(registrationController controllers.RegistrationController) RegistrationRouteController {
+	return RegistrationRouteController{registrationController}
+}
+
+func (rc *RegistrationRouteController) RegistrationRoute(rg *gin.RouterGroup) {
+	routerRegistrations := rg.Group("/sessions/:name")
+
+	viewer := controllers.RequireRole(auth.ROLE_VIEWER)
+	eventManager := controllers.RequireRole(auth.ROLE_EVENT_MANAGER)
+
+	routerRegistrations.GET("/registrations", viewer, rc.registrationController.GetRegistrations)
+	routerRegistrations.GET("/registrations.csv", viewer, rc.registrationController.ExportRegistrations)
+	routerRegistrations.DELETE("/registrations/:email", eventManager, rc.registrationController.DeleteRegistration)
+}
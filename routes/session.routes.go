@@ -2,9 +2,8 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/jefferyfry/eventengine/auth"
 	"github.com/jefferyfry/eventengine/controllers"
-	"net/http"
-	"os"
 )
 
 type SessionRouteController struct {
@@ -18,26 +17,26 @@ func NewSessionRouteController(sessionController controllers.SessionController)
 func (rc *SessionRouteController) SessionRoute(rg *gin.RouterGroup) {
 	routerSessions := rg.Group("/sessions")
 
-	routerSessions.GET("/", rc.sessionController.GetSessions)
-	routerSessions.GET("/:name", rc.sessionController.GetSessionByName)
-
-	routerSessions.DELETE("/:name", rc.sessionController.DeleteSession)
-	routerSessions.DELETE("/", rc.sessionController.DeleteSessions)
-	routerSessions.POST("/", rc.sessionController.AddSession)
-	routerSessions.POST("/ctfaddsession", ValidateCtfAddSession, rc.sessionController.AddSession)
-	routerSessions.PUT("/:name", rc.sessionController.UpdateSession)
-	routerSessions.GET("/defaultinstance", rc.sessionController.GetDefaultInstance)
+	viewer := controllers.RequireRole(auth.ROLE_VIEWER)
+	eventManager := controllers.RequireRole(auth.ROLE_EVENT_MANAGER)
+	sessionReader := controllers.RequireRoleOrScope(auth.ROLE_VIEWER, auth.SCOPE_SESSIONS_READ)
+	sessionCreator := controllers.RequireRoleOrScope(auth.ROLE_EVENT_MANAGER, auth.SCOPE_SESSIONS_CREATE)
+
+	routerSessions.GET("/", sessionReader, rc.sessionController.GetSessions)
+	routerSessions.GET("/:name", sessionReader, rc.sessionController.GetSessionByName)
+
+	routerSessions.DELETE("/:name", eventManager, rc.sessionController.DeleteSession)
+	routerSessions.DELETE("/", eventManager, rc.sessionController.DeleteSessions)
+	routerSessions.POST("/", sessionCreator, rc.sessionController.AddSession)
+	//the CTF integration's path, which the public ingress exposes
+	routerSessions.POST("/ctfaddsession", sessionCreator, rc.sessionController.AddSession)
+	routerSessions.PUT("/:name", eventManager, rc.sessionController.UpdateSession)
+	routerSessions.PATCH("/:name", eventManager, rc.sessionController.PatchSession)
+	routerSessions.PUT("/:name/cohosts/:coHost", eventManager, rc.sessionController.AddCoHost)
+	routerSessions.DELETE("/:name/cohosts/:coHost", eventManager, rc.sessionController.RemoveCoHost)
+	routerSessions.GET("/defaultinstance", viewer, rc.sessionController.GetDefaultInstance)
 
 	routerRegister := rg.Group("/register")
-	routerRegister.POST("/:name", rc.sessionController.Register)
-}
-
-func ValidateCtfAddSession(context *gin.Context) {
-	secret := os.Getenv("ctf_secret")
-	ctfAuthorization := context.Request.Header.Get("Authorization")
-	if ctfAuthorization == secret {
-		return
-	} else {
-		context.AbortWithStatus(http.StatusUnauthorized)
-	}
+	routerRegister.GET("/:name", rc.sessionController.GetPublicSession)
+	routerRegister.POST("/:name", controllers.RequireScopeForAPIKeys(auth.SCOPE_REGISTER), rc.sessionController.Register)
 }
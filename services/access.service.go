@@ -0,0 +1,26 @@
+package services
+
+import (
+	"github.com/jefferyfry/eventengine/models"
+)
+
+// AccessService keeps the one-time access codes and invite lists of sessions.
+type AccessService interface {
+	AddAccessCodes(codes []models.AccessCode) error
+	// GetAccessCodes returns the codes of the session, oldest batch first.
+	GetAccessCodes(session string) ([]models.AccessCode, error)
+	// RedeemAccessCode marks an unused code of the session as used by email. It returns ErrAccessCodeInvalid
+	// when the session has no such unused code.
+	RedeemAccessCode(session string, code string, email string) error
+	// ReleaseAccessCode makes a code redeemed by email usable again, when its registration fails.
+	ReleaseAccessCode(session string, code string, email string) error
+	// AddInvites adds emails to the invite list of the session and returns how many were not on it yet.
+	AddInvites(session string, emails []string, createdBy string) (int, error)
+	GetInvites(session string) ([]models.Invite, error)
+	IsInvited(session string, email string) (bool, error)
+	DeleteInvite(session string, email string) error
+	// RenameSession moves the codes and invites of a renamed session.
+	RenameSession(oldName string, newName string) error
+	// DeleteSessionAccess deletes the codes and invites of a deleted session.
+	DeleteSessionAccess(session string) error
+}
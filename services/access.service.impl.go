@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/jefferyfry/eventengine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+type AccessServiceImpl struct {
+	ctx              context.Context
+	accessCodes      *mongo.Collection
+	invites          *mongo.Collection
+	operationTimeout time.Duration
+}
+
+func NewAccessServiceImpl(ctx context.Context, client *mongo.Client, mongoConfig MongoConfig) AccessService {
+	database := client.Database(mongoConfig.Database)
+	return &AccessServiceImpl{
+		ctx:              ctx,
+		accessCodes:      database.Collection("access_codes"),
+		invites:          database.Collection("invites"),
+		operationTimeout: mongoConfig.OperationTimeout,
+	}
+}
+
+func (s AccessServiceImpl) AddAccessCodes(codes []models.AccessCode) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	documents := make([]interface{}, len(codes))
+	for i, code := range codes {
+		documents[i] = code
+	}
+	_, err := s.accessCodes.InsertMany(ctx, documents)
+	return err
+}
+
+func (s AccessServiceImpl) GetAccessCodes(session string) ([]models.AccessCode, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	codes := []models.AccessCode{}
+	cursor, err := s.accessCodes.Find(ctx, bson.M{"session": session}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s AccessServiceImpl) RedeemAccessCode(session string, code string, email string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	//matching only unused codes makes redeeming atomic, so a code cannot be used twice by concurrent registrations
+	filter := bson.M{"session": session, "code": code, "usedAt": bson.M{"$exists": false}}
+	result, err := s.accessCodes.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"usedAt": time.Now(), "usedBy": email}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrAccessCodeInvalid, code)
+	}
+	return nil
+}
+
+func (s AccessServiceImpl) ReleaseAccessCode(session string, code string, email string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{"session": session, "code": code, "usedBy": email}
+	_, err := s.accessCodes.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"usedAt": "", "usedBy": ""}})
+	return err
+}
+
+func (s AccessServiceImpl) AddInvites(session string, emails []string, createdBy string) (int, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	now := time.Now()
+	var writes []mongo.WriteModel
+	for _, email := range emails {
+		invite := models.Invite{Session: session, Email: strings.ToLower(email), CreatedBy: createdBy, CreatedAt: now}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"session": session, "email": invite.Email}).
+			SetUpdate(bson.M{"$setOnInsert": invite}).
+			SetUpsert(true))
+	}
+	if len(writes) == 0 {
+		return 0, nil
+	}
+	result, err := s.invites.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, err
+	}
+	return int(result.UpsertedCount), nil
+}
+
+func (s AccessServiceImpl) GetInvites(session string) ([]models.Invite, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	invites := []models.Invite{}
+	cursor, err := s.invites.Find(ctx, bson.M{"session": session}, options.Find().SetSort(bson.D{{Key: "email", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+func (s AccessServiceImpl) IsInvited(session string, email string) (bool, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	count, err := s.invites.CountDocuments(ctx, bson.M{"session": session, "email": strings.ToLower(email)}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s AccessServiceImpl) DeleteInvite(session string, email string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	result, err := s.invites.DeleteOne(ctx, bson.M{"session": session, "email": strings.ToLower(email)})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrInviteNotFound, email)
+	}
+	return nil
+}
+
+func (s AccessServiceImpl) RenameSession(oldName string, newName string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"session": newName}}
+	if _, err := s.accessCodes.UpdateMany(ctx, bson.M{"session": oldName}, update); err != nil {
+		return err
+	}
+	_, err := s.invites.UpdateMany(ctx, bson.M{"session": oldName}, update)
+	return err
+}
+
+func (s AccessServiceImpl) DeleteSessionAccess(session string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	if _, err := s.accessCodes.DeleteMany(ctx, bson.M{"session": session}); err != nil {
+		return err
+	}
+	_, err := s.invites.DeleteMany(ctx, bson.M{"session": session})
+	return err
+}
+
+func (s AccessServiceImpl) operationContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.ctx, s.operationTimeout)
+}
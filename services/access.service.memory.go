@@ -0,0 +1,183 @@
+package services
+
+import (
+	"fmt"
+	"github.com/jefferyfry/eventengine/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessServiceMemory is a thread-safe, in-memory AccessService for local development and tests.
+type AccessServiceMemory struct {
+	mu      sync.RWMutex
+	codes   []models.AccessCode
+	invites []models.Invite
+}
+
+func NewAccessServiceMemory() AccessService {
+	return &AccessServiceMemory{}
+}
+
+func (s *AccessServiceMemory) AddAccessCodes(codes []models.AccessCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, code := range codes {
+		if s.findCode(code.Session, code.Code) >= 0 {
+			return fmt.Errorf("access code %s already exists", code.Code)
+		}
+	}
+	s.codes = append(s.codes, codes...)
+	return nil
+}
+
+func (s *AccessServiceMemory) GetAccessCodes(session string) ([]models.AccessCode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	codes := []models.AccessCode{}
+	for _, code := range s.codes {
+		if code.Session == session {
+			codes = append(codes, code)
+		}
+	}
+	sort.SliceStable(codes, func(i, j int) bool {
+		return codes[i].CreatedAt.Before(codes[j].CreatedAt)
+	})
+	return codes, nil
+}
+
+func (s *AccessServiceMemory) RedeemAccessCode(session string, code string, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findCode(session, code)
+	if i < 0 || s.codes[i].UsedAt != nil {
+		return fmt.Errorf("%w: %s", ErrAccessCodeInvalid, code)
+	}
+	now := time.Now()
+	s.codes[i].UsedAt = &now
+	s.codes[i].UsedBy = email
+	return nil
+}
+
+func (s *AccessServiceMemory) ReleaseAccessCode(session string, code string, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.findCode(session, code); i >= 0 && s.codes[i].UsedBy == email {
+		s.codes[i].UsedAt = nil
+		s.codes[i].UsedBy = ""
+	}
+	return nil
+}
+
+func (s *AccessServiceMemory) AddInvites(session string, emails []string, createdBy string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := 0
+	now := time.Now()
+	for _, email := range emails {
+		email = strings.ToLower(email)
+		if s.findInvite(session, email) >= 0 {
+			continue
+		}
+		s.invites = append(s.invites, models.Invite{Session: session, Email: email, CreatedBy: createdBy, CreatedAt: now})
+		added++
+	}
+	return added, nil
+}
+
+func (s *AccessServiceMemory) GetInvites(session string) ([]models.Invite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invites := []models.Invite{}
+	for _, invite := range s.invites {
+		if invite.Session == session {
+			invites = append(invites, invite)
+		}
+	}
+	sort.SliceStable(invites, func(i, j int) bool {
+		return invites[i].Email < invites[j].Email
+	})
+	return invites, nil
+}
+
+func (s *AccessServiceMemory) IsInvited(session string, email string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.findInvite(session, strings.ToLower(email)) >= 0, nil
+}
+
+func (s *AccessServiceMemory) DeleteInvite(session string, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findInvite(session, strings.ToLower(email))
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrInviteNotFound, email)
+	}
+	s.invites = append(s.invites[:i], s.invites[i+1:]...)
+	return nil
+}
+
+func (s *AccessServiceMemory) RenameSession(oldName string, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.codes {
+		if s.codes[i].Session == oldName {
+			s.codes[i].Session = newName
+		}
+	}
+	for i := range s.invites {
+		if s.invites[i].Session == oldName {
+			s.invites[i].Session = newName
+		}
+	}
+	return nil
+}
+
+func (s *AccessServiceMemory) DeleteSessionAccess(session string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := s.codes[:0]
+	for _, code := range s.codes {
+		if code.Session != session {
+			codes = append(codes, code)
+		}
+	}
+	s.codes = codes
+	invites := s.invites[:0]
+	for _, invite := range s.invites {
+		if invite.Session != session {
+			invites = append(invites, invite)
+		}
+	}
+	s.invites = invites
+	return nil
+}
+
+func (s *AccessServiceMemory) findCode(session string, code string) int {
+	for i, c := range s.codes {
+		if c.Session == session && c.Code == code {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *AccessServiceMemory) findInvite(session string, email string) int {
+	for i, invite := range s.invites {
+		if invite.Session == session && invite.Email == email {
+			return i
+		}
+	}
+	return -1
+}
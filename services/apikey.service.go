@@ -0,0 +1,17 @@
+package services
+
+import (
+	"github.com/jefferyfry/eventengine/models"
+	"time"
+)
+
+type APIKeyService interface {
+	AddAPIKey(*models.APIKey) error
+	GetAPIKey(id string) (*models.APIKey, error)
+	// GetAPIKeys returns every key, including revoked and expired ones, newest first.
+	GetAPIKeys() ([]models.APIKey, error)
+	// RevokeAPIKey stops the key from being used. Revoking a key again keeps the first revocation.
+	RevokeAPIKey(id string, revokedBy string) (*models.APIKey, error)
+	// TouchAPIKey records that the key was used at usedAt from ip.
+	TouchAPIKey(id string, usedAt time.Time, ip string) error
+}
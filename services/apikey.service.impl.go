@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jefferyfry/eventengine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type APIKeyServiceImpl struct {
+	ctx              context.Context
+	apiKeys          *mongo.Collection
+	operationTimeout time.Duration
+}
+
+func NewAPIKeyServiceImpl(ctx context.Context, client *mongo.Client, mongoConfig MongoConfig) APIKeyService {
+	return &APIKeyServiceImpl{
+		ctx:              ctx,
+		apiKeys:          client.Database(mongoConfig.Database).Collection("api_keys"),
+		operationTimeout: mongoConfig.OperationTimeout,
+	}
+}
+
+func (s APIKeyServiceImpl) AddAPIKey(key *models.APIKey) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	_, err := s.apiKeys.InsertOne(ctx, key)
+	return err
+}
+
+func (s APIKeyServiceImpl) GetAPIKey(id string) (*models.APIKey, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	var key *models.APIKey
+	err := s.apiKeys.FindOne(ctx, bson.M{"_id": id}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s APIKeyServiceImpl) GetAPIKeys() ([]models.APIKey, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	keys := []models.APIKey{}
+	cursor, err := s.apiKeys.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s APIKeyServiceImpl) RevokeAPIKey(id string, revokedBy string) (*models.APIKey, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now(), "revokedBy": revokedBy}}
+	var key *models.APIKey
+	err := s.apiKeys.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		//already revoked, or unknown
+		return s.GetAPIKey(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s APIKeyServiceImpl) TouchAPIKey(id string, usedAt time.Time, ip string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	_, err := s.apiKeys.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastUsedAt": usedAt, "lastUsedIP": ip}})
+	return err
+}
+
+func (s APIKeyServiceImpl) operationContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.ctx, s.operationTimeout)
+}
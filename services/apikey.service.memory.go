@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"github.com/jefferyfry/eventengine/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// APIKeyServiceMemory is a thread-safe, in-memory APIKeyService for local development and tests.
+type APIKeyServiceMemory struct {
+	mu   sync.RWMutex
+	keys map[string]models.APIKey
+}
+
+func NewAPIKeyServiceMemory() APIKeyService {
+	return &APIKeyServiceMemory{keys: map[string]models.APIKey{}}
+}
+
+func (s *APIKeyServiceMemory) AddAPIKey(key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key.ID]; ok {
+		return fmt.Errorf("API key %s already exists", key.ID)
+	}
+	s.keys[key.ID] = *key
+	return nil
+}
+
+func (s *APIKeyServiceMemory) GetAPIKey(id string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	return &key, nil
+}
+
+func (s *APIKeyServiceMemory) GetAPIKeys() ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (s *APIKeyServiceMemory) RevokeAPIKey(id string, revokedBy string) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		key.RevokedBy = revokedBy
+		s.keys[id] = key
+	}
+	return &key, nil
+}
+
+func (s *APIKeyServiceMemory) TouchAPIKey(id string, usedAt time.Time, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	key.LastUsedAt = &usedAt
+	key.LastUsedIP = ip
+	s.keys[id] = key
+	return nil
+}
@@ -0,0 +1,13 @@
+package services
+
+import (
+	"github.com/jefferyfry/eventengine/models"
+)
+
+type CleanupRunService interface {
+	// AddCleanupRun stores a new run and assigns its ID.
+	AddCleanupRun(*models.CleanupRun) error
+	UpdateCleanupRun(*models.CleanupRun) error
+	// GetCleanupRuns returns the most recent runs, newest first.
+	GetCleanupRuns(limit int) ([]models.CleanupRun, error)
+}
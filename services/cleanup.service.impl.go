@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/jefferyfry/eventengine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type CleanupRunServiceImpl struct {
+	ctx              context.Context
+	cleanupRuns      *mongo.Collection
+	operationTimeout time.Duration
+}
+
+func NewCleanupRunServiceImpl(ctx context.Context, client *mongo.Client, mongoConfig MongoConfig) CleanupRunService {
+	return &CleanupRunServiceImpl{
+		ctx:              ctx,
+		cleanupRuns:      client.Database(mongoConfig.Database).Collection("cleanup_runs"),
+		operationTimeout: mongoConfig.OperationTimeout,
+	}
+}
+
+func (s CleanupRunServiceImpl) AddCleanupRun(run *models.CleanupRun) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	run.ID = primitive.NewObjectID().Hex()
+	_, err := s.cleanupRuns.InsertOne(ctx, run)
+	return err
+}
+
+func (s CleanupRunServiceImpl) UpdateCleanupRun(run *models.CleanupRun) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	result, err := s.cleanupRuns.ReplaceOne(ctx, bson.M{"_id": run.ID}, run)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("cleanup run %s not found", run.ID)
+	}
+	return nil
+}
+
+func (s CleanupRunServiceImpl) GetCleanupRuns(limit int) ([]models.CleanupRun, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	runs := []models.CleanupRun{}
+	findOptions := options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := s.cleanupRuns.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (s CleanupRunServiceImpl) operationContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.ctx, s.operationTimeout)
+}
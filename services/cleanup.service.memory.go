@@ -0,0 +1,51 @@
+package services
+
+import (
+	"fmt"
+	"github.com/jefferyfry/eventengine/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sync"
+)
+
+// CleanupRunServiceMemory is a thread-safe, in-memory CleanupRunService for local development and tests.
+type CleanupRunServiceMemory struct {
+	mu   sync.RWMutex
+	runs []models.CleanupRun
+}
+
+func NewCleanupRunServiceMemory() CleanupRunService {
+	return &CleanupRunServiceMemory{}
+}
+
+func (s *CleanupRunServiceMemory) AddCleanupRun(run *models.CleanupRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run.ID = primitive.NewObjectID().Hex()
+	s.runs = append(s.runs, *run)
+	return nil
+}
+
+func (s *CleanupRunServiceMemory) UpdateCleanupRun(run *models.CleanupRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.runs {
+		if s.runs[i].ID == run.ID {
+			s.runs[i] = *run
+			return nil
+		}
+	}
+	return fmt.Errorf("cleanup run %s not found", run.ID)
+}
+
+func (s *CleanupRunServiceMemory) GetCleanupRuns(limit int) ([]models.CleanupRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := []models.CleanupRun{}
+	for i := len(s.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		runs = append(runs, s.runs[i])
+	}
+	return runs, nil
+}
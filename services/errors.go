@@ -0,0 +1,33 @@
+package services
+
+import "errors"
+
+// Errors returned by the services. Implementations wrap them with detail, so match with errors.Is.
+var (
+	// ErrSessionNotFound is returned when no session has the requested name.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionExists is returned when adding or renaming a session to a name that is already taken.
+	ErrSessionExists = errors.New("session already exists")
+	// ErrConflict is returned when a change is not allowed in the current state of the resource.
+	ErrConflict = errors.New("conflict")
+	// ErrVersionConflict is returned by PatchSession when the session changed since the version the caller read.
+	ErrVersionConflict = errors.New("session was modified by someone else")
+	// ErrSessionFull is returned by ReserveSessionSeat when the session has reached MaxRegistrations.
+	ErrSessionFull = errors.New("event is full")
+	// ErrSessionExpired is returned when registering for a session past its expiry.
+	ErrSessionExpired = errors.New("session has expired")
+	// ErrRegistrationNotFound is returned when the email has no registration for the session.
+	ErrRegistrationNotFound = errors.New("registration not found")
+	// ErrRegistrationExists is returned when the email is already registered for the session.
+	ErrRegistrationExists = errors.New("already registered")
+	// ErrAPIKeyNotFound is returned when no API key has the requested id.
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrAccessCodeInvalid is returned when a registration has a wrong, missing or already used access code.
+	ErrAccessCodeInvalid = errors.New("access code is invalid")
+	// ErrNotInvited is returned when registering for an invite-only session with an email not on its list.
+	ErrNotInvited = errors.New("not invited")
+	// ErrInviteNotFound is returned when the email is not on the invite list of the session.
+	ErrInviteNotFound = errors.New("invite not found")
+	// ErrInvalid is returned for requests that are well-formed but semantically invalid.
+	ErrInvalid = errors.New("invalid request")
+)
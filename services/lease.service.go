@@ -0,0 +1,14 @@
+package services
+
+import (
+	"time"
+)
+
+// LeaseService grants named, time-limited leases so that one replica at a time can own a job.
+type LeaseService interface {
+	// AcquireLease takes the lease for owner, or renews it if owner already holds it, until ttl from now. It
+	// returns false while another owner holds an unexpired lease.
+	AcquireLease(name string, owner string, ttl time.Duration) (bool, error)
+	// ReleaseLease gives up the lease if owner holds it.
+	ReleaseLease(name string, owner string) error
+}
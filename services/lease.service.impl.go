@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type LeaseServiceImpl struct {
+	ctx              context.Context
+	leases           *mongo.Collection
+	operationTimeout time.Duration
+}
+
+// NewLeaseServiceImpl returns a LeaseService backed by the leases collection. Each lease is one document
+// keyed by name. Expiry is judged by the replicas' clocks, so leases should be much longer than their skew.
+func NewLeaseServiceImpl(ctx context.Context, client *mongo.Client, mongoConfig MongoConfig) LeaseService {
+	return &LeaseServiceImpl{
+		ctx:              ctx,
+		leases:           client.Database(mongoConfig.Database).Collection("leases"),
+		operationTimeout: mongoConfig.OperationTimeout,
+	}
+}
+
+func (s LeaseServiceImpl) AcquireLease(name string, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expiresAt": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(ttl), "renewedAt": now}}
+	//the upsert only inserts when no lease document exists. A held lease fails the filter and the insert then
+	//collides with its _id.
+	_, err := s.leases.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s LeaseServiceImpl) ReleaseLease(name string, owner string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	_, err := s.leases.DeleteOne(ctx, bson.M{"_id": name, "owner": owner})
+	return err
+}
+
+func (s LeaseServiceImpl) operationContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.ctx, s.operationTimeout)
+}
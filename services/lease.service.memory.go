@@ -0,0 +1,43 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryLease struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// LeaseServiceMemory is a thread-safe, in-memory LeaseService. Leases are only shared within the process.
+type LeaseServiceMemory struct {
+	mu     sync.Mutex
+	leases map[string]memoryLease
+}
+
+func NewLeaseServiceMemory() LeaseService {
+	return &LeaseServiceMemory{leases: map[string]memoryLease{}}
+}
+
+func (s *LeaseServiceMemory) AcquireLease(name string, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if lease, ok := s.leases[name]; ok && lease.owner != owner && lease.expiresAt.After(now) {
+		return false, nil
+	}
+	s.leases[name] = memoryLease{owner, now.Add(ttl)}
+	return true, nil
+}
+
+func (s *LeaseServiceMemory) ReleaseLease(name string, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lease, ok := s.leases[name]; ok && lease.owner == owner {
+		delete(s.leases, name)
+	}
+	return nil
+}
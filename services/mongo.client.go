@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/jefferyfry/eventengine/config"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"time"
+)
+
+type MongoConfig struct {
+	URI                    string
+	Host                   string
+	Username               string
+	Password               string
+	AuthSource             string
+	AuthMechanism          string
+	Database               string
+	MaxPoolSize            uint64
+	MinPoolSize            uint64
+	MaxConnIdleTime        time.Duration
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	OperationTimeout       time.Duration
+}
+
+// MongoConfigFromEnv reads the mongo connection settings. mongo_uri takes precedence over mongo_host.
+func MongoConfigFromEnv() MongoConfig {
+	return MongoConfig{
+		URI:                    config.GetString("mongo_uri", ""),
+		Host:                   config.GetString("mongo_host", "localhost"),
+		Username:               config.GetString("mongo_usr", ""),
+		Password:               config.GetString("mongo_pwd", ""),
+		AuthSource:             config.GetString("mongo_auth_source", "eventengine"),
+		AuthMechanism:          config.GetString("mongo_auth_mechanism", "SCRAM-SHA-256"),
+		Database:               config.GetString("mongo_db", "eventengine"),
+		MaxPoolSize:            uint64(config.GetInt("mongo_max_pool_size", 100)),
+		MinPoolSize:            uint64(config.GetInt("mongo_min_pool_size", 0)),
+		MaxConnIdleTime:        config.GetDuration("mongo_max_conn_idle_time", 5*time.Minute),
+		ConnectTimeout:         config.GetDuration("mongo_connect_timeout", 10*time.Second),
+		ServerSelectionTimeout: config.GetDuration("mongo_server_selection_timeout", 10*time.Second),
+		OperationTimeout:       config.GetDuration("mongo_op_timeout", 10*time.Second),
+	}
+}
+
+// NewMongoClient creates the shared, pooled mongo client and verifies the server is reachable.
+// The caller owns the client and must Disconnect it on shutdown.
+func NewMongoClient(ctx context.Context, mongoConfig MongoConfig) (*mongo.Client, error) {
+	uri := mongoConfig.URI
+	if uri == "" {
+		uri = "mongodb://" + mongoConfig.Host + ":27017"
+	}
+	clientOptions := options.Client().
+		ApplyURI(uri).
+		SetMaxPoolSize(mongoConfig.MaxPoolSize).
+		SetMinPoolSize(mongoConfig.MinPoolSize).
+		SetMaxConnIdleTime(mongoConfig.MaxConnIdleTime).
+		SetConnectTimeout(mongoConfig.ConnectTimeout).
+		SetServerSelectionTimeout(mongoConfig.ServerSelectionTimeout)
+	if mongoConfig.Username != "" {
+		clientOptions.SetAuth(options.Credential{
+			AuthSource:    mongoConfig.AuthSource,
+			AuthMechanism: mongoConfig.AuthMechanism,
+			Username:      mongoConfig.Username,
+			Password:      mongoConfig.Password,
+		})
+	}
+
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error creating mongo client: %w", err)
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, mongoConfig.ConnectTimeout)
+	defer cancel()
+	if err := client.Ping(pingCtx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("error connecting to mongo: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	schemaCollection = "schema"
+	schemaDocumentID = "eventengine"
+	schemaLockTTL    = 5 * time.Minute
+)
+
+type collectionIndex struct {
+	collection string
+	model      mongo.IndexModel
+}
+
+// indexes are created on every startup. Creating an index that already exists is a no-op.
+var indexes = []collectionIndex{
+	{"sessions", mongo.IndexModel{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetName("name_unique").SetUnique(true)}},
+	{"sessions", mongo.IndexModel{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetName("expiresAt")}},
+	{"sessions", mongo.IndexModel{Keys: bson.D{{Key: "lifecycle", Value: 1}}, Options: options.Index().SetName("lifecycle")}},
+	{"sessions", mongo.IndexModel{Keys: bson.D{{Key: "owner", Value: 1}}, Options: options.Index().SetName("owner")}},
+	{"sessions", mongo.IndexModel{Keys: bson.D{{Key: "team", Value: 1}}, Options: options.Index().SetName("team")}},
+	{"sessions", mongo.IndexModel{Keys: bson.D{{Key: "coHosts", Value: 1}}, Options: options.Index().SetName("coHosts")}},
+	{"registrations", mongo.IndexModel{Keys: bson.D{{Key: "session", Value: 1}, {Key: "email", Value: 1}}, Options: options.Index().SetName("session_email_unique").SetUnique(true)}},
+	{"registrations", mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "updatedAt", Value: 1}}, Options: options.Index().SetName("status_updatedAt")}},
+	{"cleanup_runs", mongo.IndexModel{Keys: bson.D{{Key: "startedAt", Value: -1}}, Options: options.Index().SetName("startedAt")}},
+	{"api_keys", mongo.IndexModel{Keys: bson.D{{Key: "createdAt", Value: -1}}, Options: options.Index().SetName("createdAt")}},
+	{"access_codes", mongo.IndexModel{Keys: bson.D{{Key: "session", Value: 1}, {Key: "code", Value: 1}}, Options: options.Index().SetName("session_code_unique").SetUnique(true)}},
+	{"invites", mongo.IndexModel{Keys: bson.D{{Key: "session", Value: 1}, {Key: "email", Value: 1}}, Options: options.Index().SetName("session_email_unique").SetUnique(true)}},
+	{"leases", mongo.IndexModel{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0)}},
+}
+
+type migration struct {
+	version     int
+	description string
+	up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// migrations run in order, exactly once per database. Append new migrations with the next version and never
+// change or reorder existing ones.
+var migrations = []migration{
+	{1, "backfill session version", func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("sessions").UpdateMany(ctx, bson.M{"version": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"version": 1}})
+		return err
+	}},
+	{2, "mark sessions that predate registration records", func(ctx context.Context, db *mongo.Database) error {
+		_, err := db.Collection("sessions").UpdateMany(ctx, bson.M{"regCount": bson.M{"$gt": 0}}, bson.M{"$set": bson.M{"legacyUsers": true}})
+		return err
+	}},
+}
+
+type schemaDocument struct {
+	ID          string    `bson:"_id"`
+	Version     int       `bson:"version"`
+	LockedBy    string    `bson:"lockedBy,omitempty"`
+	LockedUntil time.Time `bson:"lockedUntil,omitempty"`
+	UpdatedAt   time.Time `bson:"updatedAt"`
+}
+
+// EnsureSchema creates the indexes and runs pending migrations. A lock on the schema document keeps
+// concurrently starting replicas from running the same migration twice.
+func EnsureSchema(ctx context.Context, client *mongo.Client, mongoConfig MongoConfig) error {
+	db := client.Database(mongoConfig.Database)
+
+	for _, index := range indexes {
+		if _, err := db.Collection(index.collection).Indexes().CreateOne(ctx, index.model); err != nil {
+			return fmt.Errorf("unable to create index on %s: %w", index.collection, err)
+		}
+	}
+
+	owner, _ := os.Hostname()
+	owner = fmt.Sprintf("%s-%d", owner, time.Now().UnixNano())
+	schema := db.Collection(schemaCollection)
+	deadline := time.Now().Add(schemaLockTTL)
+	for {
+		locked, err := acquireSchemaLock(ctx, schema, owner)
+		if err != nil {
+			return err
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the schema migration lock")
+		}
+		log.Println("Waiting for another instance to finish schema migrations.")
+		time.Sleep(2 * time.Second)
+	}
+	defer func() {
+		if _, err := schema.UpdateOne(context.Background(), bson.M{"_id": schemaDocumentID, "lockedBy": owner},
+			bson.M{"$unset": bson.M{"lockedBy": "", "lockedUntil": ""}}); err != nil {
+			log.Printf("Unable to release the schema migration lock: %s", err)
+		}
+	}()
+
+	var current schemaDocument
+	if err := schema.FindOne(ctx, bson.M{"_id": schemaDocumentID}).Decode(&current); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= current.Version {
+			continue
+		}
+		log.Printf("Running schema migration %d: %s", m.version, m.description)
+		if err := m.up(ctx, db); err != nil {
+			return fmt.Errorf("schema migration %d failed: %w", m.version, err)
+		}
+		if _, err := schema.UpdateOne(ctx, bson.M{"_id": schemaDocumentID},
+			bson.M{"$set": bson.M{"version": m.version, "updatedAt": time.Now()}}); err != nil {
+			return err
+		}
+		current.Version = m.version
+	}
+	log.Printf("Database schema is at version %d.", current.Version)
+	return nil
+}
+
+func acquireSchemaLock(ctx context.Context, schema *mongo.Collection, owner string) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": schemaDocumentID,
+		"$or": bson.A{
+			bson.M{"lockedUntil": bson.M{"$exists": false}},
+			bson.M{"lockedUntil": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set":         bson.M{"lockedBy": owner, "lockedUntil": now.Add(schemaLockTTL)},
+		"$setOnInsert": bson.M{"version": 0, "updatedAt": now},
+	}
+	_, err := schema.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		//the document exists and is locked by someone else
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %d has version %d, want versions to count up from 1", i, m.version)
+		}
+		if m.description == "" || m.up == nil {
+			t.Errorf("migration %d needs a description and an up function", m.version)
+		}
+	}
+}
+
+func TestIndexesAreNamedUniquely(t *testing.T) {
+	names := map[string]bool{}
+	for _, index := range indexes {
+		if index.model.Options == nil || index.model.Options.Name == nil {
+			t.Errorf("index on %s has no name", index.collection)
+			continue
+		}
+		key := index.collection + "." + *index.model.Options.Name
+		if names[key] {
+			t.Errorf("index %s is declared twice", key)
+		}
+		names[key] = true
+	}
+	if !names["sessions.name_unique"] {
+		t.Error("sessions has no unique name index")
+	}
+}
+
+// TestEnsureSchema runs against the mongo named by eventengine_test_mongo_uri and is skipped without one.
+func TestEnsureSchema(t *testing.T) {
+	uri := os.Getenv("eventengine_test_mongo_uri")
+	if uri == "" {
+		t.Skip("eventengine_test_mongo_uri is not set")
+	}
+	ctx := context.Background()
+	mongoConfig := MongoConfig{
+		URI:                    uri,
+		Database:               fmt.Sprintf("eventengine_test_%d", time.Now().UnixNano()),
+		MaxPoolSize:            10,
+		ConnectTimeout:         5 * time.Second,
+		ServerSelectionTimeout: 5 * time.Second,
+	}
+	client, err := NewMongoClient(ctx, mongoConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database(mongoConfig.Database)
+	defer func() {
+		db.Drop(ctx)
+		client.Disconnect(ctx)
+	}()
+
+	sessions := db.Collection("sessions")
+	if _, err := sessions.InsertMany(ctx, []interface{}{
+		bson.M{"name": "legacy", "regCount": 3},
+		bson.M{"name": "unused", "regCount": 0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	//replicas starting together must run each migration once and all succeed
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = EnsureSchema(ctx, client, mongoConfig)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("EnsureSchema() = %v", err)
+		}
+	}
+	if err := EnsureSchema(ctx, client, mongoConfig); err != nil {
+		t.Fatalf("EnsureSchema() again = %v", err)
+	}
+
+	var schema schemaDocument
+	if err := db.Collection(schemaCollection).FindOne(ctx, bson.M{"_id": schemaDocumentID}).Decode(&schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema.Version != len(migrations) || schema.LockedBy != "" {
+		t.Errorf("schema = %+v, want version %d and no lock", schema, len(migrations))
+	}
+
+	for name, wantLegacy := range map[string]bool{"legacy": true, "unused": false} {
+		var session bson.M
+		if err := sessions.FindOne(ctx, bson.M{"name": name}).Decode(&session); err != nil {
+			t.Fatal(err)
+		}
+		if session["version"] != int32(1) {
+			t.Errorf("session %s version = %v, want 1", name, session["version"])
+		}
+		if legacy, _ := session["legacyUsers"].(bool); legacy != wantLegacy {
+			t.Errorf("session %s legacyUsers = %v, want %v", name, legacy, wantLegacy)
+		}
+	}
+	if _, err := sessions.InsertOne(ctx, bson.M{"name": "legacy"}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("inserting a duplicate session name = %v, want a duplicate key error", err)
+	}
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"github.com/jefferyfry/eventengine/models"
+	"time"
+)
+
+type RegistrationService interface {
+	// AddRegistration records a new registration. It returns ErrRegistrationExists if the email already has
+	// an active registration for the session and replaces failed or deleted ones.
+	AddRegistration(*models.Registration) (*models.Registration, error)
+	UpdateRegistration(*models.Registration) error
+	GetRegistration(session string, email string) (*models.Registration, error)
+	GetRegistrationsBySession(session string) ([]models.Registration, error)
+	// FindRegistrations returns one page of the session's registrations matching query, oldest first, and
+	// the total number of matches.
+	FindRegistrations(session string, query models.RegistrationQuery) ([]models.Registration, int64, error)
+	// GetStaleRegistrations returns registrations in one of statuses that have not been updated since
+	// updatedBefore, oldest first.
+	GetStaleRegistrations(statuses []string, updatedBefore time.Time) ([]models.Registration, error)
+	DeleteRegistrationsBySession(session string) error
+	// RenameSession moves the registrations of a renamed session to its new name.
+	RenameSession(oldName string, newName string) error
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jefferyfry/eventengine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type RegistrationServiceImpl struct {
+	ctx              context.Context
+	registrations    *mongo.Collection
+	operationTimeout time.Duration
+}
+
+func NewRegistrationServiceImpl(ctx context.Context, client *mongo.Client, mongoConfig MongoConfig) RegistrationService {
+	return &RegistrationServiceImpl{
+		ctx:              ctx,
+		registrations:    client.Database(mongoConfig.Database).Collection("registrations"),
+		operationTimeout: mongoConfig.OperationTimeout,
+	}
+}
+
+func (s RegistrationServiceImpl) AddRegistration(registration *models.Registration) (*models.Registration, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	registration.Email = normalizeEmail(registration.Email)
+	registration.CreatedAt = time.Now()
+	registration.UpdatedAt = registration.CreatedAt
+
+	//a failed or deleted registration can be replaced by a new attempt
+	filter := bson.M{
+		"session": registration.Session,
+		"email":   registration.Email,
+		"status":  bson.M{"$in": bson.A{models.REGISTRATION_STATUS_FAILED, models.REGISTRATION_STATUS_DELETED}},
+	}
+	result, err := s.registrations.ReplaceOne(ctx, filter, registration)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 1 {
+		return registration, nil
+	}
+
+	_, err = s.registrations.InsertOne(ctx, registration)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("%w: %s", ErrRegistrationExists, registration.Email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return registration, nil
+}
+
+func (s RegistrationServiceImpl) UpdateRegistration(registration *models.Registration) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	registration.UpdatedAt = time.Now()
+	filter := bson.M{"session": registration.Session, "email": registration.Email}
+	result, err := s.registrations.ReplaceOne(ctx, filter, registration)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrRegistrationNotFound, registration.Email)
+	}
+	return nil
+}
+
+func (s RegistrationServiceImpl) GetRegistration(session string, email string) (*models.Registration, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	email = normalizeEmail(email)
+	var registration *models.Registration
+	err := s.registrations.FindOne(ctx, bson.M{"session": session, "email": email}).Decode(&registration)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrRegistrationNotFound, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return registration, nil
+}
+
+func (s RegistrationServiceImpl) GetRegistrationsBySession(session string) ([]models.Registration, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	var registrations []models.Registration
+	cursor, err := s.registrations.Find(ctx, bson.M{"session": session}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &registrations); err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+func (s RegistrationServiceImpl) FindRegistrations(session string, query models.RegistrationQuery) ([]models.Registration, int64, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{"session": session}
+	if query.Status != "" {
+		filter["status"] = query.Status
+	}
+	if search := strings.TrimSpace(query.Search); search != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(search), "$options": "i"}
+		filter["$or"] = bson.A{
+			bson.M{"email": pattern},
+			bson.M{"firstName": pattern},
+			bson.M{"lastName": pattern},
+			bson.M{"company": pattern},
+		}
+	}
+	total, err := s.registrations.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetSkip(int64(query.Skip()))
+	if query.PageSize > 0 {
+		findOptions.SetLimit(int64(query.PageSize))
+	}
+	registrations := []models.Registration{}
+	cursor, err := s.registrations.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err = cursor.All(ctx, &registrations); err != nil {
+		return nil, 0, err
+	}
+	return registrations, total, nil
+}
+
+func (s RegistrationServiceImpl) GetStaleRegistrations(statuses []string, updatedBefore time.Time) ([]models.Registration, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{"status": bson.M{"$in": statuses}, "updatedAt": bson.M{"$lt": updatedBefore}}
+	var registrations []models.Registration
+	cursor, err := s.registrations.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "updatedAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &registrations); err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+func (s RegistrationServiceImpl) DeleteRegistrationsBySession(session string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	_, err := s.registrations.DeleteMany(ctx, bson.M{"session": session})
+	return err
+}
+
+func (s RegistrationServiceImpl) RenameSession(oldName string, newName string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	_, err := s.registrations.UpdateMany(ctx, bson.M{"session": oldName}, bson.M{"$set": bson.M{"session": newName}})
+	return err
+}
+
+func (s RegistrationServiceImpl) operationContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.ctx, s.operationTimeout)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
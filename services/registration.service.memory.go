@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"github.com/jefferyfry/eventengine/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type registrationKey struct {
+	session string
+	email   string
+}
+
+// RegistrationServiceMemory is a thread-safe, in-memory RegistrationService for local development and tests.
+type RegistrationServiceMemory struct {
+	mu            sync.RWMutex
+	registrations map[registrationKey]models.Registration
+}
+
+func NewRegistrationServiceMemory() RegistrationService {
+	return &RegistrationServiceMemory{registrations: map[registrationKey]models.Registration{}}
+}
+
+func (s *RegistrationServiceMemory) AddRegistration(registration *models.Registration) (*models.Registration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registration.Email = normalizeEmail(registration.Email)
+	key := registrationKey{registration.Session, registration.Email}
+	if existing, ok := s.registrations[key]; ok &&
+		existing.Status != models.REGISTRATION_STATUS_FAILED && existing.Status != models.REGISTRATION_STATUS_DELETED {
+		return nil, fmt.Errorf("%w: %s", ErrRegistrationExists, registration.Email)
+	}
+	registration.CreatedAt = time.Now()
+	registration.UpdatedAt = registration.CreatedAt
+	s.registrations[key] = *registration
+	return registration, nil
+}
+
+func (s *RegistrationServiceMemory) UpdateRegistration(registration *models.Registration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := registrationKey{registration.Session, registration.Email}
+	if _, ok := s.registrations[key]; !ok {
+		return fmt.Errorf("%w: %s", ErrRegistrationNotFound, registration.Email)
+	}
+	registration.UpdatedAt = time.Now()
+	s.registrations[key] = *registration
+	return nil
+}
+
+func (s *RegistrationServiceMemory) GetRegistration(session string, email string) (*models.Registration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	email = normalizeEmail(email)
+	registration, ok := s.registrations[registrationKey{session, email}]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRegistrationNotFound, email)
+	}
+	return &registration, nil
+}
+
+func (s *RegistrationServiceMemory) GetRegistrationsBySession(session string) ([]models.Registration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var registrations []models.Registration
+	for key, registration := range s.registrations {
+		if key.session == session {
+			registrations = append(registrations, registration)
+		}
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].CreatedAt.Before(registrations[j].CreatedAt)
+	})
+	return registrations, nil
+}
+
+func (s *RegistrationServiceMemory) FindRegistrations(session string, query models.RegistrationQuery) ([]models.Registration, int64, error) {
+	all, err := s.GetRegistrationsBySession(session)
+	if err != nil {
+		return nil, 0, err
+	}
+	search := strings.ToLower(strings.TrimSpace(query.Search))
+	matches := []models.Registration{}
+	for _, registration := range all {
+		if query.Status != "" && registration.Status != query.Status {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(strings.Join([]string{registration.Email,
+			registration.FirstName, registration.LastName, registration.Company}, "\n")), search) {
+			continue
+		}
+		matches = append(matches, registration)
+	}
+	total := int64(len(matches))
+	start := query.Skip()
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := len(matches)
+	if query.PageSize > 0 && start+query.PageSize < end {
+		end = start + query.PageSize
+	}
+	return matches[start:end], total, nil
+}
+
+func (s *RegistrationServiceMemory) GetStaleRegistrations(statuses []string, updatedBefore time.Time) ([]models.Registration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var registrations []models.Registration
+	for _, registration := range s.registrations {
+		if registration.UpdatedAt.Before(updatedBefore) && containsString(statuses, registration.Status) {
+			registrations = append(registrations, registration)
+		}
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].UpdatedAt.Before(registrations[j].UpdatedAt)
+	})
+	return registrations, nil
+}
+
+func (s *RegistrationServiceMemory) DeleteRegistrationsBySession(session string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.registrations {
+		if key.session == session {
+			delete(s.registrations, key)
+		}
+	}
+	return nil
+}
+
+func (s *RegistrationServiceMemory) RenameSession(oldName string, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, registration := range s.registrations {
+		if key.session == oldName {
+			delete(s.registrations, key)
+			registration.Session = newName
+			s.registrations[registrationKey{newName, key.email}] = registration
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
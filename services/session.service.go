@@ -7,9 +7,27 @@ import (
 type SessionService interface {
 	GetSessionByName(string) (*models.Session, error)
 	GetAllSessions() ([]models.Session, error)
+	// GetSessionsInScope returns the sessions the scope may view.
+	GetSessionsInScope(models.SessionScope) ([]models.Session, error)
 	AddSession(*models.Session) (*models.Session, error)
-	UpdateSession(string, *models.Session) (*models.Session, error)
+	// PatchSession sets only the fields present in the patch. A non-zero patch Version must match the stored
+	// version or ErrVersionConflict is returned.
+	PatchSession(string, *models.SessionPatchReq) (*models.Session, error)
 	DeleteSession(string) error
 	DeleteSessions([]string) error
-	IncrementSessionRegCount(string) error
+	// ReserveSessionSeat atomically increments the registration count if the session has capacity left and
+	// has not expired.
+	ReserveSessionSeat(string) error
+	// ReleaseSessionSeat gives back a seat taken by ReserveSessionSeat when a registration fails.
+	ReleaseSessionSeat(string) error
+	// UpdateSessionLifecycle stores the lifecycle and cleanup fields of the session, LegacyUsers included. The
+	// stored Version and LifecycleVersion must still match the session's or ErrVersionConflict is returned. Only
+	// session.LifecycleVersion is advanced on success, so the session's ETag does not change.
+	UpdateSessionLifecycle(*models.Session) error
+	// GetSessionsByLifecycle returns the sessions in any of the lifecycle states.
+	GetSessionsByLifecycle(...string) ([]models.Session, error)
+	// AddSessionCoHost shares the session with a principal id. Adding a co-host twice is a no-op.
+	AddSessionCoHost(string, string) (*models.Session, error)
+	// RemoveSessionCoHost stops sharing the session with a principal id.
+	RemoveSessionCoHost(string, string) (*models.Session, error)
 }
@@ -4,76 +4,129 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/jefferyfry/eventengine/keyring"
 	"github.com/jefferyfry/eventengine/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
-	"os"
 	"time"
 )
 
 type SessionServiceImpl struct {
-	ctx context.Context
+	ctx              context.Context
+	sessions         *mongo.Collection
+	operationTimeout time.Duration
+	keyring          *keyring.Keyring
 }
 
-func NewSessionServiceImpl(ctx context.Context) SessionService {
-	return &SessionServiceImpl{ctx}
+// NewSessionServiceImpl returns a SessionService backed by the shared mongo client. The client pool is
+// reused by every call, so the service never dials or disconnects on its own. Lacework credentials are
+// encrypted with keyring before they are stored, or stored in plaintext when keyring is nil.
+func NewSessionServiceImpl(ctx context.Context, client *mongo.Client, mongoConfig MongoConfig, keyring *keyring.Keyring) *SessionServiceImpl {
+	if keyring == nil {
+		log.Println("No secret keys configured. Lacework credentials will be stored unencrypted.")
+	}
+	return &SessionServiceImpl{
+		ctx:              ctx,
+		sessions:         client.Database(mongoConfig.Database).Collection("sessions"),
+		operationTimeout: mongoConfig.OperationTimeout,
+		keyring:          keyring,
+	}
 }
 
 func (s SessionServiceImpl) GetSessionByName(name string) (*models.Session, error) {
-	client := getMongoClient()
-	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
-			log.Println(err)
-		}
-	}()
-	filter := bson.D{{"name", name}}
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{"name": name}
 	var session *models.Session
-	err := client.Database("eventengine").Collection("sessions").FindOne(context.Background(), filter).Decode(&session)
+	err := s.sessions.FindOne(ctx, filter).Decode(&session)
 	if errors.Is(err, mongo.ErrNoDocuments) {
-		return nil, errors.New(fmt.Sprintf("No session was found with the name %s\n", name))
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, name)
 	}
 	if err != nil {
 		return nil, err
 	}
+	if err := s.decryptSecrets(session); err != nil {
+		return nil, err
+	}
 	return session, nil
 }
 
 func (s SessionServiceImpl) GetAllSessions() ([]models.Session, error) {
-	client := getMongoClient()
-	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
-			log.Println(err)
-		}
-	}()
-	filter := bson.D{{}}
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{}
 	var sessions []models.Session
-	cursor, err := client.Database("eventengine").Collection("sessions").Find(context.Background(), filter)
+	cursor, err := s.sessions.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
-	if err = cursor.All(context.TODO(), &sessions); err != nil {
+	if err = cursor.All(ctx, &sessions); err != nil {
 		return nil, err
 	}
+	for i := range sessions {
+		if err := s.decryptSecrets(&sessions[i]); err != nil {
+			return nil, err
+		}
+	}
 	return sessions, nil
 }
 
-func (s SessionServiceImpl) AddSession(session *models.Session) (*models.Session, error) {
-	sessionCheck, _ := s.GetSessionByName(session.Name)
-	if sessionCheck != nil {
-		return nil, errors.New("Session already exists.")
+func (s SessionServiceImpl) GetSessionsInScope(scope models.SessionScope) ([]models.Session, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	var sessions []models.Session
+	cursor, err := s.sessions.Find(ctx, scopeFilter(scope))
+	if err != nil {
+		return nil, err
 	}
-	client := getMongoClient()
-	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
-			log.Println(err)
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		if err := s.decryptSecrets(&sessions[i]); err != nil {
+			return nil, err
 		}
-	}()
+	}
+	return sessions, nil
+}
+
+// scopeFilter matches what models.SessionScope.CanView allows.
+func scopeFilter(scope models.SessionScope) bson.M {
+	if scope.All {
+		return bson.M{}
+	}
+	unscoped := bson.M{"owner": bson.M{"$in": bson.A{nil, ""}}, "team": bson.M{"$in": bson.A{nil, ""}}}
+	or := bson.A{unscoped}
+	if scope.Principal != "" {
+		or = append(or, bson.M{"owner": scope.Principal}, bson.M{"coHosts": scope.Principal})
+	}
+	if len(scope.Teams) > 0 {
+		or = append(or, bson.M{"team": bson.M{"$in": scope.Teams}})
+	}
+	return bson.M{"$or": or}
+}
+
+func (s SessionServiceImpl) AddSession(session *models.Session) (*models.Session, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
 
 	session.CreatedAt = time.Now()
 	session.UpdatedAt = session.CreatedAt
-	_, err := client.Database("eventengine").Collection("sessions").InsertOne(context.TODO(), session)
+	session.Version = 1
+	session.Lifecycle = models.SESSION_LIFECYCLE_ACTIVE
+	stored := *session
+	if err := s.encryptSecrets(&stored); err != nil {
+		return nil, err
+	}
+	_, err := s.sessions.InsertOne(ctx, stored)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrSessionExists
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -81,52 +134,116 @@ func (s SessionServiceImpl) AddSession(session *models.Session) (*models.Session
 	return session, nil
 }
 
-func (s SessionServiceImpl) UpdateSession(name string, session *models.Session) (*models.Session, error) {
-	sessionCheck, err := s.GetSessionByName(session.Name)
+func (s SessionServiceImpl) PatchSession(name string, patch *models.SessionPatchReq) (*models.Session, error) {
+	update, err := s.patchUpdate(patch)
 	if err != nil {
 		return nil, err
 	}
-	if sessionCheck == nil {
-		return nil, errors.New("Session does not exist.")
+
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{"name": name}
+	if patch.Version > 0 {
+		filter["version"] = patch.Version
 	}
-	client := getMongoClient()
-	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
-			log.Println(err)
+	var session *models.Session
+	err = s.sessions.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := s.GetSessionByName(name); err != nil {
+			return nil, err
 		}
-	}()
-
-	session.UpdatedAt = time.Now()
-	filter := bson.D{{"name", name}}
-	_, err = client.Database("eventengine").Collection("sessions").UpdateOne(context.TODO(), filter, session)
+		return nil, ErrVersionConflict
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrSessionExists
+	}
 	if err != nil {
 		return nil, err
 	}
-
+	if err := s.decryptSecrets(session); err != nil {
+		return nil, err
+	}
 	return session, nil
 }
 
-func (s SessionServiceImpl) DeleteSession(name string) error {
-	sessionCheck, err := s.GetSessionByName(name)
-	if err != nil {
-		return err
+// patchUpdate builds the update document for the fields set in patch.
+func (s SessionServiceImpl) patchUpdate(patch *models.SessionPatchReq) (bson.M, error) {
+	set := bson.M{"updatedAt": time.Now()}
+	setIfPresent := func(key string, value *string) {
+		if value != nil {
+			set[key] = *value
+		}
 	}
-	if sessionCheck == nil {
-		errors.New("Session does not exist.")
+	setIfPresent("name", patch.Name)
+	setIfPresent("instanceType", patch.InstanceType)
+	setIfPresent("lwUrl", patch.LwUrl)
+	setIfPresent("lwSubAccount", patch.LwSubAccount)
+	setIfPresent("lwUserGroup", patch.LwUserGroup)
+	setIfPresent("updatedBy", patch.UpdatedBy)
+	setIfPresent("team", patch.Team)
+	setIfPresent("accessMode", patch.AccessMode)
+	setIfPresent("accessCode", patch.AccessCode)
+	if patch.Owner != nil {
+		set["owner"] = models.NormalizePrincipal(*patch.Owner)
+	}
+	if patch.AllowedEmailDomains != nil {
+		set["allowedEmailDomains"] = models.NormalizeEmailDomains(*patch.AllowedEmailDomains)
+	}
+	if patch.BlockedEmailDomains != nil {
+		set["blockedEmailDomains"] = models.NormalizeEmailDomains(*patch.BlockedEmailDomains)
+	}
+	if patch.ExpiresAt != nil {
+		set["expiresAt"] = *patch.ExpiresAt
+	}
+	if patch.MaxRegistrations != nil {
+		set["maxRegistrations"] = *patch.MaxRegistrations
+	}
+	//blank credentials keep the stored ones since responses never echo them back
+	credentials := models.Session{}
+	if patch.LwAccessKeyID != nil {
+		credentials.LwAccessKeyID = *patch.LwAccessKeyID
+	}
+	if patch.LwSecretKey != nil {
+		credentials.LwSecretKey = *patch.LwSecretKey
+	}
+	if err := s.encryptSecrets(&credentials); err != nil {
+		return nil, err
+	}
+	//an encrypted credential replaces any plaintext left from before encryption was enabled
+	unset := bson.M{}
+	if credentials.LwAccessKeyIDEnc != nil {
+		set["lwAccessKeyIDEnc"] = credentials.LwAccessKeyIDEnc
+		unset["lwAccessKeyID"] = ""
+	} else if credentials.LwAccessKeyID != "" {
+		set["lwAccessKeyID"] = credentials.LwAccessKeyID
+	}
+	if credentials.LwSecretKeyEnc != nil {
+		set["lwSecretKeyEnc"] = credentials.LwSecretKeyEnc
+		unset["lwSecretKey"] = ""
+	} else if credentials.LwSecretKey != "" {
+		set["lwSecretKey"] = credentials.LwSecretKey
 	}
-	client := getMongoClient()
-	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
-			log.Println(err)
-		}
-	}()
 
-	filter := bson.D{{"name", name}}
-	_, err = client.Database("eventengine").Collection("sessions").DeleteOne(context.TODO(), filter)
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update, nil
+}
+
+func (s SessionServiceImpl) DeleteSession(name string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{"name": name}
+	result, err := s.sessions.DeleteOne(ctx, filter)
 	if err != nil {
 		return err
 	}
-
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+	}
 	return nil
 }
 
@@ -139,44 +256,239 @@ func (s SessionServiceImpl) DeleteSessions(sessions []string) error {
 	return nil
 }
 
-func (s SessionServiceImpl) IncrementSessionRegCount(name string) error {
-	session, err := s.GetSessionByName(name)
+func (s SessionServiceImpl) ReserveSessionSeat(name string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"name":      name,
+		"expiresAt": bson.M{"$gt": now},
+		"lifecycle": bson.M{"$nin": bson.A{models.SESSION_LIFECYCLE_CLEANUP_PENDING, models.SESSION_LIFECYCLE_CLEANED, models.SESSION_LIFECYCLE_CLEANUP_FAILED}},
+		"$or": bson.A{
+			bson.M{"maxRegistrations": bson.M{"$exists": false}},
+			bson.M{"maxRegistrations": bson.M{"$lte": 0}},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$regCount", "$maxRegistrations"}}},
+		},
+	}
+	update := bson.M{"$inc": bson.M{"regCount": 1}, "$set": bson.M{"updatedAt": now}}
+	result, err := s.sessions.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
-	if session == nil {
-		return errors.New("Session does not exist.")
-	}
-	client := getMongoClient()
-	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
-			log.Println(err)
+	if result.MatchedCount == 0 {
+		//the session is gone, expired or has no seats left
+		session, err := s.GetSessionByName(name)
+		if err != nil {
+			return err
+		}
+		if !session.ExpiresAt.After(now) || session.InCleanup() {
+			return ErrSessionExpired
 		}
-	}()
+		return ErrSessionFull
+	}
+	return nil
+}
+
+func (s SessionServiceImpl) ReleaseSessionSeat(name string) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{"name": name, "regCount": bson.M{"$gt": 0}}
+	update := bson.M{"$inc": bson.M{"regCount": -1}, "$set": bson.M{"updatedAt": time.Now()}}
+	_, err := s.sessions.UpdateOne(ctx, filter, update)
+	return err
+}
 
-	session.UpdatedAt = time.Now()
-	session.RegCount += 1
-	filter := bson.D{{"name", name}}
-	_, err = client.Database("eventengine").Collection("sessions").UpdateOne(context.TODO(), filter, session)
+func (s SessionServiceImpl) UpdateSessionLifecycle(session *models.Session) error {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"name": session.Name, "version": session.Version, "lifecycleVersion": session.LifecycleVersion}
+	if session.LifecycleVersion == 0 {
+		//not stored until the first lifecycle change
+		filter["lifecycleVersion"] = bson.M{"$exists": false}
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"lifecycle":        session.Lifecycle,
+			"cleanupAttempts":  session.CleanupAttempts,
+			"cleanupError":     session.CleanupError,
+			"cleanupAttemptAt": session.CleanupAttemptAt,
+			"cleanedAt":        session.CleanedAt,
+			"legacyUsers":      session.LegacyUsers,
+			"updatedAt":        now,
+		},
+		"$inc": bson.M{"lifecycleVersion": 1},
+	}
+	result, err := s.sessions.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
-
+	if result.MatchedCount == 0 {
+		if _, err := s.GetSessionByName(session.Name); err != nil {
+			return err
+		}
+		return ErrVersionConflict
+	}
+	session.UpdatedAt = now
+	session.LifecycleVersion++
 	return nil
 }
 
-func getMongoClient() *mongo.Client {
-	credential := options.Credential{
-		AuthSource:    "eventengine",
-		AuthMechanism: "SCRAM-SHA-256",
-		Username:      os.Getenv("mongo_usr"),
-		Password:      os.Getenv("mongo_pwd"),
+func (s SessionServiceImpl) GetSessionsByLifecycle(states ...string) ([]models.Session, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	filter := bson.M{"lifecycle": bson.M{"$in": states}}
+	var sessions []models.Session
+	cursor, err := s.sessions.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "cleanupAttemptAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		if err := s.decryptSecrets(&sessions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+func (s SessionServiceImpl) AddSessionCoHost(name string, coHost string) (*models.Session, error) {
+	return s.updateCoHosts(name, bson.M{"$addToSet": bson.M{"coHosts": coHost}})
+}
+
+func (s SessionServiceImpl) RemoveSessionCoHost(name string, coHost string) (*models.Session, error) {
+	return s.updateCoHosts(name, bson.M{"$pull": bson.M{"coHosts": coHost}})
+}
+
+func (s SessionServiceImpl) updateCoHosts(name string, update bson.M) (*models.Session, error) {
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	update["$set"] = bson.M{"updatedAt": time.Now()}
+	update["$inc"] = bson.M{"version": 1}
+	var session *models.Session
+	err := s.sessions.FindOneAndUpdate(ctx, bson.M{"name": name}, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.decryptSecrets(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ReencryptSecrets encrypts plaintext credentials and re-wraps credentials sealed with a retired master key
+// under the primary key. It returns the number of sessions rewritten.
+func (s SessionServiceImpl) ReencryptSecrets() (int, error) {
+	if s.keyring == nil {
+		return 0, errors.New("no secret keys configured")
 	}
-	mongoHost := os.Getenv("mongo_host")
-	clientOptions := options.Client().ApplyURI("mongodb://" + mongoHost + ":27017").SetAuth(credential)
-	client, err := mongo.Connect(context.Background(), clientOptions)
+	ctx, cancel := s.operationContext()
+	defer cancel()
+
+	var stored []models.Session
+	cursor, err := s.sessions.Find(ctx, bson.M{})
 	if err != nil {
-		log.Fatalf("Error creating mongo client: %s", err)
+		return 0, err
 	}
-	return client
+	if err = cursor.All(ctx, &stored); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, session := range stored {
+		if !s.needsReencrypt(session) {
+			continue
+		}
+		if err := s.decryptSecrets(&session); err != nil {
+			return count, fmt.Errorf("unable to decrypt session %s: %w", session.Name, err)
+		}
+		if err := s.encryptSecrets(&session); err != nil {
+			return count, fmt.Errorf("unable to encrypt session %s: %w", session.Name, err)
+		}
+		update := bson.M{
+			"$set":   bson.M{"lwAccessKeyIDEnc": session.LwAccessKeyIDEnc, "lwSecretKeyEnc": session.LwSecretKeyEnc},
+			"$unset": bson.M{"lwAccessKeyID": "", "lwSecretKey": ""},
+		}
+		if _, err := s.sessions.UpdateOne(ctx, bson.M{"name": session.Name}, update); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (s SessionServiceImpl) needsReencrypt(session models.Session) bool {
+	if session.LwAccessKeyID != "" || session.LwSecretKey != "" {
+		return true
+	}
+	for _, value := range []*models.EncryptedValue{session.LwAccessKeyIDEnc, session.LwSecretKeyEnc} {
+		if value != nil && s.keyring.NeedsRotation(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptSecrets moves the plaintext credentials of session into their encrypted fields.
+func (s SessionServiceImpl) encryptSecrets(session *models.Session) error {
+	if s.keyring == nil {
+		return nil
+	}
+	session.LwAccessKeyIDEnc, session.LwSecretKeyEnc = nil, nil
+	if session.LwAccessKeyID != "" {
+		value, err := s.keyring.Encrypt(session.LwAccessKeyID)
+		if err != nil {
+			return err
+		}
+		session.LwAccessKeyIDEnc, session.LwAccessKeyID = value, ""
+	}
+	if session.LwSecretKey != "" {
+		value, err := s.keyring.Encrypt(session.LwSecretKey)
+		if err != nil {
+			return err
+		}
+		session.LwSecretKeyEnc, session.LwSecretKey = value, ""
+	}
+	return nil
+}
+
+// decryptSecrets restores the plaintext credentials of session from their encrypted fields.
+func (s SessionServiceImpl) decryptSecrets(session *models.Session) error {
+	if session.LwAccessKeyIDEnc == nil && session.LwSecretKeyEnc == nil {
+		return nil
+	}
+	if s.keyring == nil {
+		return fmt.Errorf("session %s has encrypted credentials but no secret keys are configured", session.Name)
+	}
+	if session.LwAccessKeyIDEnc != nil {
+		value, err := s.keyring.Decrypt(session.LwAccessKeyIDEnc)
+		if err != nil {
+			return err
+		}
+		session.LwAccessKeyID = value
+	}
+	if session.LwSecretKeyEnc != nil {
+		value, err := s.keyring.Decrypt(session.LwSecretKeyEnc)
+		if err != nil {
+			return err
+		}
+		session.LwSecretKey = value
+	}
+	session.LwAccessKeyIDEnc, session.LwSecretKeyEnc = nil, nil
+	return nil
+}
+
+// operationContext bounds a single mongo operation by the configured operation timeout.
+func (s SessionServiceImpl) operationContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(s.ctx, s.operationTimeout)
 }
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"bytes"
+	"github.com/jefferyfry/eventengine/keyring"
+	"github.com/jefferyfry/eventengine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func testKeyring(t *testing.T) *keyring.Keyring {
+	t.Helper()
+	k, err := keyring.New("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestPatchUpdateCredentials(t *testing.T) {
+	accessKeyID, secretKey := "ACCESS_KEY_ID_1234", "_0123456789abcdef"
+	tests := []struct {
+		name      string
+		keyring   bool
+		patch     models.SessionPatchReq
+		wantSet   []string
+		wantUnset []string
+	}{
+		{name: "no credentials", keyring: true, patch: models.SessionPatchReq{}},
+		{name: "encrypted secret", keyring: true, patch: models.SessionPatchReq{LwSecretKey: &secretKey},
+			wantSet: []string{"lwSecretKeyEnc"}, wantUnset: []string{"lwSecretKey"}},
+		{name: "encrypted credentials", keyring: true, patch: models.SessionPatchReq{LwAccessKeyID: &accessKeyID, LwSecretKey: &secretKey},
+			wantSet: []string{"lwAccessKeyIDEnc", "lwSecretKeyEnc"}, wantUnset: []string{"lwAccessKeyID", "lwSecretKey"}},
+		{name: "plaintext without a keyring", patch: models.SessionPatchReq{LwAccessKeyID: &accessKeyID, LwSecretKey: &secretKey},
+			wantSet: []string{"lwAccessKeyID", "lwSecretKey"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := SessionServiceImpl{}
+			if test.keyring {
+				s.keyring = testKeyring(t)
+			}
+			update, err := s.patchUpdate(&test.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			set := update["$set"].(bson.M)
+			for _, key := range test.wantSet {
+				if _, ok := set[key]; !ok {
+					t.Errorf("$set = %v, want %s", set, key)
+				}
+			}
+			for _, key := range []string{"lwAccessKeyID", "lwSecretKey"} {
+				if value, ok := set[key]; ok && test.keyring {
+					t.Errorf("$set %s = %v, want no plaintext", key, value)
+				}
+			}
+			unset, _ := update["$unset"].(bson.M)
+			if len(unset) != len(test.wantUnset) {
+				t.Errorf("$unset = %v, want %v", unset, test.wantUnset)
+			}
+			for _, key := range test.wantUnset {
+				if _, ok := unset[key]; !ok {
+					t.Errorf("$unset = %v, want %s", unset, key)
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptSecrets(t *testing.T) {
+	s := SessionServiceImpl{keyring: testKeyring(t)}
+
+	legacy := models.Session{Name: "legacy", LwAccessKeyID: "KEY", LwSecretKey: "SECRET"}
+	if err := s.decryptSecrets(&legacy); err != nil || legacy.LwAccessKeyID != "KEY" || legacy.LwSecretKey != "SECRET" {
+		t.Errorf("decryptSecrets() of legacy plaintext = %+v, %v, want it unchanged", legacy, err)
+	}
+	if !s.needsReencrypt(legacy) {
+		t.Error("needsReencrypt() = false for legacy plaintext")
+	}
+
+	stored := models.Session{Name: "demo", LwAccessKeyID: "KEY", LwSecretKey: "SECRET"}
+	if err := s.encryptSecrets(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.LwAccessKeyID != "" || stored.LwSecretKey != "" || s.needsReencrypt(stored) {
+		t.Errorf("encryptSecrets() = %+v, want only encrypted credentials", stored)
+	}
+	if err := (SessionServiceImpl{}).decryptSecrets(&stored); err == nil {
+		t.Error("decryptSecrets() without a keyring succeeded, want an error")
+	}
+	if err := s.decryptSecrets(&stored); err != nil || stored.LwAccessKeyID != "KEY" || stored.LwSecretKey != "SECRET" {
+		t.Errorf("decryptSecrets() = %+v, %v, want the plaintext credentials", stored, err)
+	}
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"github.com/jefferyfry/eventengine/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionServiceMemory is a thread-safe, in-memory SessionService for local development and tests.
+// Nothing is persisted across restarts.
+type SessionServiceMemory struct {
+	mu       sync.RWMutex
+	sessions map[string]models.Session
+}
+
+func NewSessionServiceMemory() SessionService {
+	return &SessionServiceMemory{sessions: map[string]models.Session{}}
+}
+
+func (s *SessionServiceMemory) GetSessionByName(name string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+	}
+	return &session, nil
+}
+
+func (s *SessionServiceMemory) GetAllSessions() ([]models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]models.Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+func (s *SessionServiceMemory) GetSessionsInScope(scope models.SessionScope) ([]models.Session, error) {
+	sessions, err := s.GetAllSessions()
+	if err != nil {
+		return nil, err
+	}
+	visible := []models.Session{}
+	for _, session := range sessions {
+		if scope.CanView(session) {
+			visible = append(visible, session)
+		}
+	}
+	return visible, nil
+}
+
+func (s *SessionServiceMemory) AddSession(session *models.Session) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.Name]; ok {
+		return nil, ErrSessionExists
+	}
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = session.CreatedAt
+	session.Version = 1
+	session.Lifecycle = models.SESSION_LIFECYCLE_ACTIVE
+	s.sessions[session.Name] = *session
+	return session, nil
+}
+
+func (s *SessionServiceMemory) PatchSession(name string, patch *models.SessionPatchReq) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+	}
+	if patch.Version > 0 && patch.Version != session.Version {
+		return nil, ErrVersionConflict
+	}
+	if patch.Name != nil && *patch.Name != name {
+		if _, ok := s.sessions[*patch.Name]; ok {
+			return nil, ErrSessionExists
+		}
+	}
+	patch.Apply(&session)
+	session.UpdatedAt = time.Now()
+	session.Version++
+	delete(s.sessions, name)
+	s.sessions[session.Name] = session
+	return &session, nil
+}
+
+func (s *SessionServiceMemory) DeleteSession(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+	}
+	delete(s.sessions, name)
+	return nil
+}
+
+func (s *SessionServiceMemory) DeleteSessions(sessions []string) error {
+	for _, session := range sessions {
+		if err := s.DeleteSession(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionServiceMemory) ReserveSessionSeat(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+	}
+	if !session.ExpiresAt.After(time.Now()) || session.InCleanup() {
+		return ErrSessionExpired
+	}
+	if session.MaxRegistrations > 0 && session.RegCount >= session.MaxRegistrations {
+		return ErrSessionFull
+	}
+	session.RegCount++
+	session.UpdatedAt = time.Now()
+	s.sessions[name] = session
+	return nil
+}
+
+func (s *SessionServiceMemory) ReleaseSessionSeat(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[name]
+	if !ok || session.RegCount == 0 {
+		return nil
+	}
+	session.RegCount--
+	session.UpdatedAt = time.Now()
+	s.sessions[name] = session
+	return nil
+}
+
+func (s *SessionServiceMemory) UpdateSessionLifecycle(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sessions[session.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, session.Name)
+	}
+	if stored.Version != session.Version || stored.LifecycleVersion != session.LifecycleVersion {
+		return ErrVersionConflict
+	}
+	stored.Lifecycle = session.Lifecycle
+	stored.CleanupAttempts = session.CleanupAttempts
+	stored.CleanupError = session.CleanupError
+	stored.CleanupAttemptAt = session.CleanupAttemptAt
+	stored.CleanedAt = session.CleanedAt
+	stored.LegacyUsers = session.LegacyUsers
+	stored.UpdatedAt = time.Now()
+	stored.LifecycleVersion++
+	s.sessions[session.Name] = stored
+	session.UpdatedAt, session.LifecycleVersion = stored.UpdatedAt, stored.LifecycleVersion
+	return nil
+}
+
+func (s *SessionServiceMemory) GetSessionsByLifecycle(states ...string) ([]models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, session := range s.sessions {
+		if containsString(states, session.Lifecycle) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Name < sessions[j].Name
+	})
+	return sessions, nil
+}
+
+func (s *SessionServiceMemory) AddSessionCoHost(name string, coHost string) (*models.Session, error) {
+	return s.updateCoHosts(name, func(coHosts []string) []string {
+		if containsString(coHosts, coHost) {
+			return coHosts
+		}
+		return append(append([]string{}, coHosts...), coHost)
+	})
+}
+
+func (s *SessionServiceMemory) RemoveSessionCoHost(name string, coHost string) (*models.Session, error) {
+	return s.updateCoHosts(name, func(coHosts []string) []string {
+		var kept []string
+		for _, c := range coHosts {
+			if c != coHost {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	})
+}
+
+func (s *SessionServiceMemory) updateCoHosts(name string, update func([]string) []string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+	}
+	session.CoHosts = update(session.CoHosts)
+	session.UpdatedAt = time.Now()
+	session.Version++
+	s.sessions[name] = session
+	return &session, nil
+}
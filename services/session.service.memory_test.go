@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"github.com/jefferyfry/eventengine/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReserveSessionSeat(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxRegistrations int
+		regCount         int
+		expiresIn        time.Duration
+		lifecycle        string
+		session          string
+		wantErr          error
+	}{
+		{name: "unlimited", maxRegistrations: 0, regCount: 500, expiresIn: time.Hour},
+		{name: "below the limit", maxRegistrations: 2, regCount: 1, expiresIn: time.Hour},
+		{name: "full", maxRegistrations: 2, regCount: 2, expiresIn: time.Hour, wantErr: ErrSessionFull},
+		{name: "over the limit after it was lowered", maxRegistrations: 2, regCount: 5, expiresIn: time.Hour, wantErr: ErrSessionFull},
+		{name: "expired", maxRegistrations: 0, expiresIn: -time.Minute, wantErr: ErrSessionExpired},
+		{name: "in cleanup", maxRegistrations: 0, expiresIn: time.Hour, lifecycle: models.SESSION_LIFECYCLE_CLEANUP_PENDING, wantErr: ErrSessionExpired},
+		{name: "unknown session", expiresIn: time.Hour, session: "missing", wantErr: ErrSessionNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sessionService := NewSessionServiceMemory()
+			session := &models.Session{Name: "demo", MaxRegistrations: test.maxRegistrations, RegCount: test.regCount, ExpiresAt: time.Now().Add(test.expiresIn)}
+			if _, err := sessionService.AddSession(session); err != nil {
+				t.Fatal(err)
+			}
+			if test.lifecycle != "" {
+				session.Lifecycle = test.lifecycle
+				if err := sessionService.UpdateSessionLifecycle(session); err != nil {
+					t.Fatal(err)
+				}
+			}
+			name := session.Name
+			if test.session != "" {
+				name = test.session
+			}
+
+			err := sessionService.ReserveSessionSeat(name)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("ReserveSessionSeat() = %v, want %v", err, test.wantErr)
+			}
+			if test.session != "" {
+				return
+			}
+			stored, _ := sessionService.GetSessionByName(name)
+			wantCount := test.regCount
+			if test.wantErr == nil {
+				wantCount++
+			}
+			if stored.RegCount != wantCount {
+				t.Errorf("RegCount = %d, want %d", stored.RegCount, wantCount)
+			}
+		})
+	}
+}
+
+func TestReserveSessionSeatConcurrent(t *testing.T) {
+	sessionService := NewSessionServiceMemory()
+	if _, err := sessionService.AddSession(&models.Session{Name: "demo", MaxRegistrations: 10, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved, full := 0, 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := sessionService.ReserveSessionSeat("demo")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				reserved++
+			case errors.Is(err, ErrSessionFull):
+				full++
+			default:
+				t.Errorf("ReserveSessionSeat() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 10 || full != 40 {
+		t.Errorf("reserved %d and refused %d seats, want 10 and 40", reserved, full)
+	}
+
+	if err := sessionService.ReleaseSessionSeat("demo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sessionService.ReserveSessionSeat("demo"); err != nil {
+		t.Errorf("ReserveSessionSeat() after a release = %v, want nil", err)
+	}
+}
+
+func TestUpdateSessionLifecycleKeepsVersion(t *testing.T) {
+	sessionService := NewSessionServiceMemory()
+	session, err := sessionService.AddSession(&models.Session{Name: "demo", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := *session
+
+	session.Lifecycle = models.SESSION_LIFECYCLE_EXPIRING
+	if err := sessionService.UpdateSessionLifecycle(session); err != nil {
+		t.Fatal(err)
+	}
+	if session.Version != read.Version {
+		t.Errorf("Version = %d after a lifecycle change, want %d", session.Version, read.Version)
+	}
+
+	//an edit based on the version read before the lifecycle change still applies
+	group := "LACEWORK_USER_GROUP_POWER_USER"
+	if _, err := sessionService.PatchSession("demo", &models.SessionPatchReq{LwUserGroup: &group, Version: read.Version}); err != nil {
+		t.Errorf("PatchSession() = %v, want nil", err)
+	}
+
+	//cleanup working from a stale read is refused
+	stale := read
+	stale.Lifecycle = models.SESSION_LIFECYCLE_CLEANUP_PENDING
+	if err := sessionService.UpdateSessionLifecycle(&stale); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("UpdateSessionLifecycle() with a stale session = %v, want %v", err, ErrVersionConflict)
+	}
+}